@@ -0,0 +1,137 @@
+package eventsourceprocessor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ArrayLength computes the current state of the document, and returns the number of elements in the array at path.
+// An empty path refers to the document itself, if it is an array.
+func (doc Document) ArrayLength(path string) (int, error) {
+	return doc.arrayLength(currentSettings(), path)
+}
+
+// ArrayLength works like Document.ArrayLength, using the processor's configuration.
+func (processor *Processor) ArrayLength(doc Document, path string) (int, error) {
+	return doc.arrayLength(processor.config, path)
+}
+
+// arrayLength does the work of ArrayLength, with the supplied settings.
+func (doc Document) arrayLength(config *settings, path string) (int, error) {
+	elements, err := doc.arrayAt(config, path)
+	if err != nil {
+		return 0, err
+	}
+	return len(elements), nil
+}
+
+// Sum computes the current state of the document, and returns the total of the numeric array at path. The sum of an
+// empty array is 0; any non-numeric element is an error.
+func (doc Document) Sum(path string) (float64, error) {
+	return doc.sum(currentSettings(), path)
+}
+
+// Sum works like Document.Sum, using the processor's configuration.
+func (processor *Processor) Sum(doc Document, path string) (float64, error) {
+	return doc.sum(processor.config, path)
+}
+
+// sum does the work of Sum, with the supplied settings.
+func (doc Document) sum(config *settings, path string) (float64, error) {
+	numbers, err := doc.numbersAt(config, path)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, number := range numbers {
+		total += number
+	}
+	return total, nil
+}
+
+// Min computes the current state of the document, and returns the smallest value in the numeric array at path. The
+// array must not be empty, and any non-numeric element is an error.
+func (doc Document) Min(path string) (float64, error) {
+	return doc.extreme(currentSettings(), path, smaller)
+}
+
+// Min works like Document.Min, using the processor's configuration.
+func (processor *Processor) Min(doc Document, path string) (float64, error) {
+	return doc.extreme(processor.config, path, smaller)
+}
+
+// Max works like Min, but returns the largest value.
+func (doc Document) Max(path string) (float64, error) {
+	return doc.extreme(currentSettings(), path, larger)
+}
+
+// Max works like Document.Max, using the processor's configuration.
+func (processor *Processor) Max(doc Document, path string) (float64, error) {
+	return doc.extreme(processor.config, path, larger)
+}
+
+func smaller(candidate, current float64) bool { return candidate < current }
+
+func larger(candidate, current float64) bool { return candidate > current }
+
+func (doc Document) extreme(config *settings, path string, better func(candidate, current float64) bool) (float64, error) {
+	numbers, err := doc.numbersAt(config, path)
+	if err != nil {
+		return 0, err
+	}
+	if len(numbers) == 0 {
+		return 0, fmt.Errorf("%w: `%s`", ErrEmptyArray, path)
+	}
+	result := numbers[0]
+	for _, number := range numbers[1:] {
+		if better(number, result) {
+			result = number
+		}
+	}
+	return result, nil
+}
+
+// numbersAt returns the values of the numeric array at path.
+func (doc Document) numbersAt(config *settings, path string) ([]float64, error) {
+	elements, err := doc.arrayAt(config, path)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make([]float64, len(elements))
+	for i, elem := range elements {
+		if elem.ElementType != DataTypeNumber {
+			return nil, fmt.Errorf("%w: element %d of array `%s` is a %s, not a number", ErrInvalidDataType, i, path, elem.ElementType)
+		}
+		numbers[i], err = strconv.ParseFloat(elem.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("element %d of array `%s` is not a valid number: %w", i, path, err)
+		}
+	}
+	return numbers, nil
+}
+
+// arrayAt computes the current state of the document, and returns the elements of the array at path.
+func (doc Document) arrayAt(config *settings, path string) ([]*documentElement, error) {
+	docMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var elem *documentElement
+	if path == "" {
+		if !docMap.IsArray {
+			return nil, errors.New("the document root is not an array")
+		}
+		elem = docMap.Elements["array"]
+	} else {
+		elem, err = getMapPathElement(config, path, false, docMap)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find `%s`: %w", path, err)
+		}
+	}
+	if elem.ElementType != DataTypeArray {
+		return nil, fmt.Errorf("%w: `%s` is a %s, not an array", ErrInvalidDataType, path, elem.ElementType)
+	}
+	return elem.ArrayContent, nil
+}
@@ -0,0 +1,102 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func aggregateTestDocument() eventsourceprocessor.Document {
+	return inlineDocument(`{"name":"someone","scores":[3,1.5],"orders":[{"totals":[]}],"tags":["a",2]}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "scores[new]",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeNumber,
+			Value:      "-2",
+		},
+	)
+}
+
+func TestArrayLength(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := aggregateTestDocument()
+
+	length, err := inputDoc.ArrayLength("scores")
+	that.Nil(err)
+	that.Equal(3, length)
+
+	length, err = inputDoc.ArrayLength("orders[first].totals")
+	that.Nil(err)
+	that.Equal(0, length)
+}
+
+func TestArrayLengthRootArray(t *testing.T) {
+	that := assert.New(t)
+	length, err := inlineDocument(`[1,2]`).ArrayLength("")
+
+	that.Nil(err)
+	that.Equal(2, length)
+}
+
+func TestArrayLengthAbsentPath_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := aggregateTestDocument().ArrayLength("missing")
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "unable to find `missing`")
+	}
+}
+
+func TestArrayLengthNonArrayPath_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := aggregateTestDocument().ArrayLength("name")
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "not an array")
+	}
+}
+
+func TestSum(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := aggregateTestDocument()
+
+	sum, err := inputDoc.Sum("scores")
+	that.Nil(err)
+	that.Equal(2.5, sum)
+
+	sum, err = inputDoc.Sum("orders[first].totals")
+	that.Nil(err)
+	that.Equal(0.0, sum)
+}
+
+func TestSumNonNumericElement_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := aggregateTestDocument().Sum("tags")
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "element 0 of array `tags` is a string")
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := aggregateTestDocument()
+
+	lowest, err := inputDoc.Min("scores")
+	that.Nil(err)
+	that.Equal(-2.0, lowest)
+
+	highest, err := inputDoc.Max("scores")
+	that.Nil(err)
+	that.Equal(3.0, highest)
+}
+
+func TestMinEmptyArray_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := aggregateTestDocument().Min("orders[first].totals")
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "is empty")
+	}
+}
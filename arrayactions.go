@@ -0,0 +1,89 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// appendValue adds the instruction's value to the end of the array at its path - as `[new]` does, but without the
+// indexer. A missing (or null) array is created. An empty path appends to the document, which must be an array.
+func (docMap *documentMap) appendValue(config *settings, instruction EventInstruction) error {
+	var arrayElem *documentElement
+	if instruction.Path == "" {
+		if !docMap.IsArray {
+			return fmt.Errorf("%w: the %s action can only add to a document which is an array", ErrInvalidDataType, instruction.ActionType)
+		}
+		arrayElem = docMap.Elements["array"]
+	} else {
+		var err error
+		arrayElem, err = docMap.locate(config, instruction.Path, true)
+		if err != nil {
+			return err
+		}
+	}
+	if arrayElem.ElementType != DataTypeArray && arrayElem.ElementType != DataTypeNull {
+		return fmt.Errorf("%w: `%s` is a %s, not an array", ErrInvalidDataType, instruction.Path, arrayElem.ElementType)
+	}
+
+	newElem := &documentElement{}
+	err := newElem.setValue(config, instruction.DataType, instruction.Value)
+	if err != nil {
+		return err
+	}
+	// Only now the value's been decoded, so a bad one leaves a null as it was
+	if arrayElem.ElementType == DataTypeNull {
+		arrayElem.makeContainer(config, DataTypeArray)
+	}
+	return arrayElem.appendElement(config, newElem)
+}
+
+// insertAt inserts the instruction's value into an array at a numeric index, e.g. `items[2]`, moving the element
+// there (and those after it) along. An index equal to the array's length appends.
+func (docMap *documentMap) insertAt(config *settings, instruction EventInstruction) error {
+	arrayElem, index, err := docMap.indexedArray(config, instruction)
+	if err != nil {
+		return err
+	}
+	if index > len(arrayElem.ArrayContent) {
+		return fmt.Errorf("array index %d is out of range for the %s action, array `%s` has %d elements", index, instruction.ActionType, arrayElem.Name, len(arrayElem.ArrayContent))
+	}
+	if config.MaxArrayLength > 0 && len(arrayElem.ArrayContent) >= config.MaxArrayLength {
+		// Dropping the oldest element, as appending may, would move the new element from the index asked for
+		return fmt.Errorf("array `%s` already has the maximum of %d elements", arrayElem.Name, config.MaxArrayLength)
+	}
+
+	newElem := &documentElement{}
+	err = newElem.setValue(config, instruction.DataType, instruction.Value)
+	if err != nil {
+		return err
+	}
+	// Copied rather than shuffled along in place, as a snapshot may share the backing array
+	original := arrayElem.ArrayContent
+	arrayElem.ArrayContent = append(append(original[:index:index], newElem), original[index:]...)
+	return nil
+}
+
+// indexedArray finds the array, and the index within it, addressed by an instruction whose path ends with a numeric
+// indexer, e.g. `items[2]`. The index isn't checked against the array's length.
+func (docMap *documentMap) indexedArray(config *settings, instruction EventInstruction) (*documentElement, int, error) {
+	if instruction.Path == "" {
+		return nil, 0, fmt.Errorf("the %s action needs a path ending with a numeric array index; for a document which is an array, e.g. `%s0%s`", instruction.ActionType, config.arrayOpen(), config.arrayClose())
+	}
+	arrayPath, indexer := splitLastIndexer(config, instruction.Path)
+	if indexer == "" {
+		return nil, 0, fmt.Errorf("`%s` must end with a numeric array index for the %s action", instruction.Path, instruction.ActionType)
+	}
+	index, err := strconv.Atoi(indexerName(config, indexer))
+	if err != nil || index < 0 {
+		return nil, 0, fmt.Errorf("`%s` is not a numeric array index for the %s action", indexer, instruction.ActionType)
+	}
+
+	arrayElem, err := getMapPathElement(config, arrayPath, false, docMap)
+	if err != nil {
+		return nil, 0, err
+	}
+	if arrayElem.ElementType != DataTypeArray {
+		return nil, 0, fmt.Errorf("%w: `%s` is not an array", ErrInvalidDataType, arrayPath)
+	}
+	return arrayElem, index, nil
+}
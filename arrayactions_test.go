@@ -0,0 +1,118 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendString(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"tags":["a","b"]}`,
+		eventsourceprocessor.EventInstruction{Path: "tags", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeString, Value: "c"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"tags":["a","b","c"]}`, string(result))
+}
+
+func TestAppendObject(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"orders":[{"id":1}]}`,
+		eventsourceprocessor.EventInstruction{Path: "orders", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeMap, Value: `{"id":2,"lines":[]}`},
+		eventsourceprocessor.EventInstruction{Path: "orders[last].lines", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeArray, Value: `["sku",1]`},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"orders":[{"id":1},{"id":2,"lines":[["sku",1]]}]}`, string(result))
+}
+
+func TestAppendCreatesArray(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"empty":null}`,
+		eventsourceprocessor.EventInstruction{Path: "new.tags", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeNumber, Value: "1"},
+		eventsourceprocessor.EventInstruction{Path: "empty", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeBool, Value: "true"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"new":{"tags":[1]},"empty":[true]}`, string(result))
+}
+
+func TestAppendToRootArray(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`[1]`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeMap, Value: `{"a":2}`},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`[1,{"a":2}]`, string(result))
+}
+
+func TestAppendToNonArray_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"tags":"a"}`,
+		eventsourceprocessor.EventInstruction{Path: "tags", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeString, Value: "b"},
+	)
+	_, err := inputDoc.GetCurrentState()
+
+	that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+}
+
+func insertAtInstruction(path string, value string) eventsourceprocessor.EventInstruction {
+	return eventsourceprocessor.EventInstruction{Path: path, ActionType: eventsourceprocessor.ActionTypeInsertAt, DataType: eventsourceprocessor.DataTypeString, Value: value}
+}
+
+func TestInsertAt(t *testing.T) {
+	that := assert.New(t)
+	cases := map[string]string{
+		"items[0]": `{"items":["new","a","b","c"]}`,
+		"items[1]": `{"items":["a","new","b","c"]}`,
+		"items[3]": `{"items":["a","b","c","new"]}`,
+	}
+	for path, expected := range cases {
+		result, err := inlineDocument(`{"items":["a","b","c"]}`, insertAtInstruction(path, "new")).GetCurrentState()
+
+		if that.Nil(err, path) {
+			that.JSONEq(expected, string(result), path)
+		}
+	}
+}
+
+func TestInsertAtRootArray(t *testing.T) {
+	that := assert.New(t)
+	result, err := inlineDocument(`[1,2]`, insertAtInstruction("[1]", "x")).GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`[1,"x",2]`, string(result))
+}
+
+func TestInsertAtOutOfRange_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := inlineDocument(`{"items":["a","b","c"]}`, insertAtInstruction("items[4]", "new")).GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "array index 4 is out of range for the InsertAt action, array `items` has 3 elements")
+	}
+}
+
+func TestInsertAtAtomicFailureRestores(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.Atomic = true
+	})
+	inputDoc := inlineDocument(`{"items":["a","b","c"]}`,
+		insertAtInstruction("items[0]", "new"),
+		eventsourceprocessor.EventInstruction{Path: "missing.field", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+	)
+
+	result, err := inputDoc.GetCurrentState()
+
+	that.NotNil(err)
+	that.JSONEq(`{"items":["a","b","c"]}`, string(result))
+}
@@ -0,0 +1,76 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A conditional array indexer selects the element of an array of objects whose property has a given value, e.g.
+// `lineItems[sku=ABC123].quantity`. Values are compared as the property's type, so `[id=42]` matches both the number
+// 42 (or 42.0) and the string "42"; as when comparing values elsewhere, FloatEpsilon and CaseInsensitiveValues apply.
+
+// parseCondition splits a conditional array indexer, e.g. `[sku=ABC123]`, into its key and value. The value keeps its
+// case; ok is false if the indexer isn't a condition.
+func parseCondition(config *settings, indexer string) (key string, value string, ok bool) {
+	return strings.Cut(strings.TrimSuffix(strings.TrimPrefix(indexer, config.arrayOpen()), config.arrayClose()), "=")
+}
+
+// findMatching returns the index of the first element of an array which is an object whose key property holds value,
+// or -1 if there isn't one.
+func (arrayElem *documentElement) findMatching(config *settings, key, value string) int {
+	for i, elem := range arrayElem.ArrayContent {
+		if elem.ElementType != DataTypeMap || elem.Content == nil {
+			continue
+		}
+		_, property := elem.Content.findElement(config, key)
+		if property != nil && property.matches(config, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matches reports whether a property holds a condition's value. Only scalars can match; the value is compared with the
+// shared value equality, read as the same type as the property.
+func (property *documentElement) matches(config *settings, value string) bool {
+	switch property.ElementType {
+	case DataTypeMap, DataTypeArray:
+		return false
+	case DataTypeNull:
+		return value == "null"
+	}
+	return property.equal(config, &documentElement{ElementType: property.ElementType, Value: value})
+}
+
+// getConditionalArrayElement finds the array element matching a condition. If there isn't one and createIfMissing is
+// set, a new object is appended with the condition's key set to its value.
+func getConditionalArrayElement(config *settings, key, value, nextAction, basePath string, createIfMissing bool, arrayElem *documentElement) (*documentElement, error) {
+	index := arrayElem.findMatching(config, key, value)
+	if index >= 0 {
+		return resolveArrayElement(config, arrayElem.ArrayContent[index], nextAction, basePath, createIfMissing)
+	}
+	if !createIfMissing {
+		return nil, fmt.Errorf("%w: array `%s` has no element with `%s` equal to `%s`", ErrElementNotFound, arrayElem.Name, key, value)
+	}
+
+	keyElem := &documentElement{Name: key}
+	dataType := inferDataType(value)
+	if dataType == DataTypeMap || dataType == DataTypeArray {
+		dataType = DataTypeString
+	}
+	err := keyElem.setValue(config, dataType, value)
+	if err != nil {
+		return nil, err
+	}
+	newElem := &documentElement{
+		ElementType: DataTypeMap,
+		Content: &documentMap{
+			Elements: map[string]*documentElement{key: keyElem},
+		},
+	}
+	err = arrayElem.appendElement(config, newElem)
+	if err != nil {
+		return nil, err
+	}
+	return resolveArrayElement(config, newElem, nextAction, basePath, createIfMissing)
+}
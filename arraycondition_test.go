@@ -0,0 +1,85 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalIndexer(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"lineItems":[{"sku":"abc123","quantity":1},{"sku":"ABC123","quantity":2}],"orders":[{"id":41},{"id":42,"lines":[[{"n":1}]]}]}`,
+		// Values are case-sensitive, keys aren't
+		eventsourceprocessor.EventInstruction{Path: "lineItems[SKU=ABC123].quantity", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNumber, Value: "5"},
+		eventsourceprocessor.EventInstruction{Path: "orders[id=42].lines[first][first].n", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNumber, Value: "2"},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"lineItems":[{"sku":"abc123","quantity":1},{"sku":"ABC123","quantity":5}],"orders":[{"id":41},{"id":42,"lines":[[{"n":2}]]}]}`, string(outputDoc))
+}
+
+func TestConditionalIndexerDottedValue(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"releases":[{"ver":"1.1","notes":{}},{"ver":"1.2","notes":{}}],"prices":[{"amount":2.5}]}`,
+		eventsourceprocessor.EventInstruction{Path: "releases[ver=1.2].notes.summary", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "fixes"},
+		eventsourceprocessor.EventInstruction{Path: "releases[ver=1.1].notes.^.ver", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "1.1.1"},
+		eventsourceprocessor.EventInstruction{Path: "prices[amount=2.5].currency", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "GBP"},
+	)
+	outcomes, outputDoc, err := inputDoc.ApplyDetailed()
+
+	that.Nil(err)
+	that.JSONEq(`{"releases":[{"ver":"1.1.1","notes":{}},{"ver":"1.2","notes":{"summary":"fixes"}}],"prices":[{"amount":2.5,"currency":"GBP"}]}`, string(outputDoc))
+	if that.Len(outcomes, 3) {
+		that.Equal("releases[1].notes.summary", outcomes[0].ResolvedPath)
+		that.Equal("releases[0].ver", outcomes[1].ResolvedPath)
+	}
+}
+
+func TestConditionalIndexerAppendsWhenMissing(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"orders":[{"id":41}]}`,
+		eventsourceprocessor.EventInstruction{Path: "orders[id=42].status", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "new"},
+		// The element added above now matches
+		eventsourceprocessor.EventInstruction{Path: "orders[id=42].total", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "10"},
+		eventsourceprocessor.EventInstruction{Path: "orders[ref=A1].status", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "new"},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"orders":[{"id":41},{"id":42,"status":"new","total":10},{"ref":"A1","status":"new"}]}`, string(outputDoc))
+}
+
+func TestConditionalIndexerNoMatch_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"orders":[{"id":41}]}`, eventsourceprocessor.EventInstruction{
+		Path:       "orders[id=42].status",
+		ActionType: eventsourceprocessor.ActionTypeSetOnly,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "shipped",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Equal("event[0] (id=00000000-0000-0000-0000-000000000000) instruction[0] path `orders[id=42].status`: element not found: array `orders` has no element with `id` equal to `42`", err.Error())
+	}
+}
+
+func TestConditionalIndexerUsesValueEquality(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.CaseInsensitiveValues = true
+		c.FloatEpsilon = 0.001
+	})
+	inputDoc := inlineDocument(`{"lines":[{"sku":"abc123","qty":1},{"price":9.9999,"qty":2},{"id":42.0,"qty":3},{"note":null,"qty":4}]}`,
+		scalarSet("lines[sku=ABC123].qty", "10"),
+		scalarSet("lines[price=10].qty", "20"),
+		scalarSet("lines[id=42].qty", "30"),
+		scalarSet("lines[note=null].qty", "40"),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"lines":[{"sku":"abc123","qty":"10"},{"price":9.9999,"qty":"20"},{"id":42.0,"qty":"30"},{"note":null,"qty":"40"}]}`, string(result))
+}
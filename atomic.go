@@ -0,0 +1,27 @@
+package eventsourceprocessor
+
+// With Configuration.Atomic set, events are applied all-or-nothing: the document map is copied before anything is
+// applied, and if an instruction fails, the copy is put back - so the caller gets the document as it was, along with
+// the error, rather than a half-applied one.
+
+// restore puts a document map back to a copy taken earlier by clone.
+func (docMap *documentMap) restore(original *documentMap) {
+	docMap.Elements = original.Elements
+	docMap.Order = original.Order
+	docMap.IsArray = original.IsArray
+	docMap.IsScalar = original.IsScalar
+	docMap.startParentCache()
+}
+
+// untouchedResult builds the document left behind by a failed apply which, with Atomic set, is as it was before any
+// events were applied. Without Atomic, nothing is returned.
+func (docMap *documentMap) untouchedResult(config *settings) []byte {
+	if docMap == nil || !config.Atomic {
+		return nil
+	}
+	result, err := docMap.buildResult(config)
+	if err != nil {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingSecondInstruction is a document whose second of three instructions fails, after the first has changed it.
+func failingSecondInstruction() eventsourceprocessor.Document {
+	return inlineDocument(`{"status":"new","lines":[{"sku":"A"}]}`,
+		scalarSet("status", "paid"),
+		eventsourceprocessor.EventInstruction{Path: "missing.field", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+		scalarSet("lines[new].sku", "B"),
+	)
+}
+
+func TestAtomicFailureLeavesDocumentUntouched(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.Atomic = true
+	})
+	inputDoc := failingSecondInstruction()
+	// An earlier event which succeeds is rolled back too
+	inputDoc.Events = append([]eventsourceprocessor.DocumentEvent{setEvent(1, "lines[first].sku", "Z")}, inputDoc.Events...)
+
+	result, err := inputDoc.GetCurrentState()
+
+	that.ErrorContains(err, "event[1] (id=00000000-0000-0000-0000-000000000000) instruction[1]")
+	that.JSONEq(`{"status":"new","lines":[{"sku":"A"}]}`, string(result))
+}
+
+func TestAtomicResumeFromFailureReturnsCheckpoint(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.Atomic = true
+	})
+	inputDoc := failingSecondInstruction()
+	checkpoint, err := inputDoc.ApplyPrefix(0)
+	that.Nil(err)
+
+	result, err := eventsourceprocessor.ResumeFrom(checkpoint, inputDoc.Events)
+
+	that.NotNil(err)
+	that.JSONEq(`{"status":"new","lines":[{"sku":"A"}]}`, string(result))
+}
+
+func TestNonAtomicFailureReturnsNothing(t *testing.T) {
+	that := assert.New(t)
+	result, err := failingSecondInstruction().GetCurrentState()
+
+	that.NotNil(err)
+	that.Nil(result)
+}
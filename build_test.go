@@ -0,0 +1,61 @@
+package eventsourceprocessor_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+// wideDocument builds a document with 10k properties, each an object holding an array. The properties are in name
+// order, as they're output.
+func wideDocument() string {
+	var base strings.Builder
+	base.WriteByte('{')
+	for key := 0; key < 10000; key++ {
+		if key > 0 {
+			base.WriteByte(',')
+		}
+		fmt.Fprintf(&base, `"key%05d":{"id":%d,"nested":{"value":"x"},"tags":["a","b"]}`, key, key)
+	}
+	base.WriteByte('}')
+	return base.String()
+}
+
+func TestBuildWideDocument(t *testing.T) {
+	that := assert.New(t)
+	base := wideDocument()
+
+	result, err := inlineDocument(base).GetCurrentState()
+
+	if that.NoError(err) {
+		that.Equal(base, string(result))
+	}
+}
+
+func BenchmarkBuildWideDocument(b *testing.B) {
+	inputDoc := inlineDocument(wideDocument(), scalarSet("key00000.nested.value", "y"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := inputDoc.GetCurrentState()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMapWideDocument(b *testing.B) {
+	base := []byte(wideDocument())
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configure(nil))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := processor.Prepare(base)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
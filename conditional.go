@@ -0,0 +1,37 @@
+package eventsourceprocessor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCompareFailed is returned (wrapped) when a CompareAndSet instruction finds a value other than the one expected.
+var ErrCompareFailed = errors.New("compare and set failed")
+
+// compareAndSet locates an existing element and, if it currently holds the instruction's expected value, sets it to
+// the instruction's value. Maps and arrays are compared deeply, using the same rules as IsConvergent.
+func (docMap *documentMap) compareAndSet(config *settings, instruction EventInstruction) error {
+	expected := &documentElement{}
+	err := expected.setValue(config, instruction.ExpectedDataType, instruction.ExpectedValue)
+	if err != nil {
+		return fmt.Errorf("invalid expected value for `%s`: %w", instruction.Path, err)
+	}
+
+	if instruction.Path == "" {
+		// The document itself; if it matches, it's replaced as SetOrAdd would
+		if !rootElement(docMap).equal(config, expected) {
+			return fmt.Errorf("%w: the document does not hold the expected %s value", ErrCompareFailed, instruction.ExpectedDataType)
+		}
+		return docMap.replaceRoot(config, instruction)
+	}
+
+	elem, err := getMapPathElement(config, instruction.Path, false, docMap)
+	if err != nil {
+		return err
+	}
+	if !elem.equal(config, expected) {
+		return fmt.Errorf("%w: `%s` does not hold the expected %s value", ErrCompareFailed, instruction.Path, instruction.ExpectedDataType)
+	}
+
+	return elem.setValue(config, instruction.DataType, instruction.Value)
+}
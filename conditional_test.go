@@ -0,0 +1,148 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func compareAndSetDocument(path string, expectedDataType eventsourceprocessor.DataType, expected string) eventsourceprocessor.Document {
+	return inlineDocument(`{"address":{"city":"Leeds","lines":["1 High St"],"geo":{"lat":53.8}},"tags":["a","b"],"visits":2}`,
+		eventsourceprocessor.EventInstruction{
+			Path:             path,
+			ActionType:       eventsourceprocessor.ActionTypeCompareAndSet,
+			DataType:         eventsourceprocessor.DataTypeString,
+			Value:            "replaced",
+			ExpectedDataType: expectedDataType,
+			ExpectedValue:    expected,
+		},
+	)
+}
+
+func TestCompareAndSetMatchingObject(t *testing.T) {
+	that := assert.New(t)
+	// Key order doesn't matter, and numbers compare numerically
+	inputDoc := compareAndSetDocument("address", eventsourceprocessor.DataTypeMap, `{"geo":{"lat":53.80},"lines":["1 High St"],"city":"Leeds"}`)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"address":"replaced","tags":["a","b"],"visits":2}`, string(result))
+}
+
+func TestCompareAndSetMismatchingObject_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, expected := range []string{
+		`{"city":"York","lines":["1 High St"],"geo":{"lat":53.8}}`,
+		`{"city":"Leeds","lines":["1 High St"]}`,
+		`{"city":"Leeds","lines":["1 High St"],"geo":{"lat":53.8},"extra":null}`,
+	} {
+		_, err := compareAndSetDocument("address", eventsourceprocessor.DataTypeMap, expected).GetCurrentState()
+
+		if that.NotNil(err, expected) {
+			that.True(errors.Is(err, eventsourceprocessor.ErrCompareFailed), expected)
+		}
+	}
+}
+
+func TestCompareAndSetArray(t *testing.T) {
+	that := assert.New(t)
+	_, err := compareAndSetDocument("tags", eventsourceprocessor.DataTypeArray, `["a","b"]`).GetCurrentState()
+	that.Nil(err)
+
+	_, err = compareAndSetDocument("tags", eventsourceprocessor.DataTypeArray, `["b","a"]`).GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrCompareFailed))
+}
+
+func TestCompareAndSetScalar(t *testing.T) {
+	that := assert.New(t)
+	result, err := compareAndSetDocument("visits", eventsourceprocessor.DataTypeNumber, "2.0").GetCurrentState()
+	that.Nil(err)
+	that.Contains(string(result), `"visits":"replaced"`)
+
+	_, err = compareAndSetDocument("visits", eventsourceprocessor.DataTypeString, "2").GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrCompareFailed))
+}
+
+func TestCompareAndSetMissingElement_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := compareAndSetDocument("missing", eventsourceprocessor.DataTypeNull, "").GetCurrentState()
+
+	that.NotNil(err)
+	that.False(errors.Is(err, eventsourceprocessor.ErrCompareFailed))
+}
+
+func TestCompareAndSetCaseInsensitiveValues(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"Pending","history":[{"state":"NEW"}]}`,
+		eventsourceprocessor.EventInstruction{
+			Path:             "status",
+			ActionType:       eventsourceprocessor.ActionTypeCompareAndSet,
+			DataType:         eventsourceprocessor.DataTypeString,
+			Value:            "Shipped",
+			ExpectedDataType: eventsourceprocessor.DataTypeString,
+			ExpectedValue:    "pending",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:             "history",
+			ActionType:       eventsourceprocessor.ActionTypeCompareAndSet,
+			DataType:         eventsourceprocessor.DataTypeArray,
+			Value:            `[]`,
+			ExpectedDataType: eventsourceprocessor.DataTypeArray,
+			ExpectedValue:    `[{"state":"new"}]`,
+		},
+	)
+
+	_, err := inputDoc.GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrCompareFailed))
+
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.CaseInsensitiveValues = true })
+	result, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	// Only the comparison ignores case; the stored value is exactly as set
+	that.JSONEq(`{"status":"Shipped","history":[]}`, string(result))
+}
+
+func TestCompareAndSetRoot(t *testing.T) {
+	that := assert.New(t)
+	rootCompareAndSet := func(expectedDataType eventsourceprocessor.DataType, expected string) eventsourceprocessor.EventInstruction {
+		return eventsourceprocessor.EventInstruction{
+			Path:             "",
+			ActionType:       eventsourceprocessor.ActionTypeCompareAndSet,
+			DataType:         eventsourceprocessor.DataTypeMap,
+			Value:            `{"a":1}`,
+			ExpectedDataType: expectedDataType,
+			ExpectedValue:    expected,
+		}
+	}
+
+	result, err := inlineDocument(`{}`, rootCompareAndSet(eventsourceprocessor.DataTypeMap, `{}`)).GetCurrentState()
+	if that.NoError(err) {
+		that.JSONEq(`{"a":1}`, string(result))
+	}
+
+	// A non-empty document is replaced only if AllowReplaceNonEmptyBase is set, as for SetOrAdd
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.AllowReplaceNonEmptyBase = true })
+	result, err = inlineDocument(`"old"`, rootCompareAndSet(eventsourceprocessor.DataTypeString, "old")).GetCurrentState()
+	if that.NoError(err) {
+		that.JSONEq(`{"a":1}`, string(result))
+	}
+}
+
+func TestCompareAndSetRootMismatch_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{
+		Path:             "",
+		ActionType:       eventsourceprocessor.ActionTypeCompareAndSet,
+		DataType:         eventsourceprocessor.DataTypeMap,
+		Value:            `{"a":1}`,
+		ExpectedDataType: eventsourceprocessor.DataTypeString,
+		ExpectedValue:    "nope",
+	})
+
+	_, err := inputDoc.GetCurrentState()
+
+	that.True(errors.Is(err, eventsourceprocessor.ErrCompareFailed))
+	that.ErrorContains(err, "the document does not hold the expected string value")
+}
@@ -0,0 +1,70 @@
+package eventsourceprocessor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cancelAfterChecks is a context which is cancelled once its error has been checked a number of times, so a test can
+// cancel part way through an apply.
+type cancelAfterChecks struct {
+	context.Context
+	checks int
+}
+
+func (ctx *cancelAfterChecks) Err() error {
+	ctx.checks--
+	if ctx.checks < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestGetCurrentStateContextCancelledMidApply(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, scalarSet("a", "b"))
+	for ts := uint64(1); ts <= 100; ts++ {
+		inputDoc.Events = append(inputDoc.Events, setEvent(ts, "a", "b"))
+	}
+	ctx := &cancelAfterChecks{Context: context.Background(), checks: 10}
+
+	result, err := inputDoc.GetCurrentStateContext(ctx)
+
+	that.ErrorIs(err, context.Canceled)
+	that.Nil(result)
+	that.Less(ctx.checks, 0)
+}
+
+func TestGetCurrentStateContextCancelled(t *testing.T) {
+	that := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := recentActivityDocument().GetCurrentStateContext(ctx)
+
+	that.ErrorIs(err, context.Canceled)
+}
+
+func TestGetCurrentStateContextDeadline(t *testing.T) {
+	that := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	_, err := inlineDocument(`{"a":{"b":[1,2]}}`).GetCurrentStateContext(ctx)
+
+	that.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestGetCurrentStateContextNotCancelled(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := recentActivityDocument()
+
+	expected, err := inputDoc.GetCurrentState()
+	that.NoError(err)
+	result, err := inputDoc.GetCurrentStateContext(context.Background())
+
+	that.NoError(err)
+	that.JSONEq(string(expected), string(result))
+}
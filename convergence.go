@@ -0,0 +1,39 @@
+package eventsourceprocessor
+
+import "sort"
+
+// IsConvergent reports whether the document's events produce the same state when applied in slice order, and when
+// applied in timestamp order. A false result means the stream is sensitive to the order events are applied in.
+// Set Configuration.TreatArraysAsSets to ignore the order of array elements when comparing the two states.
+//
+//	Events with identical timestamps keep their slice order. If the events fail in slice order the error is
+//	returned; if they only fail in timestamp order, the stream is simply not convergent.
+func (doc Document) IsConvergent() (bool, error) {
+	return doc.isConvergent(currentSettings())
+}
+
+// IsConvergent works like Document.IsConvergent, using the processor's configuration.
+func (processor *Processor) IsConvergent(doc Document) (bool, error) {
+	return doc.isConvergent(processor.config)
+}
+
+// isConvergent does the work of IsConvergent, with the supplied settings.
+func (doc Document) isConvergent(config *settings) (bool, error) {
+	sliceOrderState, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return false, err
+	}
+
+	timestampOrdered := doc
+	timestampOrdered.Events = make([]DocumentEvent, len(doc.Events))
+	copy(timestampOrdered.Events, doc.Events)
+	sort.SliceStable(timestampOrdered.Events, func(i, j int) bool {
+		return timestampOrdered.Events[i].Timestamp < timestampOrdered.Events[j].Timestamp
+	})
+	timestampOrderState, err := timestampOrdered.currentStateMap(config, nil)
+	if err != nil {
+		return false, nil
+	}
+
+	return sliceOrderState.equal(config, timestampOrderState), nil
+}
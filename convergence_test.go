@@ -0,0 +1,183 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func setEvent(timestamp uint64, path string, value string) eventsourceprocessor.DocumentEvent {
+	return eventsourceprocessor.DocumentEvent{
+		Timestamp: timestamp,
+		Instructions: []eventsourceprocessor.EventInstruction{{
+			Path:       path,
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      value,
+		}},
+	}
+}
+
+func TestIsConvergentIndependentEvents(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			setEvent(2, "status", "shipped"),
+			setEvent(1, "owner", "someone"),
+		},
+	}
+	convergent, err := inputDoc.IsConvergent()
+
+	that.Nil(err)
+	that.True(convergent)
+}
+
+func TestIsConvergentOrderSensitiveEvents(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			setEvent(2, "status", "shipped"),
+			setEvent(1, "status", "pending"),
+		},
+	}
+	convergent, err := inputDoc.IsConvergent()
+
+	that.Nil(err)
+	that.False(convergent)
+	// The caller's events are left in slice order
+	that.Equal(uint64(2), inputDoc.Events[0].Timestamp)
+}
+
+func appendEvent(timestamp uint64, path string, value string) eventsourceprocessor.DocumentEvent {
+	event := setEvent(timestamp, path, value)
+	event.Instructions[0].Path = path + "[new]"
+	return event
+}
+
+func TestIsConvergentArraysAsSets(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{"tags":[]}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			appendEvent(2, "tags", "second"),
+			appendEvent(1, "tags", "first"),
+		},
+	}
+
+	// The appends land in a different order...
+	convergent, err := inputDoc.IsConvergent()
+	that.Nil(err)
+	that.False(convergent)
+
+	// ...which doesn't matter if the array is a set
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.TreatArraysAsSets = true
+	})
+	convergent, err = inputDoc.IsConvergent()
+	that.Nil(err)
+	that.True(convergent)
+}
+
+func TestIsConvergentArraysAsSetsValues(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.TreatArraysAsSets = true
+	})
+	for _, test := range []struct {
+		first, second string
+		convergent    bool
+	}{
+		{"[1,2]", "[2,1]", true},
+		{"[1,2]", "[2,2]", false},
+		{"[1,2]", "[1,2,2]", false},
+	} {
+		inputDoc := eventsourceprocessor.Document{
+			BaseDocument: []byte(`{}`),
+			Events: []eventsourceprocessor.DocumentEvent{
+				setEvent(2, "tags", test.first),
+				setEvent(1, "tags", test.second),
+			},
+		}
+		for i := range inputDoc.Events {
+			inputDoc.Events[i].Instructions[0].DataType = eventsourceprocessor.DataTypeArray
+		}
+		convergent, err := inputDoc.IsConvergent()
+
+		that.Nil(err)
+		that.Equal(test.convergent, convergent, "%s vs %s", test.first, test.second)
+	}
+}
+
+func numberEvent(timestamp uint64, path string, value string) eventsourceprocessor.DocumentEvent {
+	event := setEvent(timestamp, path, value)
+	event.Instructions[0].DataType = eventsourceprocessor.DataTypeNumber
+	return event
+}
+
+func TestIsConvergentWithinFloatEpsilon(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.FloatEpsilon = 0.000001 })
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			numberEvent(2, "total", "1.0000001"),
+			numberEvent(1, "total", "1.0"),
+		},
+	}
+	convergent, err := inputDoc.IsConvergent()
+
+	that.Nil(err)
+	that.True(convergent)
+}
+
+func TestIsConvergentBeyondFloatEpsilon(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.FloatEpsilon = 0.00000001 })
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			numberEvent(2, "total", "1.0000001"),
+			numberEvent(1, "total", "1.0"),
+		},
+	}
+	convergent, err := inputDoc.IsConvergent()
+
+	that.Nil(err)
+	that.False(convergent)
+}
+
+func TestIsConvergentExactNumbersWithoutEpsilon(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			numberEvent(2, "total", "1.0000001"),
+			numberEvent(1, "total", "1.0"),
+			numberEvent(3, "other", "1.0"),
+			numberEvent(4, "other", "1"),
+		},
+	}
+	convergent, err := inputDoc.IsConvergent()
+
+	that.Nil(err)
+	that.False(convergent)
+}
+
+func TestIsConvergentAtFloatEpsilon(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.FloatEpsilon = 0.25 })
+	inputDoc := eventsourceprocessor.Document{
+		BaseDocument: []byte(`{}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			numberEvent(2, "total", "1.5"),
+			numberEvent(1, "total", "1.25"),
+		},
+	}
+	convergent, err := inputDoc.IsConvergent()
+
+	that.Nil(err)
+	that.True(convergent)
+}
@@ -0,0 +1,96 @@
+package eventsourceprocessor
+
+// documentDelta holds the differences between two document maps, keyed by dotted path.
+type documentDelta struct {
+	added   *documentMap
+	changed *documentMap
+	removed *documentMap
+}
+
+func newDocumentDelta() documentDelta {
+	return documentDelta{
+		added:   &documentMap{Elements: make(map[string]*documentElement)},
+		changed: &documentMap{Elements: make(map[string]*documentElement)},
+		removed: &documentMap{Elements: make(map[string]*documentElement)},
+	}
+}
+
+// GetDelta applies the events, and returns only the net changes they made to the base document, as a JSON object:
+//
+//	{"added": {"path": value, ...}, "changed": {"path": newValue, ...}, "removed": {"path": null, ...}}
+//
+// Paths are dotted, as for instructions. Objects are compared property by property, but arrays are compared whole -
+// so a change anywhere in an array reports the entire new array. If either document is a root array, the document
+// itself is reported as changed, with an empty path; likewise if either is a scalar.
+func (doc Document) GetDelta() ([]byte, error) {
+	return doc.getDelta(currentSettings())
+}
+
+// GetDelta works like Document.GetDelta, using the processor's configuration.
+func (processor *Processor) GetDelta(doc Document) ([]byte, error) {
+	return doc.getDelta(processor.config)
+}
+
+// getDelta does the work of GetDelta, with the supplied settings.
+func (doc Document) getDelta(config *settings) ([]byte, error) {
+	baseMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, err
+	}
+	currentMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := newDocumentDelta()
+	walk := diffWalk{
+		wholeArrays: true,
+		propertyPath: func(path, key string) (string, error) {
+			return joinPath(path, key), nil
+		},
+		set: func(path string, before, after *documentElement) error {
+			if before == nil {
+				delta.added.Elements[path] = after
+			} else {
+				delta.changed.Elements[path] = after
+			}
+			return nil
+		},
+		remove: func(path string) error {
+			delta.removed.Elements[path] = &documentElement{ElementType: DataTypeNull}
+			return nil
+		},
+	}
+	// Nothing here can fail
+	_ = walk.elements(config, "", rootElement(baseMap), rootElement(currentMap))
+
+	return delta.toMap().buildResult(config)
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// rootElement wraps a whole document as a single element.
+func rootElement(docMap *documentMap) *documentElement {
+	if docMap.IsArray {
+		return docMap.Elements["array"]
+	}
+	if docMap.IsScalar {
+		return docMap.Elements["value"]
+	}
+	return &documentElement{ElementType: DataTypeMap, Content: docMap}
+}
+
+func (delta documentDelta) toMap() *documentMap {
+	return &documentMap{
+		Elements: map[string]*documentElement{
+			"added":   {Name: "added", ElementType: DataTypeMap, Content: delta.added},
+			"changed": {Name: "changed", ElementType: DataTypeMap, Content: delta.changed},
+			"removed": {Name: "removed", ElementType: DataTypeMap, Content: delta.removed},
+		},
+	}
+}
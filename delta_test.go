@@ -0,0 +1,78 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDelta(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"name":"someone","status":"pending","address":{"city":"Leeds","zip":"LS1"},"tags":["a"],"notes":"old"}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "status",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "shipped",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "address.city",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "York",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "address.country",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "UK",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "tags[new]",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "b",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "notes",
+			ActionType: eventsourceprocessor.ActionTypeRemove,
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "name",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "someone",
+		},
+	)
+	delta, err := inputDoc.GetDelta()
+
+	that.Nil(err)
+	that.JSONEq(`{
+		"added": {"address.country": "UK"},
+		"changed": {"status": "shipped", "address.city": "York", "tags": ["a", "b"]},
+		"removed": {"notes": null}
+	}`, string(delta))
+}
+
+func TestGetDeltaNoChanges(t *testing.T) {
+	that := assert.New(t)
+	delta, err := inlineDocument(`{"name":"someone"}`).GetDelta()
+
+	that.Nil(err)
+	that.JSONEq(`{"added":{},"changed":{},"removed":{}}`, string(delta))
+}
+
+func TestGetDeltaRootArray(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`[1]`, eventsourceprocessor.EventInstruction{
+		Path:       "[new]",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeNumber,
+		Value:      "2",
+	})
+	delta, err := inputDoc.GetDelta()
+
+	that.Nil(err)
+	that.JSONEq(`{"added":{},"changed":{"":[1,2]},"removed":{}}`, string(delta))
+}
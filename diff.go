@@ -0,0 +1,197 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diff works out the instructions which turn the before document into the after document: applied to before, e.g. as
+// a Document's single event, they give after. Objects are compared property by property, and arrays element by
+// element, so only what changed is set; a property missing from after is removed, and an array which got shorter
+// loses elements from the end. Values are compared exactly, regardless of FloatEpsilon, CaseInsensitiveValues and
+// TreatArraysAsSets.
+//
+//	Empty property names, and those containing `.` or the array delimiters, can't be expressed as paths, so are an
+//	error; and unless Configuration.CaseSensitivePaths is set, a new property whose name differs only in case from an
+//	existing one would overwrite it when applied. A document which changes shape (e.g. from an object to an array, or to or from a bare
+//	scalar) can only be expressed if before is empty, as the whole document is then replaced - or if
+//	Configuration.AllowReplaceNonEmptyBase is set.
+func Diff(before, after []byte) ([]EventInstruction, error) {
+	return diff(currentSettings(), before, after)
+}
+
+// Diff works like the package-level Diff, using the processor's configuration.
+func (processor *Processor) Diff(before, after []byte) ([]EventInstruction, error) {
+	return diff(processor.config, before, after)
+}
+
+// diff does the work of Diff, with the supplied settings.
+func diff(config *settings, before, after []byte) ([]EventInstruction, error) {
+	beforeMap, err := makeBaseMap(config, before)
+	if err != nil {
+		return nil, fmt.Errorf("invalid before document: %w", err)
+	}
+	afterMap, err := makeBaseMap(config, after)
+	if err != nil {
+		return nil, fmt.Errorf("invalid after document: %w", err)
+	}
+
+	return diffDocuments(config, beforeMap, afterMap)
+}
+
+// diffDocuments works out the instructions which turn one document map into another.
+func diffDocuments(config *settings, beforeMap, afterMap *documentMap) ([]EventInstruction, error) {
+	// Replaying the instructions must give exactly the after document, so a difference the lenient comparisons would
+	// overlook (e.g. within FloatEpsilon) still counts
+	config = config.withExactValues()
+	var instructions []EventInstruction
+	beforeRoot, afterRoot := rootElement(beforeMap), rootElement(afterMap)
+	if beforeMap.IsScalar || afterMap.IsScalar || beforeMap.IsArray != afterMap.IsArray {
+		if beforeRoot.equal(config, afterRoot) {
+			return nil, nil
+		}
+		if !beforeMap.isEmpty() && !config.AllowReplaceNonEmptyBase {
+			return nil, fmt.Errorf("the document changes shape, from %s to %s, which can't be expressed as instructions", beforeRoot.ElementType, afterRoot.ElementType)
+		}
+	}
+
+	walk := diffWalk{
+		propertyPath: func(path, key string) (string, error) {
+			return diffPropertyPath(config, path, key)
+		},
+		set: func(path string, _, after *documentElement) error {
+			return diffValue(config, path, after, &instructions)
+		},
+		remove: func(path string) error {
+			instructions = append(instructions, EventInstruction{Path: path, ActionType: ActionTypeRemove})
+			return nil
+		},
+	}
+	err := walk.elements(config, "", beforeRoot, afterRoot)
+	return instructions, err
+}
+
+// diffWalk compares two documents, calling set and remove for each difference it finds. Diff and GetDelta both walk
+// the documents with it, each recording the differences in its own way.
+type diffWalk struct {
+	// wholeArrays compares arrays as single values, rather than element by element
+	wholeArrays bool
+	// propertyPath gives the path to the property key of the object at path
+	propertyPath func(path, key string) (string, error)
+	// set is called for an element which is new (before is nil) or has a different value in the after document
+	set func(path string, before, after *documentElement) error
+	// remove is called for an element which is missing from the after document. An array which got shorter loses
+	// elements from the end, so each of those is removed as `[last]`.
+	remove func(path string) error
+}
+
+// elements walks the element at path, from before to after.
+func (walk diffWalk) elements(config *settings, path string, before, after *documentElement) error {
+	switch {
+	case before.ElementType == DataTypeMap && after.ElementType == DataTypeMap && before.Content != nil && after.Content != nil:
+		return walk.objects(config, path, before.Content, after.Content)
+	case before.ElementType == DataTypeArray && after.ElementType == DataTypeArray && !walk.wholeArrays:
+		return walk.arrays(config, path, before.ArrayContent, after.ArrayContent)
+	case !before.equal(config, after):
+		return walk.set(path, before, after)
+	}
+	return nil
+}
+
+// objects walks the properties of an object, in name order so the same documents are always walked the same way.
+// Removals come first: with case-insensitive paths, removing `Foo` after setting `foo` would remove the new property.
+func (walk diffWalk) objects(config *settings, path string, before, after *documentMap) error {
+	var removed []string
+	for key := range before.Elements {
+		if _, found := after.Elements[key]; !found {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		propertyPath, err := walk.propertyPath(path, key)
+		if err == nil {
+			err = walk.remove(propertyPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(after.Elements))
+	for key := range after.Elements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		propertyPath, err := walk.propertyPath(path, key)
+		if err != nil {
+			return err
+		}
+		beforeElem, found := before.Elements[key]
+		if !found {
+			err = walk.set(propertyPath, nil, after.Elements[key])
+		} else {
+			err = walk.elements(config, propertyPath, beforeElem, after.Elements[key])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// arrays walks the elements of an array. Elements both arrays have are compared in turn; extra elements are set at
+// the next free index, or removed from the end with [last].
+func (walk diffWalk) arrays(config *settings, path string, before, after []*documentElement) error {
+	elementPath := func(i int) string {
+		return path + config.arrayOpen() + strconv.Itoa(i) + config.arrayClose()
+	}
+	for i, afterElem := range after {
+		var err error
+		if i < len(before) {
+			err = walk.elements(config, elementPath(i), before[i], afterElem)
+		} else {
+			err = walk.set(elementPath(i), nil, afterElem)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(before) - 1; i >= len(after); i-- {
+		err := walk.remove(path + config.arrayOpen() + "last" + config.arrayClose())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffValue appends a SetOrAdd instruction which sets path to the value of elem.
+func diffValue(config *settings, path string, elem *documentElement, instructions *[]EventInstruction) error {
+	instruction := EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd, DataType: elem.ElementType, Value: elem.Value}
+	if elem.ElementType == DataTypeMap || elem.ElementType == DataTypeArray {
+		value, err := buildArray(config, []*documentElement{elem})
+		if err != nil {
+			return err
+		}
+		instruction.Value = value
+	}
+	*instructions = append(*instructions, instruction)
+	return nil
+}
+
+// diffPropertyPath gives the path to a property of the object at path, checking it can be expressed.
+func diffPropertyPath(config *settings, path string, key string) (string, error) {
+	propertyPath := joinPath(path, key)
+	if key == "" || key == parentSegment || strings.ContainsAny(key, "."+config.arrayOpen()+config.arrayClose()) || strings.HasPrefix(propertyPath, "/") {
+		return "", fmt.Errorf("property `%s` can't be expressed as a path", key)
+	}
+	if err := validatePath(config, key); err != nil {
+		return "", err
+	}
+	return propertyPath, nil
+}
@@ -0,0 +1,102 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+// applyDiff diffs before and after, then applies the instructions to before.
+func applyDiff(t *testing.T, before, after string) ([]eventsourceprocessor.EventInstruction, []byte) {
+	instructions, err := eventsourceprocessor.Diff([]byte(before), []byte(after))
+	assert.Nil(t, err)
+	result, err := inlineDocument(before, instructions...).GetCurrentState()
+	assert.Nil(t, err)
+	return instructions, result
+}
+
+func TestDiff(t *testing.T) {
+	that := assert.New(t)
+	before := `{"name":"order","status":"new","old":true,"customer":{"name":"someone","email":"a@example.com"},"lines":[{"sku":"A","qty":1},{"sku":"B","qty":1}],"tags":["x","y","z"]}`
+	after := `{"name":"order","status":"paid","added":{"nested":[1,2]},"customer":{"name":"someone"},"lines":[{"sku":"A","qty":3},{"sku":"B","qty":1},{"sku":"C"}],"tags":["x"]}`
+
+	instructions, result := applyDiff(t, before, after)
+
+	that.JSONEq(after, string(result))
+	that.Equal([]eventsourceprocessor.EventInstruction{
+		{Path: "old", ActionType: eventsourceprocessor.ActionTypeRemove},
+		{Path: "added", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"nested":[1,2]}`},
+		{Path: "customer.email", ActionType: eventsourceprocessor.ActionTypeRemove},
+		{Path: "lines[0].qty", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "3"},
+		{Path: "lines[2]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"sku":"C"}`},
+		{Path: "status", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "paid"},
+		{Path: "tags[last]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		{Path: "tags[last]", ActionType: eventsourceprocessor.ActionTypeRemove},
+	}, instructions)
+}
+
+func TestDiffScalarsAndTypeChanges(t *testing.T) {
+	that := assert.New(t)
+	before := `{"a":1,"b":"text","c":{"d":1},"e":[1],"f":null,"g":1.50}`
+	after := `{"a":"1","b":null,"c":[1],"e":{"d":1},"f":false,"g":1.5}`
+
+	instructions, result := applyDiff(t, before, after)
+
+	that.JSONEq(after, string(result))
+	that.Len(instructions, 5) // 1.50 and 1.5 are the same number
+}
+
+func TestDiffRootArrays(t *testing.T) {
+	that := assert.New(t)
+	_, result := applyDiff(t, `[1,{"a":1},3]`, `[2,{"a":2}]`)
+	that.JSONEq(`[2,{"a":2}]`, string(result))
+
+	// An empty document can be replaced by any shape
+	_, result = applyDiff(t, `{}`, `[1,2]`)
+	that.JSONEq(`[1,2]`, string(result))
+	_, result = applyDiff(t, `[]`, `"text"`)
+	that.JSONEq(`"text"`, string(result))
+}
+
+func TestDiffCaseOnlyRename(t *testing.T) {
+	that := assert.New(t)
+	_, result := applyDiff(t, `{"Foo":1}`, `{"foo":1}`)
+	that.JSONEq(`{"foo":1}`, string(result))
+
+	_, result = applyDiff(t, `{"a":{"Name":{"x":1}}}`, `{"a":{"name":{"x":2}}}`)
+	that.JSONEq(`{"a":{"name":{"x":2}}}`, string(result))
+}
+
+func TestDiffIgnoresLenientComparisons(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.FloatEpsilon = 0.01
+		c.CaseInsensitiveValues = true
+		c.TreatArraysAsSets = true
+	})
+	before, after := `{"price":1.000,"name":"widget","tags":["a","b"]}`, `{"price":1.001,"name":"Widget","tags":["b","a"]}`
+
+	instructions, result := applyDiff(t, before, after)
+
+	that.Len(instructions, 4)
+	that.JSONEq(after, string(result))
+}
+
+func TestDiffIdentical(t *testing.T) {
+	that := assert.New(t)
+	instructions, err := eventsourceprocessor.Diff([]byte(`{"a":[1,{"b":2}]}`), []byte(`{"a":[1,{"b":2}]}`))
+	that.Nil(err)
+	that.Empty(instructions)
+}
+
+func TestDiffInexpressible_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.Diff([]byte(`{}`), []byte(`{"a.b":1}`))
+	that.ErrorContains(err, "property `a.b` can't be expressed as a path")
+	_, err = eventsourceprocessor.Diff([]byte(`{}`), []byte(`{"":1}`))
+	that.ErrorContains(err, "property `` can't be expressed as a path")
+
+	_, err = eventsourceprocessor.Diff([]byte(`{"a":1}`), []byte(`[1]`))
+	that.ErrorContains(err, "the document changes shape, from map to array")
+}
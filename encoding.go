@@ -0,0 +1,73 @@
+package eventsourceprocessor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDecodedValueSize is the largest a gzip+base64 value may decompress to, unless
+// Configuration.MaxDecodedValueSize says otherwise.
+const DefaultMaxDecodedValueSize = 64 << 20
+
+// decodeValue returns a copy of the instruction, with its Value decoded according to its ValueEncoding. Decompression
+// stops at the configured size limit, so a small value can't expand to fill memory.
+func (instruction EventInstruction) decodeValue(config *settings) (EventInstruction, error) {
+	switch instruction.ValueEncoding {
+	case "", ValueEncodingNone:
+		return instruction, nil
+	case ValueEncodingGzipBase64:
+		compressed, err := base64.StdEncoding.DecodeString(instruction.Value)
+		if err != nil {
+			return instruction, fmt.Errorf("corrupt %s value, base64 decoding failed: %w", instruction.ValueEncoding, err)
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return instruction, fmt.Errorf("corrupt %s value, gzip decoding failed: %w", instruction.ValueEncoding, err)
+		}
+		limit := config.MaxDecodedValueSize
+		if limit == 0 {
+			limit = DefaultMaxDecodedValueSize
+		}
+		var decompressed io.Reader = reader
+		if limit > 0 {
+			// Read one byte more than allowed, to tell a value which is exactly the limit from one which is over it
+			decompressed = io.LimitReader(reader, limit+1)
+		}
+		value, err := io.ReadAll(decompressed)
+		if err != nil {
+			return instruction, fmt.Errorf("corrupt %s value, gzip decoding failed: %w", instruction.ValueEncoding, err)
+		}
+		if limit > 0 && int64(len(value)) > limit {
+			return instruction, fmt.Errorf("%w: %s value decompresses to more than %d bytes (MaxDecodedValueSize)", ErrValueTooLarge, instruction.ValueEncoding, limit)
+		}
+		instruction.Value = string(value)
+		instruction.ValueEncoding = ""
+		return instruction, nil
+	}
+	return instruction, fmt.Errorf("unsupported value encoding `%s`", instruction.ValueEncoding)
+}
+
+// inferDataType works out the data type of an instruction value which doesn't have one: JSON numbers, booleans and null
+// are taken at face value, anything starting with `{` or `[` is a map or array, and everything else is a string.
+func inferDataType(value string) DataType {
+	switch {
+	case value == "true" || value == "false":
+		return DataTypeBool
+	case value == "null":
+		return DataTypeNull
+	case strings.HasPrefix(value, "{"):
+		return DataTypeMap
+	case strings.HasPrefix(value, "["):
+		return DataTypeArray
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+		return DataTypeNumber
+	}
+	return DataTypeString
+}
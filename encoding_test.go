@@ -0,0 +1,152 @@
+package eventsourceprocessor_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipBase64EncodedMapValue(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGzipBase64EncodedMapValue", "base.json", nil)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{{
+		Instructions: []eventsourceprocessor.EventInstruction{{
+			Path:          "objectField.compressed",
+			ActionType:    eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:      eventsourceprocessor.DataTypeMap,
+			Value:         gzipBase64(`{"compressedField":"This arrived compressed","compressedNumber":99}`),
+			ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64,
+		}},
+	}}
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrintObject("Input Document", inputDoc)
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"compressedField":"This arrived compressed"`)
+	that.Contains(string(outputDoc), `"compressedNumber":99`)
+}
+
+func TestCorruptEncodedValue_Fails(t *testing.T) {
+	that := assert.New(t)
+	for _, value := range []string{"!!! not base64 !!!", base64.StdEncoding.EncodeToString([]byte("not gzip"))} {
+		inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{
+			Path:          "field",
+			ActionType:    eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:      eventsourceprocessor.DataTypeString,
+			Value:         value,
+			ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64,
+		})
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err) {
+			that.Contains(err.Error(), "corrupt gzip+base64 value")
+		}
+	}
+}
+
+func TestEncodedValueTooLarge_Fails(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.MaxDecodedValueSize = 12
+	})
+	encoded := func(value string) eventsourceprocessor.Document {
+		return inlineDocument(`{}`, eventsourceprocessor.EventInstruction{
+			Path:          "field",
+			ActionType:    eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:      eventsourceprocessor.DataTypeString,
+			Value:         gzipBase64(value),
+			ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64,
+		})
+	}
+
+	// Exactly the limit is fine; a byte more isn't
+	result, err := encoded("twelve bytes").GetCurrentState()
+	that.Nil(err)
+	that.JSONEq(`{"field":"twelve bytes"}`, string(result))
+	_, err = encoded("thirteen byte").GetCurrentState()
+	that.ErrorIs(err, eventsourceprocessor.ErrValueTooLarge)
+}
+
+func TestUnsupportedValueEncoding_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{
+		Path:          "field",
+		ActionType:    eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:      eventsourceprocessor.DataTypeString,
+		Value:         "value",
+		ValueEncoding: "rot13",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	that.NotNil(err)
+}
+
+// gzipBase64 encodes a value the way an event store would, for ValueEncodingGzipBase64
+func gzipBase64(value string) string {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(value))
+	writer.Close()
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+func TestInferDataType(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.InferDataType = true })
+	values := map[string]string{
+		"count":    "42",
+		"ratio":    "-1.5e3",
+		"active":   "true",
+		"deleted":  "false",
+		"owner":    "null",
+		"address":  `{"city":"Leeds"}`,
+		"tags":     `["a","b"]`,
+		"name":     "someone",
+		"notANum":  "NaN",
+		"zipCode":  "01234",
+		"sentence": "true story",
+	}
+	var instructions []eventsourceprocessor.EventInstruction
+	for path, value := range values {
+		instructions = append(instructions, eventsourceprocessor.EventInstruction{
+			Path:       path,
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			Value:      value,
+		})
+	}
+	result, err := inlineDocument(`{}`, instructions...).GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{
+		"count": 42,
+		"ratio": -1500,
+		"active": true,
+		"deleted": false,
+		"owner": null,
+		"address": {"city": "Leeds"},
+		"tags": ["a", "b"],
+		"name": "someone",
+		"notANum": "NaN",
+		"zipCode": "01234",
+		"sentence": "true story"
+	}`, string(result))
+}
+
+func TestInferDataTypeDisabled(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{
+		Path:       "count",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		Value:      "42",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	// Without inference, an instruction with no data type produces nothing which can be output
+	that.NotNil(err)
+}
@@ -0,0 +1,128 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// EqualJSON reports whether two JSON documents hold the same content. Object keys may be in any order, and numbers are
+// compared numerically (so `1` equals `1.0`); otherwise the comparison follows the configuration, e.g.
+// TreatArraysAsSets, FloatEpsilon and CaseInsensitiveValues.
+func EqualJSON(a, b []byte) (bool, error) {
+	return equalJSON(currentSettings(), a, b)
+}
+
+// EqualJSON works like the package-level EqualJSON, using the processor's configuration.
+func (processor *Processor) EqualJSON(a, b []byte) (bool, error) {
+	return equalJSON(processor.config, a, b)
+}
+
+// equalJSON does the work of EqualJSON, with the supplied settings.
+func equalJSON(config *settings, a, b []byte) (bool, error) {
+	aMap, err := makeMap(config, a)
+	if err != nil {
+		return false, fmt.Errorf("invalid first document: %w", err)
+	}
+	bMap, err := makeMap(config, b)
+	if err != nil {
+		return false, fmt.Errorf("invalid second document: %w", err)
+	}
+	return aMap.equal(config, bMap), nil
+}
+
+// equal reports whether two documents hold the same content. Key order is irrelevant, as is array order if
+// Configuration.TreatArraysAsSets is set.
+func (docMap *documentMap) equal(config *settings, other *documentMap) bool {
+	if docMap.IsArray != other.IsArray || docMap.IsScalar != other.IsScalar || len(docMap.Elements) != len(other.Elements) {
+		return false
+	}
+	for key, elem := range docMap.Elements {
+		otherElem, found := other.Elements[key]
+		if !found || !elem.equal(config, otherElem) {
+			return false
+		}
+	}
+	return true
+}
+
+// equal reports whether two document elements hold the same value; names are not compared. String values ignore case
+// if Configuration.CaseInsensitiveValues is set.
+func (elem *documentElement) equal(config *settings, other *documentElement) bool {
+	if elem.ElementType != other.ElementType {
+		return false
+	}
+	switch elem.ElementType {
+	case DataTypeMap:
+		return elem.Content.equal(config, other.Content)
+	case DataTypeArray:
+		if config.TreatArraysAsSets {
+			return sameElementsAnyOrder(config, elem.ArrayContent, other.ArrayContent)
+		}
+		return sameElementsInOrder(config, elem.ArrayContent, other.ArrayContent)
+	case DataTypeNumber:
+		return numbersEqual(config, elem.Value, other.Value)
+	case DataTypeNull:
+		return true
+	case DataTypeString:
+		if config.CaseInsensitiveValues {
+			return strings.EqualFold(elem.Value, other.Value)
+		}
+	}
+	return elem.Value == other.Value
+}
+
+func sameElementsInOrder(config *settings, a, b []*documentElement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(config, b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameElementsAnyOrder checks each element of a has its own equal element in b.
+func sameElementsAnyOrder(config *settings, a, b []*documentElement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	matched := make([]bool, len(b))
+	for _, aElem := range a {
+		found := false
+		for i, bElem := range b {
+			if !matched[i] && aElem.equal(config, bElem) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// numbersEqual compares two numeric values numerically, so e.g. `1` equals `1.0`. If Configuration.FloatEpsilon is set,
+// numbers within that tolerance are equal; otherwise the comparison is exact, even beyond float64 precision.
+func numbersEqual(config *settings, a, b string) bool {
+	if config.FloatEpsilon == 0 {
+		aNumber, aOk := new(big.Rat).SetString(a)
+		bNumber, bOk := new(big.Rat).SetString(b)
+		if !aOk || !bOk {
+			return a == b
+		}
+		return aNumber.Cmp(bNumber) == 0
+	}
+	aNumber, aErr := strconv.ParseFloat(a, 64)
+	bNumber, bErr := strconv.ParseFloat(b, 64)
+	if aErr != nil || bErr != nil {
+		return a == b
+	}
+	return math.Abs(aNumber-bNumber) <= config.FloatEpsilon
+}
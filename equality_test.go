@@ -0,0 +1,39 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEqualJSON(t *testing.T) {
+	that := assert.New(t)
+	cases := []struct {
+		a, b  string
+		equal bool
+	}{
+		{`{"a":1,"b":{"c":true,"d":null}}`, `{"b":{"d":null,"c":true},"a":1}`, true},
+		{`{"a":1}`, `{"a":1.0}`, true},
+		{`[1,{"x":"y"}]`, `[1.0,{"x":"y"}]`, true},
+		{`{"a":[1,2]}`, `{"a":[2,1]}`, false},
+		{`{"a":1}`, `{"a":"1"}`, false},
+		{`{"a":null}`, `{}`, false},
+		{`{"a":1}`, `[{"a":1}]`, false},
+	}
+	for _, c := range cases {
+		equal, err := eventsourceprocessor.EqualJSON([]byte(c.a), []byte(c.b))
+
+		that.Nil(err)
+		that.Equal(c.equal, equal, "%s vs %s", c.a, c.b)
+	}
+}
+
+func TestEqualJSONInvalid_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.EqualJSON([]byte(`{}`), []byte(`{`))
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "invalid second document")
+	}
+}
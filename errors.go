@@ -0,0 +1,15 @@
+package eventsourceprocessor
+
+import "errors"
+
+// Errors which callers may want to tell apart, e.g. to decide whether to retry or to report bad input. They are
+// returned wrapped, with details such as the path; check for them with errors.Is. See also ErrCompareFailed.
+var (
+	ErrElementNotFound     = errors.New("element not found")                     // A path doesn't lead to an element, and the action won't create it
+	ErrEmptyArray          = errors.New("array is empty")                        // An array element was needed, but the array has none
+	ErrReplaceNonEmptyBase = errors.New("can't replace non-empty base document") // Only an empty base document, `{}` or `[]`, may be replaced
+	ErrUnsupportedArrayOp  = errors.New("unsupported array operation")           // An array indexer isn't valid for the action, or at that point in the path
+	ErrInvalidDataType     = errors.New("invalid data type")                     // An element or value isn't of a type the operation can work with
+	ErrEmptyBaseDocument   = errors.New("base document is empty")                // The base document is nil or empty, and EmptyBaseIsError is set
+	ErrValueTooLarge       = errors.New("value too large")                       // An encoded value decompresses to more than MaxDecodedValueSize
+)
@@ -0,0 +1,82 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		base        string
+		instruction eventsourceprocessor.EventInstruction
+		sentinel    error
+		detail      string
+	}{
+		{
+			name:        "element not found",
+			base:        `{"a":{}}`,
+			instruction: eventsourceprocessor.EventInstruction{Path: "a.b.c", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+			sentinel:    eventsourceprocessor.ErrElementNotFound,
+			detail:      "`b`",
+		},
+		{
+			name:        "no matching array element",
+			base:        `{"orders":[{"id":1}]}`,
+			instruction: eventsourceprocessor.EventInstruction{Path: "orders[id=2].status", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+			sentinel:    eventsourceprocessor.ErrElementNotFound,
+			detail:      "`orders`",
+		},
+		{
+			name:        "empty array",
+			base:        `{"items":[]}`,
+			instruction: eventsourceprocessor.EventInstruction{Path: "items[first].name", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+			sentinel:    eventsourceprocessor.ErrEmptyArray,
+			detail:      "`items`",
+		},
+		{
+			name:        "replace non-empty base",
+			base:        `{"a":1}`,
+			instruction: eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"b":2}`},
+			sentinel:    eventsourceprocessor.ErrReplaceNonEmptyBase,
+			detail:      "invalid instruction",
+		},
+		{
+			name:        "unsupported array operation",
+			base:        `{"items":[1]}`,
+			instruction: eventsourceprocessor.EventInstruction{Path: "items[sideways]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "2"},
+			sentinel:    eventsourceprocessor.ErrUnsupportedArrayOp,
+			detail:      "`sideways`",
+		},
+		{
+			name:        "invalid data type",
+			base:        `{}`,
+			instruction: eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: "widget", Value: "x"},
+			sentinel:    eventsourceprocessor.ErrInvalidDataType,
+			detail:      "widget",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			that := assert.New(t)
+			_, err := inlineDocument(test.base, test.instruction).GetCurrentState()
+			if that.NotNil(err) {
+				that.True(errors.Is(err, test.sentinel), "expected %q to wrap %q", err, test.sentinel)
+				that.Contains(err.Error(), test.detail)
+			}
+		})
+	}
+}
+
+func TestSentinelErrorsFromAggregates(t *testing.T) {
+	that := assert.New(t)
+	doc := eventsourceprocessor.Document{BaseDocument: []byte(`{"tags":[],"name":"x"}`)}
+
+	_, err := doc.Min("tags")
+	that.True(errors.Is(err, eventsourceprocessor.ErrEmptyArray))
+	_, err = doc.Sum("name")
+	that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+}
@@ -1,11 +1,13 @@
 package eventsourceprocessor
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"reflect"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,9 +21,10 @@ import (
 
 // Document is a snapshot + any new events which have not been applied to that snapshot.
 type Document struct {
-	EntityId     string          `json:"EntityId"`     // The ID of the document we're getting
-	BaseDocument []byte          `json:"BaseDocument"` // The base document.
-	Events       []DocumentEvent `json:"Events"`       // Array of events, in the order they were posted, to apply to the base document
+	EntityId       string          `json:"EntityId"`                 // The ID of the document we're getting
+	IdempotencyKey string          `json:"IdempotencyKey,omitempty"` // Caller-defined key, for detecting re-processing of the whole document
+	BaseDocument   []byte          `json:"BaseDocument"`             // The base document.
+	Events         []DocumentEvent `json:"Events"`                   // Array of events, in the order they were posted, to apply to the base document
 }
 
 // DocumentEvent is a single "business" event to apply to a document. It may consist of many instructions,
@@ -35,22 +38,43 @@ type DocumentEvent struct {
 // EventInstruction describes a thing to do to the master document.
 // See the README.md file in this directory for a how-it-works guide.
 type EventInstruction struct {
-	Path       string     // Path to the element in the root document.
-	ActionType ActionType // Action to take at the path supplied (e.g. addOrUpdate, append, delete)
-	DataType   DataType   // e.g. "string","float64","bool", "map", "array" or "null"
-	Value      string     // Value, must be valid for the datatype. Ignored for "null"
+	Path          string        // Path to the element in the root document.
+	ActionType    ActionType    // Action to take at the path supplied (e.g. addOrUpdate, append, delete)
+	DataType      DataType      // e.g. "string","float64","bool", "map", "array" or "null"
+	Value         string        // Value, must be valid for the datatype. Ignored for "null"
+	ValueEncoding ValueEncoding `json:",omitempty"` // How Value is encoded, e.g. "gzip+base64". Empty = not encoded
+
+	ExpectedDataType DataType `json:",omitempty"` // CompareAndSet only: data type of ExpectedValue
+	ExpectedValue    string   `json:",omitempty"` // CompareAndSet only: the value the element must currently hold
 }
 
 // Action types
 type ActionType string
 
 const (
-	ActionTypeSetOrAdd ActionType = "SetOrAdd" // Add value, or set (overwrite) it if value is already present
-	ActionTypeAddOnly  ActionType = "AddOnly"  // Add the value. Do NOT overwrite it if the value is already present
-	ActionTypeSetOnly  ActionType = "SetOnly"  // Update a value. Do NOT add it, if it's not already present
-	ActionTypeRemove   ActionType = "Remove"   // Remove a value. Obviously, do nothing if it's not present.
+	ActionTypeSetOrAdd  ActionType = "SetOrAdd"  // Add value, or set (overwrite) it if value is already present
+	ActionTypeAddOnly   ActionType = "AddOnly"   // Add the value. Do NOT overwrite it if the value is already present
+	ActionTypeSetOnly   ActionType = "SetOnly"   // Update a value. Do NOT add it, if it's not already present
+	ActionTypeRemove    ActionType = "Remove"    // Remove a value. Obviously, do nothing if it's not present.
+	ActionTypeReplaceAt ActionType = "ReplaceAt" // Replace the array element at a numeric index, e.g. `items[2]`. The element must exist.
+	ActionTypeNoOp      ActionType = "NoOp"      // Change nothing. For marker/annotation entries; Value may hold a note, which appears in the apply report
+
+	ActionTypeCompareAndSet ActionType = "CompareAndSet" // Update a value, but only if it currently equals ExpectedValue. Maps & arrays are compared deeply
+	ActionTypeMerge         ActionType = "Merge"         // Deep-merge a map value into the object at the path, keeping properties the value doesn't mention
+	ActionTypeIncrement     ActionType = "Increment"     // Add a numeric value to the number at the path
+	ActionTypeAppend        ActionType = "Append"        // Add the value to the end of the array at the path, as `[new]` does
+	ActionTypeInsertAt      ActionType = "InsertAt"      // Insert the value into an array at a numeric index, e.g. `items[2]`, moving later elements along
+	ActionTypeMove          ActionType = "Move"          // Move the element at the path held in Value to the path, as JSON Patch's `move`
+	ActionTypeCopy          ActionType = "Copy"          // Copy the element at the path held in Value to the path, as JSON Patch's `copy`
 )
 
+// replacesRoot reports whether an action with an empty path replaces the whole document with its value: only SetOrAdd
+// and SetOnly do. The others act on the document as it is, e.g. merging into it or incrementing it; CompareAndSet
+// checks the document first, then replaces it.
+func (actionType ActionType) replacesRoot() bool {
+	return actionType == ActionTypeSetOrAdd || actionType == ActionTypeSetOnly
+}
+
 // Data types
 type DataType string
 
@@ -64,6 +88,14 @@ const (
 	DataTypeMap    DataType = "map"
 )
 
+// Value encodings
+type ValueEncoding string
+
+const (
+	ValueEncodingNone       ValueEncoding = "none"        // Value is used as-is (as is an empty ValueEncoding)
+	ValueEncodingGzipBase64 ValueEncoding = "gzip+base64" // Value is gzipped, then base64 (standard encoding) encoded
+)
+
 type ESP interface {
 	Configure(*Configuration) Configuration
 	GetCurrentState() ([]byte, error)
@@ -71,35 +103,167 @@ type ESP interface {
 
 // Configuration flags for this package.
 type Configuration struct {
-	RemoveNonExistantElementIsError      bool // Set to TRUE if trying to remove a non-existent element should throw an error
-	RemoveNonExistantArrayElementIsError bool // Set to TRUE if trying to remove a non-existent array element should throw an error
+	RemoveNonExistantElementIsError      bool                         // Set to TRUE if trying to remove a non-existent element should throw an error
+	RemoveNonExistantArrayElementIsError bool                         // Set to TRUE if trying to remove a non-existent array element should throw an error
+	ArrayDelimiters                      ArrayDelimiters              // Runes which open & close an array indexer in a path. Zero value = `[` and `]`
+	NumberPrecision                      *int                         // If set, numbers are rounded to this many decimal places in the output. nil = full precision
+	LazyNoEventsResultIsNull             bool                         // GetCurrentStateLazy only: with no events, return `null` (TRUE) or an empty result (FALSE)
+	DeepCreateWarningLevels              int                          // Warn (in the apply report) when an instruction creates more than this many new parent objects. 0 = never warn
+	MergePatchNullSetsNull               bool                         // MergePatchToEvent: TRUE = a null in the patch sets JSON null, FALSE = it removes the member (as per RFC 7386)
+	TreatArraysAsSets                    bool                         // When comparing documents (e.g. IsConvergent), ignore the order of array elements
+	ArraySelectorMode                    ArraySelectorMode            // How [first]/[new] see arrays changed earlier in the same event. Empty = live
+	FloatEpsilon                         float64                      // Numbers within this tolerance of each other compare as equal. 0 = exact comparison
+	SkipValueErrorPaths                  []string                     // Instructions on paths matching these patterns (`*` = any text within a segment) are skipped if their value can't be parsed
+	MaxDepth                             int                          // Documents (and map/array values) nested deeper than this many levels are rejected. 0 = no limit
+	CaseInsensitiveValues                bool                         // When comparing values (e.g. CompareAndSet), strings which differ only in case are equal. Stored values are unaffected
+	Encoders                             map[DataType]DataTypeEncoder // Custom output for (custom or built-in) scalar data types, e.g. a "decimal" type. nil = built-in output only
+	SetOnlyPreservesType                 bool                         // Set to TRUE if SetOnly should error rather than change an element's data type (including to or from null)
+	MaxArrayLength                       int                          // Maximum number of elements `[new]` may grow an array to. 0 = no limit
+	ArrayOverflowMode                    ArrayOverflowMode            // What happens when `[new]` would exceed MaxArrayLength. Empty = error
+	InferDataType                        bool                         // Set to TRUE to work out the data type of instructions with no DataType from their Value
+	EscapeHTML                           bool                         // Set to TRUE to escape <, > and & in string values (as json.Marshal does), for embedding the output in HTML
+	PreserveNumberTokens                 bool                         // Set to TRUE to keep all numbers exactly as written in the base document & map/array values; by default, only integers are, and others are converted via float64
+	SkipEmptyArrayCreation               bool                         // Set to TRUE to ignore SetOrAdd of an empty array to a path which doesn't exist yet, rather than creating it
+	KeyOrder                             KeyOrder                     // The order of each object's properties in the output; `sorted` (the default) or `document`
+	ImplicitFirstSelector                bool                         // Set to TRUE to treat an array in the middle of a path without a selector (e.g. `items.field`) as `items[first].field`, rather than an error
+	CaseSensitivePaths                   bool                         // Set to TRUE to match path segments to property names exactly; by default `Foo` finds `foo`, preferring an exact match if there is one
+	MapSetMerges                         bool                         // Set to TRUE to deep-merge a map value set on an existing object, as the Merge action does, rather than replacing the object
+	IncrementNonExistantElementIsError   bool                         // Set to TRUE if incrementing a non-existent (or null) element should throw an error, rather than counting from zero
+	AllowReplaceNonEmptyBase             bool                         // Set to TRUE to let a map or array instruction with an empty path replace the whole document, even if it isn't empty
+	EmptyBaseIsError                     bool                         // Set to TRUE to fail on a nil or empty base document, rather than treating it as `{}`
+	ValidateBeforeApply                  bool                         // Set to TRUE to Validate every instruction before applying any, so a malformed one fails before the document is touched
+	Atomic                               bool                         // Set to TRUE to apply events all-or-nothing: if any instruction fails, the document is returned as it was before any were applied, along with the error
+	Logger                               Logger                       // Receives diagnostic messages, e.g. why a map or array value couldn't be decoded. nil = no logging
+	MaxDecodedValueSize                  int64                        // Largest a gzip+base64 value may be once decompressed, in bytes. 0 = DefaultMaxDecodedValueSize; negative = no limit
+}
+
+// Logger receives the package's diagnostic messages; a *log.Logger will do. Nothing is logged which isn't also
+// returned as an error.
+type Logger interface {
+	Printf(format string, v ...interface{})
 }
 
-// Local config defaults
-var config = Configuration{
-	RemoveNonExistantElementIsError:      true,  // Default = throw error if removing non-existent element
-	RemoveNonExistantArrayElementIsError: false, // Default = don't throw error if removing non-existent array element
+// DataTypeEncoder converts a value of a given data type, as held in an instruction, into the JSON token which
+// represents it in the output document - e.g. `1.10` or `"0x1F"`. The token is written as-is, so must be valid JSON.
+type DataTypeEncoder func(value string) (string, error)
+
+// encodeValue uses the configured encoder for the element's data type, if there is one, to build its JSON token.
+func (elem *documentElement) encodeValue(config *settings) (token string, encoded bool, err error) {
+	encoder, found := config.Encoders[elem.ElementType]
+	if !found || elem.ElementType == DataTypeMap || elem.ElementType == DataTypeArray {
+		return "", false, nil
+	}
+	token, err = encoder(elem.Value)
+	if err != nil {
+		return "", true, fmt.Errorf("unable to encode %s value `%s`: %w", elem.ElementType, elem.Value, err)
+	}
+	return token, true, nil
 }
 
-// Allow the caller to override the configuration
-func Configure(configuration *Configuration) Configuration {
-	// Change or report the configuration
-	if configuration != nil {
-		config = Configuration{
-			configuration.RemoveNonExistantElementIsError,
-			configuration.RemoveNonExistantArrayElementIsError,
+// ArraySelectorMode determines which state of an array the array selectors (e.g. `[first]`, `[new]`) are resolved against.
+type ArraySelectorMode string
+
+const (
+	ArraySelectorModeLive     ArraySelectorMode = "live"     // Selectors see each array as changed by earlier instructions in the same event
+	ArraySelectorModeSnapshot ArraySelectorMode = "snapshot" // Selectors see each array as it was at the start of the event
+)
+
+// ArrayOverflowMode determines what happens when adding an element would take an array past MaxArrayLength.
+type ArrayOverflowMode string
+
+const (
+	ArrayOverflowError      ArrayOverflowMode = "error"      // The instruction fails
+	ArrayOverflowDropOldest ArrayOverflowMode = "dropOldest" // The first element(s) are removed to make room, like a ring buffer
+)
+
+// ArrayDelimiters are the runes used to mark up an array indexer in a path, e.g. the `[` and `]` in `items[first]`.
+type ArrayDelimiters struct {
+	Open  rune
+	Close rune
+}
+
+// Default array delimiters, i.e. `items[first]`
+var defaultArrayDelimiters = ArrayDelimiters{Open: '[', Close: ']'}
+
+// A path segment which refers to the parent of the previous segment
+const parentSegment = "^"
+
+// makeArrayRegex builds the regex which finds array indexers, e.g. `[x]`, using the supplied delimiters.
+func makeArrayRegex(delimiters ArrayDelimiters) *regexp.Regexp {
+	openQuoted := regexp.QuoteMeta(string(delimiters.Open))
+	closeQuoted := regexp.QuoteMeta(string(delimiters.Close))
+	return regexp.MustCompile(fmt.Sprintf(`%s([^%s%s]*)%s`, openQuoted, openQuoted, closeQuoted, closeQuoted))
+}
+
+// makePathSegmentRegex builds the regex which matches a well-formed path segment, e.g. `name`, `name[x]` or `[x][y]`.
+func makePathSegmentRegex(delimiters ArrayDelimiters) *regexp.Regexp {
+	openQuoted := regexp.QuoteMeta(string(delimiters.Open))
+	closeQuoted := regexp.QuoteMeta(string(delimiters.Close))
+	return regexp.MustCompile(fmt.Sprintf(`^[^%s%s]*(%s[^%s%s]*%s)*$`, openQuoted, closeQuoted, openQuoted, openQuoted, closeQuoted, closeQuoted))
+}
+
+// splitPath splits a path into its segments at each `.`, other than those inside an array indexer - so the
+// conditional indexer in `items[version=1.2].name` stays in one piece.
+func splitPath(config *settings, path string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i, r := range path {
+		switch {
+		case r == config.ArrayDelimiters.Open:
+			depth++
+		case r == config.ArrayDelimiters.Close && depth > 0:
+			depth--
+		case r == '.' && depth == 0:
+			segments = append(segments, path[start:i])
+			start = i + 1
 		}
 	}
-	return config
+	return append(segments, path[start:])
 }
 
-// Package-local regex for finding array indicies in paths
-var arrayRegex = regexp.MustCompile(`\[([^\[\]]*)\]`)
+// validatePath checks that every segment of a path is a plain name, or a name followed only by array indexers.
+func validatePath(config *settings, path string) error {
+	for _, segment := range splitPath(config, path) {
+		if !config.pathSegmentRegex.MatchString(segment) {
+			return fmt.Errorf("malformed path segment `%s` in `%s`: expected a name, optionally followed by array indexers such as %sfirst%s", segment, path, config.arrayOpen(), config.arrayClose())
+		}
+	}
+	return nil
+}
+
+// resolveParentSegments removes each `^` segment from a path, along with the segment before it - so `a.b.^.c`
+// becomes `a.c`, the sibling `c` of `b`.
+func resolveParentSegments(config *settings, path string) (string, error) {
+	if !strings.Contains(path, parentSegment) {
+		return path, nil
+	}
+	var resolved []string
+	for _, segment := range splitPath(config, path) {
+		if segment != parentSegment {
+			resolved = append(resolved, segment)
+			continue
+		}
+		if len(resolved) == 0 {
+			return "", fmt.Errorf("path `%s` refers to the parent of the document root", path)
+		}
+		resolved = resolved[:len(resolved)-1]
+	}
+	return strings.Join(resolved, "."), nil
+}
+
+// indexerName strips the delimiters from an array indexer, e.g. `[First]` becomes `first`.
+func indexerName(config *settings, indexer string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSuffix(indexer, config.arrayClose()), config.arrayOpen()))
+}
 
 // documentMap is an internal structure used to hold a json object. Each element is a named property.
 type documentMap struct {
 	IsArray  bool                        `json:",omitempty"`
+	IsScalar bool                        `json:",omitempty"` // The document is a bare string, number, bool or null, held as its "value" element
 	Elements map[string]*documentElement `json:",omitempty"`
+	Order    []string                    `json:",omitempty"` // The order keys were added in, for KeyOrderDocument; see keyorder.go
+
+	parents map[string]*documentMap // Maps holding recently resolved parent paths, for the root map only; see parentcache.go
 }
 
 // documentElement can be any one of: A named property; a named array; an anonymous array; or a named sub-object.
@@ -109,182 +273,488 @@ type documentElement struct {
 	Value        string             `json:",omitempty"` // For properties
 	Content      *documentMap       `json:",omitempty"` // For sub-objects
 	ArrayContent []*documentElement `json:",omitempty"` // For arrays
+
+	snapshotLength int // Array length at the start of the current event, for snapshot mode array selectors
 }
 
 // GetCurrentState takes a source document object, containing a base document and a sequence of zero or more events.
 //
 //	It applies each event in turn to the base document, and returns the resulting final document, which will
-//	represent the current state of the object, at the point it was loaded.
+//	represent the current state of the object, at the point it was loaded. doc itself is left untouched - its
+//	base document, events and instructions - so the same Document may be processed any number of times.
 func (doc Document) GetCurrentState() ([]byte, error) {
+	return doc.GetCurrentStateContext(context.Background())
+}
+
+// GetCurrentStateContext works like GetCurrentState, but stops promptly with ctx.Err() if ctx is cancelled. The context
+// is checked between events, and at each level of the documents being read and built.
+func (doc Document) GetCurrentStateContext(ctx context.Context) ([]byte, error) {
+	return doc.currentState(currentSettings().withContext(ctx))
+}
+
+// GetCurrentStateContext works like Document.GetCurrentStateContext, using the processor's configuration.
+func (processor *Processor) GetCurrentStateContext(ctx context.Context, doc Document) ([]byte, error) {
+	return doc.currentState(processor.config.withContext(ctx))
+}
+
+// currentState does the work of GetCurrentState, with the supplied settings.
+func (doc Document) currentState(config *settings) ([]byte, error) {
+	return doc.currentStateFrom(config, func() (*documentMap, error) {
+		return makeBaseMap(config, doc.BaseDocument)
+	})
+}
+
+// currentStateFrom works like currentState, but the base document map is made by calling makeBase.
+func (doc Document) currentStateFrom(config *settings, makeBase func() (*documentMap, error)) ([]byte, error) {
 	// Map, apply, build, return...
-	docMap, err := makeMap(doc.BaseDocument)
+	docMap, err := doc.currentStateMapFrom(config, nil, makeBase)
+	if err != nil {
+		return docMap.untouchedResult(config), err
+	}
+
+	return docMap.buildResult(config)
+}
+
+// GetCurrentStateWithReport works like GetCurrentState, but also returns a report of anything noteworthy (but not
+// actually wrong) which happened while the events were applied.
+func (doc Document) GetCurrentStateWithReport() ([]byte, ApplyReport, error) {
+	return doc.currentStateWithReport(currentSettings())
+}
+
+// GetCurrentStateWithReport works like Document.GetCurrentStateWithReport, using the processor's configuration.
+func (processor *Processor) GetCurrentStateWithReport(doc Document) ([]byte, ApplyReport, error) {
+	return doc.currentStateWithReport(processor.config)
+}
+
+// currentStateWithReport does the work of GetCurrentStateWithReport, with the supplied settings.
+func (doc Document) currentStateWithReport(config *settings) ([]byte, ApplyReport, error) {
+	report := ApplyReport{}
+	docMap, err := doc.currentStateMap(config, &report)
+	if err != nil {
+		return docMap.untouchedResult(config), report, err
+	}
+
+	result, err := docMap.buildResult(config)
+	return result, report, err
+}
+
+// GetCurrentStateInto works like GetCurrentState, but unmarshals the resulting document into v (which must be a pointer,
+// as for json.Unmarshal) rather than returning it.
+func (doc Document) GetCurrentStateInto(v interface{}) error {
+	return doc.currentStateInto(currentSettings(), v)
+}
+
+// GetCurrentStateInto works like Document.GetCurrentStateInto, using the processor's configuration.
+func (processor *Processor) GetCurrentStateInto(doc Document, v interface{}) error {
+	return doc.currentStateInto(processor.config, v)
+}
+
+// currentStateInto does the work of GetCurrentStateInto, with the supplied settings.
+func (doc Document) currentStateInto(config *settings, v interface{}) error {
+	result, err := doc.currentState(config)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(result, v)
+	if err != nil {
+		return fmt.Errorf("unable to decode current state of entity %s into %T: %w", doc.EntityId, v, err)
+	}
+	return nil
+}
+
+// WriteCurrentState works like GetCurrentState, but writes the resulting document to w as it's built, rather than
+// returning it; e.g. to stream a large document straight into an HTTP response.
+//
+//	Nothing is written if the events can't be applied. If building the document fails part way, or w returns an error,
+//	some of the document may already have been written.
+func (doc Document) WriteCurrentState(w io.Writer) error {
+	return doc.writeCurrentState(currentSettings(), w)
+}
+
+// WriteCurrentState works like Document.WriteCurrentState, using the processor's configuration.
+func (processor *Processor) WriteCurrentState(doc Document, w io.Writer) error {
+	return doc.writeCurrentState(processor.config, w)
+}
+
+// writeCurrentState does the work of WriteCurrentState, with the supplied settings.
+func (doc Document) writeCurrentState(config *settings, w io.Writer) error {
+	docMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	err = docMap.writeResult(config, out)
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// AppendEvent applies a new event on top of the document's current state. It returns the new state, along with a
+// compacted copy of the document, which has the new state as its base and no events - ready to be stored.
+//
+//	If the event can't be applied, the error is returned along with the document, unchanged.
+func (doc Document) AppendEvent(event DocumentEvent) ([]byte, Document, error) {
+	return doc.appendEvent(currentSettings(), event)
+}
+
+// AppendEvent works like Document.AppendEvent, using the processor's configuration.
+func (processor *Processor) AppendEvent(doc Document, event DocumentEvent) ([]byte, Document, error) {
+	return doc.appendEvent(processor.config, event)
+}
+
+// appendEvent does the work of AppendEvent, with the supplied settings.
+func (doc Document) appendEvent(config *settings, event DocumentEvent) ([]byte, Document, error) {
+	appended := doc
+	appended.Events = append(append([]DocumentEvent{}, doc.Events...), event)
+	newState, err := appended.currentState(config)
+	if err != nil {
+		return nil, doc, fmt.Errorf("unable to append event %s: %w", event.EventId, err)
+	}
+
+	updated := doc
+	updated.BaseDocument = newState
+	updated.Events = []DocumentEvent{}
+	return newState, updated, nil
+}
+
+// WithComputedBaseFrom returns a copy of the document, with its base document replaced by the current state of other.
+// This lets documents be chained, e.g. applying a child entity's events on top of its parent's state.
+func (doc Document) WithComputedBaseFrom(other Document) (Document, error) {
+	return doc.withComputedBaseFrom(currentSettings(), other)
+}
+
+// WithComputedBaseFrom works like Document.WithComputedBaseFrom, using the processor's configuration.
+func (processor *Processor) WithComputedBaseFrom(doc Document, other Document) (Document, error) {
+	return doc.withComputedBaseFrom(processor.config, other)
+}
+
+// withComputedBaseFrom does the work of WithComputedBaseFrom, with the supplied settings.
+func (doc Document) withComputedBaseFrom(config *settings, other Document) (Document, error) {
+	baseDocument, err := other.currentState(config)
+	if err != nil {
+		return doc, fmt.Errorf("unable to compute base document from entity %s: %w", other.EntityId, err)
+	}
+	doc.BaseDocument = baseDocument
+	return doc, nil
+}
+
+// GetCurrentStateLazy works like GetCurrentState, except the base document is fetched by calling loadBase - and then
+// only if there are events to apply. doc.BaseDocument is ignored.
+//
+//	If there are no events, the base is not fetched; the result is empty, or `null` if LazyNoEventsResultIsNull is set.
+func (doc Document) GetCurrentStateLazy(loadBase func() ([]byte, error)) ([]byte, error) {
+	return doc.currentStateLazy(currentSettings(), loadBase)
+}
+
+// GetCurrentStateLazy works like Document.GetCurrentStateLazy, using the processor's configuration.
+func (processor *Processor) GetCurrentStateLazy(doc Document, loadBase func() ([]byte, error)) ([]byte, error) {
+	return doc.currentStateLazy(processor.config, loadBase)
+}
+
+// currentStateLazy does the work of GetCurrentStateLazy, with the supplied settings.
+func (doc Document) currentStateLazy(config *settings, loadBase func() ([]byte, error)) ([]byte, error) {
+	if len(doc.Events) == 0 {
+		if config.LazyNoEventsResultIsNull {
+			return []byte("null"), nil
+		}
+		return []byte{}, nil
+	}
+
+	baseDocument, err := loadBase()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load base document: %w", err)
+	}
+	doc.BaseDocument = baseDocument
+	return doc.currentState(config)
+}
+
+// currentStateMap maps the base document and applies every event to it, returning the resulting document map.
+// If report is not nil, it is filled in as the events are applied.
+func (doc Document) currentStateMap(config *settings, report *ApplyReport) (*documentMap, error) {
+	return doc.currentStateMapFrom(config, report, func() (*documentMap, error) {
+		return makeBaseMap(config, doc.BaseDocument)
+	})
+}
+
+// currentStateMapFrom works like currentStateMap, but the base document map is made by calling makeBase.
+func (doc Document) currentStateMapFrom(config *settings, report *ApplyReport, makeBase func() (*documentMap, error)) (*documentMap, error) {
+	docMap, err := makeBase()
 	if err != nil {
 		return nil, err
 	}
 
-	err = docMap.applyEvents(doc)
+	err = docMap.applyEvents(config, doc, report, applyHooks{})
 	if err != nil {
+		if config.Atomic {
+			return docMap, err // As it was before any events were applied
+		}
 		return nil, err
 	}
 
-	return docMap.buildResult()
+	return docMap, nil
 }
 
 /*
 	The following functions are all helpers to enable GetCurrentState to do it's thing.
 */
 
-// makeMap generates a "virtual DOM" view of the document. This makes it far easier than trying to
-// muck around with the actual document object  using reflection.
-func makeMap(document []byte) (*documentMap, error) {
-	// Print an analysis of the document using reflection
+var utf8BOM = []byte("\xef\xbb\xbf")
 
-	// Unmarshal the document ready for reflection
-	var unmarshalledDocument interface{}
-	err := json.Unmarshal(document, &unmarshalledDocument)
+// decodeDocument reads a single JSON document from r, straight into a document map. Numbers keep their original text,
+// rather than being decoded as float64; see numberToken.
+func decodeDocument(config *settings, r io.Reader) (*documentMap, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err // io.EOF if there's no document at all
+	}
+	root, err := decodeElement(config, decoder, token, 1)
 	if err != nil {
-		// Unmarshalling error, do something here
 		return nil, err
 	}
+	// json.Unmarshal would reject anything after the value, so must we; More() doesn't see a stray `}` or `]`
+	_, err = decoder.Token()
+	if err != io.EOF {
+		return nil, errors.New("invalid JSON: unexpected data after top-level value")
+	}
 
-	// Scan for elements using reflection
-	baseDocVal := reflect.ValueOf(unmarshalledDocument)
-	switch baseDocVal.Kind() {
-	case reflect.Map:
-		return mapMapElems(baseDocVal), nil
-	case reflect.Slice:
+	switch root.ElementType {
+	case DataTypeMap:
+		return root.Content, nil
+	case DataTypeArray:
 		// We have to return a document map; so use a magic variable as an array "holder"
 		// This will be removed when the document is rebuilt.
 		// This is only needed at the root level
 		return &documentMap{
-			IsArray: true,
-			Elements: map[string]*documentElement{
-				"array": {
-					ElementType:  "array",
-					ArrayContent: mapSliceElems(baseDocVal),
-				},
-			},
+			IsArray:  true,
+			Elements: map[string]*documentElement{"array": root},
 		}, nil
 	}
+	// A scalar is held in the same way as an array
+	return &documentMap{
+		IsScalar: true,
+		Elements: map[string]*documentElement{"value": root},
+	}, nil
+}
+
+// makeBaseMap generates the document map for a base document. A missing (nil or empty) base document is treated as an
+// empty object, as the first event often builds the document from nothing, unless Configuration.EmptyBaseIsError is set.
+func makeBaseMap(config *settings, base []byte) (*documentMap, error) {
+	if len(bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(base), utf8BOM))) == 0 {
+		if config.EmptyBaseIsError {
+			return nil, fmt.Errorf("%w (EmptyBaseIsError=true)", ErrEmptyBaseDocument)
+		}
+		base = []byte("{}")
+	}
+	return makeMap(config, base)
+}
 
-	return nil, errors.New("base document must have a Kind of reflect.Map or reflect.Slice")
+// makeMap generates a "virtual DOM" view of the document. This makes it far easier than trying to
+// muck around with the actual document object.
+func makeMap(config *settings, document []byte) (*documentMap, error) {
+	// Some stores prefix documents with a UTF-8 byte order mark, which the decoder rejects
+	document = bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(document), utf8BOM))
+	return decodeDocument(config, bytes.NewReader(document))
 }
 
-// mapMapElems recursively maps json objects from the document, using reflection
-func mapMapElems(inputMap reflect.Value) *documentMap {
-	// Create an output map to return
-	outMap := documentMap{
-		Elements: make(map[string]*documentElement),
+// numberToken returns the text to keep for a number from a JSON document. Integers are kept exactly as written, so
+// large IDs & counters don't lose precision; other numbers are normalised via float64 (e.g. 1.10 becomes 1.1), unless
+// PreserveNumberTokens is set.
+func numberToken(config *settings, number json.Number) (string, error) {
+	token := number.String()
+	if config.PreserveNumberTokens || !strings.ContainsAny(token, ".eE") {
+		return token, nil
 	}
+	value, err := number.Float64()
+	if err != nil {
+		return "", fmt.Errorf("number %s can't be represented as a float64: %w", token, err)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), nil
+}
 
-	iter := inputMap.MapRange()
-	for iter.Next() {
-		switch iter.Value().Elem().Kind() {
-		case reflect.Slice: // Arrays/Slices are both treated as arrays
-			outMap.Elements[iter.Key().String()] = &documentElement{
-				Name:         iter.Key().String(),
-				ElementType:  DataTypeArray,
-				ArrayContent: mapSliceElems(iter.Value().Elem()),
-			}
-		case reflect.Map: // A map would be a sub-object with fields/array content
-			outMap.Elements[iter.Key().String()] = &documentElement{
-				Name:        iter.Key().String(),
-				ElementType: DataTypeMap,
-				Content:     mapMapElems(iter.Value().Elem()),
-			}
-		case reflect.Invalid: // uh-oh...
-			outMap.Elements[iter.Key().String()] = &documentElement{
-				Name:        iter.Key().String(),
-				ElementType: DataTypeNull,
-				Value:       "", // Null values have no value (erm, obviously?)
-			}
-		case reflect.Float64:
-			outMap.Elements[iter.Key().String()] = &documentElement{
-				Name:        iter.Key().String(),
-				ElementType: DataType(iter.Value().Elem().Kind().String()),
-				Value:       strconv.FormatFloat(iter.Value().Elem().Float(), 'f', -1, 64),
-			}
-		case reflect.Bool:
-			outMap.Elements[iter.Key().String()] = &documentElement{
-				Name:        iter.Key().String(),
-				ElementType: DataType(iter.Value().Elem().Kind().String()),
-				Value:       strconv.FormatBool(iter.Value().Elem().Bool()),
-			}
+// checkDepth errors if an object or array at the given depth (the root being depth 1) is nested deeper than
+// Configuration.MaxDepth allows.
+func checkDepth(config *settings, depth int) error {
+	if config.MaxDepth > 0 && depth > config.MaxDepth {
+		return fmt.Errorf("document is nested more than %d levels deep", config.MaxDepth)
+	}
+	return nil
+}
 
-		default: // Anything else is just a key:value property
-			outMap.Elements[iter.Key().String()] = &documentElement{
-				Name:        iter.Key().String(),
-				ElementType: DataType(iter.Value().Elem().Kind().String()),
-				Value:       iter.Value().Elem().String(),
+// nextToken reads the next token from within a document; running out of JSON part way through is unexpected.
+func nextToken(decoder *json.Decoder) (json.Token, error) {
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return token, err
+}
+
+// decodeElement turns the JSON value starting with token into an element, reading the rest of it from the decoder if
+// it's an object or array. depth is the depth an object or array would be at, the root being depth 1.
+func decodeElement(config *settings, decoder *json.Decoder, token json.Token, depth int) (*documentElement, error) {
+	switch value := token.(type) {
+	case json.Delim:
+		if value == '{' {
+			content, err := decodeObject(config, decoder, depth)
+			if err != nil {
+				return nil, err
 			}
+			return &documentElement{ElementType: DataTypeMap, Content: content}, nil
+		}
+		// The decoder only returns an opening delimiter here, so it's an array
+		arrayContent, err := decodeArray(config, decoder, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &documentElement{ElementType: DataTypeArray, ArrayContent: arrayContent}, nil
+	case string:
+		return &documentElement{ElementType: DataTypeString, Value: value}, nil
+	case json.Number:
+		number, err := numberToken(config, value)
+		if err != nil {
+			return nil, err
+		}
+		return &documentElement{ElementType: DataTypeNumber, Value: number}, nil
+	case bool:
+		return &documentElement{ElementType: DataTypeBool, Value: strconv.FormatBool(value)}, nil
+	}
+	// Null values have no value (erm, obviously?)
+	return &documentElement{ElementType: DataTypeNull}, nil
+}
+
+// decodeObject reads the properties of a JSON object, whose opening brace has already been read, up to and including
+// its closing brace. If a key appears more than once, the last value wins, as with json.Unmarshal.
+func decodeObject(config *settings, decoder *json.Decoder, depth int) (*documentMap, error) {
+	err := checkDepth(config, depth)
+	if err == nil {
+		err = config.cancelled()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an output map to return
+	outMap := documentMap{
+		Elements: make(map[string]*documentElement),
+	}
+	for decoder.More() {
+		token, err := nextToken(decoder)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string) // The decoder only allows a string here
+		token, err = nextToken(decoder)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := decodeElement(config, decoder, token, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		elem.Name = key
+		outMap.Elements[key] = elem
+		if config.KeyOrder == KeyOrderDocument {
+			outMap.Order = append(outMap.Order, key)
 		}
 	}
 
-	return &outMap
+	// The closing brace
+	_, err = nextToken(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return &outMap, nil
 }
 
-// mapSliceElems recursively maps json arrays in the document, using reflection
-func mapSliceElems(theSlice reflect.Value) []*documentElement {
+// decodeArray reads the elements of a JSON array, whose opening bracket has already been read, up to and including its
+// closing bracket.
+func decodeArray(config *settings, decoder *json.Decoder, depth int) ([]*documentElement, error) {
+	err := checkDepth(config, depth)
+	if err == nil {
+		err = config.cancelled()
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	outSlice := make([]*documentElement, 0)
-	for i := 0; i < theSlice.Len(); i++ {
-		switch theSlice.Index(i).Elem().Kind() {
-		case reflect.Map:
-			outSlice = append(outSlice, &documentElement{
-				ElementType: "map",
-				Content:     mapMapElems(theSlice.Index(i).Elem()),
-			})
-		case reflect.Slice:
-			outSlice = append(outSlice, &documentElement{
-				ElementType:  "array",
-				ArrayContent: mapSliceElems(theSlice.Index(i).Elem()),
-			})
-		default:
-			outSlice = append(outSlice, &documentElement{
-				ElementType: DataType(theSlice.Index(i).Elem().Kind().String()),
-				Value:       theSlice.Index(i).Elem().String(),
-			})
+	for decoder.More() {
+		token, err := nextToken(decoder)
+		if err != nil {
+			return nil, err
 		}
+		elem, err := decodeElement(config, decoder, token, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		outSlice = append(outSlice, elem)
 	}
 
-	return outSlice
+	// The closing bracket
+	_, err = nextToken(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return outSlice, nil
+}
+
+// applyHooks let a caller of applyEvents look at each event and instruction as it's applied, e.g. to record what it
+// changed. Any of the hooks may be nil.
+type applyHooks struct {
+	beforeEvent       func(eventIndex int) error
+	afterEvent        func(eventIndex int) error
+	beforeInstruction func(eventIndex, instructionIndex int, instruction EventInstruction)
+	// afterInstruction is called once an instruction has been applied. err is nil if it succeeded; otherwise it's the
+	// error, and skipped says whether the instruction was skipped (see SkipValueErrorPaths) rather than failing.
+	afterInstruction func(eventIndex, instructionIndex int, instruction EventInstruction, err error, skipped bool) error
+	// keepGoing carries on past a failing instruction, once afterInstruction has seen it, rather than stopping there
+	keepGoing bool
 }
 
-// applyEvents takes each event in the collection in turn, and applies it cumulatively, instruction-by-instruction, to the document.
-func (docMap *documentMap) applyEvents(document Document) error {
+// applyEvents takes each event in the collection in turn, and applies it cumulatively, instruction-by-instruction, to
+// the document. Anything noteworthy is recorded in report, unless it is nil.
+//
+//	Every way of applying events comes through here, so each validates first if ValidateBeforeApply is set, stops if
+//	the context is cancelled, skips bad values on SkipValueErrorPaths paths, and rolls back if Atomic is set. A failing
+//	instruction's error - or an error from an instruction hook - is returned as an InstructionError, saying which
+//	instruction it was.
+func (docMap *documentMap) applyEvents(config *settings, document Document, report *ApplyReport, hooks applyHooks) error {
+	if config.ValidateBeforeApply {
+		err := document.validate(config)
+		if err != nil {
+			return err
+		}
+	}
+	var original *documentMap
+	if config.Atomic {
+		original = docMap.clone()
+	}
+	if hooks.keepGoing {
+		// A failing instruction mustn't leave behind the parents it created, as the others carry on without it
+		config = config.withUndo(&undoLog{})
+	}
 	// Apply any events to the documentMap to create our new document.
-	for _, event := range document.Events {
-		// Events have instructions - follow each instruction in the event
-		for _, instruction := range event.Instructions {
-
-			var err error
-			// Special cases: Path = "" and DataType = Array or Map and ActionType != remove THEN replace base doc with instruction value
-			if instruction.Path == "" && (instruction.DataType == DataTypeArray || instruction.DataType == DataTypeMap) && instruction.ActionType != ActionTypeRemove {
-				// Replacement time
-				var newDocMap *documentMap
-				newDocMap, err = docMap.replace(instruction)
-				if newDocMap != nil {
-					docMap.Elements = newDocMap.Elements
-					docMap.IsArray = newDocMap.IsArray
-				}
-			} else {
-				// All remaining use cases
-				switch instruction.ActionType {
-				case ActionTypeSetOrAdd:
-					err = docMap.setOrAdd(instruction)
-				case ActionTypeSetOnly:
-					err = docMap.setOnly(instruction)
-				case ActionTypeAddOnly:
-					err = docMap.addOnly(instruction)
-				case ActionTypeRemove:
-					err = docMap.removeElement(instruction)
-				default:
-					err = fmt.Errorf("unexpected instruction action type `%s`", instruction.ActionType)
-				}
-			}
-			if err != nil {
-				return err
+	for eventIndex, event := range document.Events {
+		err := config.cancelled()
+		if err == nil && hooks.beforeEvent != nil {
+			err = hooks.beforeEvent(eventIndex)
+		}
+		if err == nil {
+			err = docMap.applyEvent(config, eventIndex, event, report, hooks)
+		}
+		if err == nil && hooks.afterEvent != nil {
+			err = hooks.afterEvent(eventIndex)
+		}
+		if err != nil {
+			if original != nil {
+				docMap.restore(original)
 			}
-
+			return err
 		}
 	}
 
@@ -292,19 +762,154 @@ func (docMap *documentMap) applyEvents(document Document) error {
 	return nil
 }
 
+// applyEvent applies a single event - the eventIndex'th of its document - to the documentMap.
+func (docMap *documentMap) applyEvent(config *settings, eventIndex int, event DocumentEvent, report *ApplyReport, hooks applyHooks) error {
+	docMap.startEvent(config)
+	// Events have instructions - follow each instruction in the event
+	for instructionIndex, instruction := range event.Instructions {
+		instructionError := func(err error) error {
+			return InstructionError{
+				EventIndex:       eventIndex,
+				EventId:          event.EventId,
+				InstructionIndex: instructionIndex,
+				Path:             instruction.Path,
+				Err:              err,
+			}
+		}
+		rc := report.entry(eventIndex, instructionIndex, instruction.Path)
+		if report != nil {
+			if instruction.ActionType == ActionTypeNoOp {
+				rc.noOp(instruction.Value)
+			}
+			docMap.checkInstruction(config, instruction, rc)
+		}
+		if hooks.beforeInstruction != nil {
+			hooks.beforeInstruction(eventIndex, instructionIndex, instruction)
+		}
+
+		err := docMap.applyInstruction(config, instruction, rc)
+		skipped := err != nil && skipValueError(config, err, instruction.Path)
+		if err != nil && !skipped {
+			config.undo.rollback()
+		}
+		config.undo.reset()
+		if skipped {
+			rc.skip(err)
+		} else if err != nil {
+			err = instructionError(err)
+		}
+		if hooks.afterInstruction != nil {
+			hookErr := hooks.afterInstruction(eventIndex, instructionIndex, instruction, err, skipped)
+			if hookErr != nil {
+				return instructionError(hookErr)
+			}
+		}
+		if err != nil && !skipped && !hooks.keepGoing {
+			return err
+		}
+	}
+	return nil
+}
+
+// startEvent prepares the document for the instructions of a new event.
+func (docMap *documentMap) startEvent(config *settings) {
+	docMap.startParentCache()
+	if config.ArraySelectorMode == ArraySelectorModeSnapshot {
+		docMap.snapshotArrays()
+	}
+}
+
+// applyInstruction applies a single instruction to the document. Anything noteworthy is recorded via rc.
+func (docMap *documentMap) applyInstruction(config *settings, instruction EventInstruction, rc reportContext) (err error) {
+	if instruction.ActionType == ActionTypeNoOp {
+		// Nothing to do - not even checking the path or value
+		return nil
+	}
+	defer func() { docMap.forgetParents(config, instruction, err) }()
+	instruction, err = instruction.parseValue(config)
+	if err != nil {
+		return err
+	}
+	instruction.Path, err = nativePath(config, instruction.Path)
+	if err != nil {
+		return err
+	}
+	err = validatePath(config, instruction.Path)
+	if err != nil {
+		return err
+	}
+	instruction.Path, err = resolveParentSegments(config, instruction.Path)
+	if err != nil {
+		return err
+	}
+
+	// Special cases: Path = "" and ActionType sets a value THEN replace base doc with instruction value
+	if instruction.Path == "" && instruction.ActionType.replacesRoot() {
+		return docMap.replaceRoot(config, instruction)
+	}
+	if instruction.Path == "" {
+		// These act on the document itself, whatever its shape
+		switch instruction.ActionType {
+		case ActionTypeCompareAndSet:
+			return docMap.compareAndSet(config, instruction)
+		case ActionTypeIncrement:
+			return docMap.increment(config, instruction)
+		}
+	}
+	if docMap.IsScalar {
+		return rootScalarPropertyError(instruction.Path)
+	}
+
+	// All remaining use cases
+	switch instruction.ActionType {
+	case ActionTypeSetOrAdd:
+		err = docMap.setOrAdd(config, instruction)
+	case ActionTypeSetOnly:
+		err = docMap.setOnly(config, instruction)
+	case ActionTypeAddOnly:
+		err = docMap.addOnly(instruction)
+	case ActionTypeRemove:
+		err = docMap.removeElement(config, instruction, rc)
+	case ActionTypeReplaceAt:
+		err = docMap.replaceAt(config, instruction)
+	case ActionTypeCompareAndSet:
+		err = docMap.compareAndSet(config, instruction)
+	case ActionTypeMerge:
+		err = docMap.mergeElement(config, instruction)
+	case ActionTypeIncrement:
+		err = docMap.increment(config, instruction)
+	case ActionTypeAppend:
+		err = docMap.appendValue(config, instruction)
+	case ActionTypeInsertAt:
+		err = docMap.insertAt(config, instruction)
+	case ActionTypeMove, ActionTypeCopy:
+		err = docMap.moveOrCopy(config, instruction)
+	default:
+		err = fmt.Errorf("unexpected instruction action type `%s`", instruction.ActionType)
+	}
+	return err
+}
+
 // buildResult - Takes the finalised document map, and builds it into a JSON object, ready for sending back to the consumer.
-func (docMap *documentMap) buildResult() ([]byte, error) {
-	// Re-create the original document from the map
-	bareDocument, err := buildMap(docMap)
+func (docMap *documentMap) buildResult(config *settings) ([]byte, error) {
+	var result bytes.Buffer
+	err := docMap.writeResult(config, &result)
 	if err != nil {
 		return nil, err
 	}
+	return result.Bytes(), nil
+}
 
-	if docMap.IsArray {
-		return []byte(bareDocument), nil
-	} else {
-		return []byte(fmt.Sprintf("{%s}", bareDocument)), nil
+// writeResult works like buildResult, but writes the JSON to out as it goes.
+func (docMap *documentMap) writeResult(config *settings, out jsonWriter) error {
+	// Re-create the original document from the map
+	if docMap.IsArray || docMap.IsScalar {
+		return writeMap(config, out, docMap)
 	}
+	out.WriteByte('{')
+	err := writeMap(config, out, docMap)
+	out.WriteByte('}')
+	return err
 }
 
 /*
@@ -313,28 +918,48 @@ func (docMap *documentMap) buildResult() ([]byte, error) {
 */
 
 // setOrAdd locates the element to be set - creating it, and the path to it, if necessary - then sets the value.
-func (docMap *documentMap) setOrAdd(instruction EventInstruction) error {
+func (docMap *documentMap) setOrAdd(config *settings, instruction EventInstruction) error {
+	if config.SkipEmptyArrayCreation && isEmptyArrayValue(instruction) {
+		if _, exists := docMap.resolvePath(config, instruction.Path); !exists {
+			// Don't materialise an empty array (or the path to it)
+			return nil
+		}
+	}
+
 	// Locate the element to modify/add
-	elem, err := getMapPathElement(instruction.Path, true, docMap)
+	elem, err := docMap.locate(config, instruction.Path, true)
 	if err != nil {
 		return err
 	}
 
 	// ...then modify it
-	return elem.setValue(instruction.DataType, instruction.Value)
+	return elem.setValue(config, instruction.DataType, instruction.Value)
 }
 
-// setOrAdd locates the element to be set, then sets the value.
+// isEmptyArrayValue reports whether an instruction's value is an empty array.
+func isEmptyArrayValue(instruction EventInstruction) bool {
+	if instruction.DataType != DataTypeArray {
+		return false
+	}
+	var elements []interface{}
+	err := json.Unmarshal([]byte(instruction.Value), &elements)
+	return err == nil && len(elements) == 0
+}
+
+// setOnly locates the element to be set, then sets the value.
 // If the element doesn't exist (or any part of the path to it doesn't exist), it errors.
-func (docMap *documentMap) setOnly(instruction EventInstruction) error {
+func (docMap *documentMap) setOnly(config *settings, instruction EventInstruction) error {
 	// Locate the element to modify
-	elem, err := getMapPathElement(instruction.Path, false, docMap)
+	elem, err := docMap.locate(config, instruction.Path, false)
 	if err != nil {
 		return err
 	}
+	if config.SetOnlyPreservesType && elem.ElementType != instruction.DataType {
+		return fmt.Errorf("`%s` is a %s, and SetOnly may not change it to a %s", instruction.Path, elem.ElementType, instruction.DataType)
+	}
 
 	// ...then modify it
-	return elem.setValue(instruction.DataType, instruction.Value)
+	return elem.setValue(config, instruction.DataType, instruction.Value)
 }
 
 // addOnly locates the PARENT of the element to set; then checks to see if the property exists or not.
@@ -343,33 +968,114 @@ func (docMap *documentMap) addOnly(instruction EventInstruction) error {
 	return errors.New("addOnly not implemented")
 }
 
+// isEmpty reports whether the document is an empty object or an empty array.
+func (docMap *documentMap) isEmpty() bool {
+	if docMap.IsArray {
+		return len(docMap.Elements["array"].ArrayContent) == 0
+	}
+	return len(docMap.Elements) == 0
+}
+
 // replace takes the entire document, throws it away, and replaces it with the
 // supplied value.
 // Use case: Create a base document from an array or map value.
-// Therefore: Throw error if base doc is not an empty object.
-func (docMap *documentMap) replace(instruction EventInstruction) (*documentMap, error) {
-	if len(docMap.Elements) > 0 {
-		return nil, errors.New("invalid instruction - can't replace non-empty base document")
+// Therefore: Throw error if base doc is not an empty object or array, unless AllowReplaceNonEmptyBase is set.
+func (docMap *documentMap) replace(config *settings, instruction EventInstruction) (*documentMap, error) {
+	if !docMap.isEmpty() && !config.AllowReplaceNonEmptyBase {
+		return nil, fmt.Errorf("invalid instruction - %w", ErrReplaceNonEmptyBase)
 	}
-	newDocMap, err := makeMap([]byte(instruction.Value))
+	newDocMap, err := makeMap(config, []byte(instruction.Value))
 	if err != nil {
 		return nil, fmt.Errorf("invalid instruction - new base document is not valid: %w", err)
 	}
 	return newDocMap, nil
 }
 
+// replaceRoot replaces the whole document with the instruction's value, for an instruction with an empty path.
+func (docMap *documentMap) replaceRoot(config *settings, instruction EventInstruction) error {
+	if instruction.DataType != DataTypeArray && instruction.DataType != DataTypeMap {
+		return docMap.replaceWithScalar(config, instruction)
+	}
+	newDocMap, err := docMap.replace(config, instruction)
+	if newDocMap != nil {
+		docMap.Elements = newDocMap.Elements
+		docMap.Order = newDocMap.Order
+		docMap.IsArray = newDocMap.IsArray
+		docMap.IsScalar = newDocMap.IsScalar
+		// Arrays in the new document count as already existing, so later snapshot mode selectors in this event see them
+		docMap.snapshotArrays()
+	}
+	return err
+}
+
+// replaceWithScalar works like replace, but the document becomes a bare string, number, bool or null.
+func (docMap *documentMap) replaceWithScalar(config *settings, instruction EventInstruction) error {
+	switch instruction.DataType {
+	case DataTypeString, DataTypeNumber, DataTypeBool, DataTypeNull:
+	default:
+		return fmt.Errorf("%w: the document root can only be replaced by a map, array, string, number, bool or null, not a %s", ErrInvalidDataType, instruction.DataType)
+	}
+	if !docMap.isEmpty() && !config.AllowReplaceNonEmptyBase {
+		return fmt.Errorf("invalid instruction - %w", ErrReplaceNonEmptyBase)
+	}
+	scalar := &documentElement{}
+	err := scalar.setValue(config, instruction.DataType, instruction.Value)
+	if err != nil {
+		return err
+	}
+	docMap.Elements = map[string]*documentElement{"value": scalar}
+	docMap.Order = nil
+	docMap.IsArray = false
+	docMap.IsScalar = true
+	return nil
+}
+
+// replaceAt replaces the array element at a numeric index with the instruction's value. Unlike the path-based setters,
+// it never appends: the index must already exist.
+func (docMap *documentMap) replaceAt(config *settings, instruction EventInstruction) error {
+	arrayElem, index, err := docMap.indexedArray(config, instruction)
+	if err != nil {
+		return err
+	}
+	if index >= len(arrayElem.ArrayContent) {
+		return fmt.Errorf("array index %d is out of range, array `%s` has %d elements", index, arrayElem.Name, len(arrayElem.ArrayContent))
+	}
+
+	newElem := &documentElement{}
+	err = newElem.setValue(config, instruction.DataType, instruction.Value)
+	if err != nil {
+		return err
+	}
+	arrayElem.ArrayContent[index] = newElem
+	return nil
+}
+
+// splitLastIndexer splits the final array indexer from a path, e.g. `a.b[first][2]` becomes `a.b[first]` and `[2]`.
+// If the path doesn't end with an indexer, the indexer returned is empty.
+func splitLastIndexer(config *settings, path string) (string, string) {
+	if !strings.HasSuffix(path, config.arrayClose()) {
+		return path, ""
+	}
+	matchArrays := config.arrayRegex.FindAllStringIndex(path, -1)
+	if len(matchArrays) == 0 || matchArrays[len(matchArrays)-1][1] != len(path) {
+		return path, ""
+	}
+	lastMatch := matchArrays[len(matchArrays)-1]
+	return path[:lastMatch[0]], path[lastMatch[0]:]
+}
+
 // remove locates an element and, if successful, deletes it from the map.
-func (docMap *documentMap) removeElement(instruction EventInstruction) error {
+func (docMap *documentMap) removeElement(config *settings, instruction EventInstruction, rc reportContext) error {
 	// Locate the element's parent...
-	parentPathParts := strings.Split(instruction.Path, ".")
+	parentPathParts := splitPath(config, instruction.Path)
 	lastPath := parentPathParts[len(parentPathParts)-1]
 
 	// Looking at the last part of the path... if it's an array indexer, then just strip the indexer & return the entire array.
 	// if it's just a name, then drop it from the path entirely.
 	// If there's no path left, then fine, we're at the right level already...
-	if strings.Contains(lastPath, "[") {
+	if strings.Contains(lastPath, config.arrayOpen()) {
 		// Array Indexer... dump the outermost one & return the property (and any remaining nest levels) to the path
-		matchArrays := arrayRegex.FindAllString(lastPath, -1)
+		matchArrays := config.arrayRegex.FindAllString(lastPath, -1)
 		parentPathParts[len(parentPathParts)-1] = strings.TrimSuffix(lastPath, matchArrays[len(matchArrays)-1])
 		lastPath = matchArrays[len(matchArrays)-1]
 	} else {
@@ -377,59 +1083,107 @@ func (docMap *documentMap) removeElement(instruction EventInstruction) error {
 		parentPathParts = parentPathParts[:len(parentPathParts)-1]
 	}
 
-	// Go find the parent path element...
+	// Go find the parent path element... a top-level property's parent is the document itself.
 	parentPath := strings.Join(parentPathParts, ".")
-	parentElem, err := getMapPathElement(parentPath, false, docMap)
-	if err != nil {
-		if config.RemoveNonExistantElementIsError {
-			return err
+	if parentPath == "" && docMap.IsArray && !strings.HasPrefix(lastPath, config.arrayOpen()) {
+		return rootArrayPropertyError(config, lastPath)
+	}
+	parentElem := &documentElement{ElementType: DataTypeMap, Content: docMap}
+	if parentPath != "" || strings.HasPrefix(lastPath, config.arrayOpen()) {
+		var err error
+		parentElem, err = getMapPathElement(config, parentPath, false, docMap)
+		if err != nil {
+			if config.RemoveNonExistantElementIsError {
+				return fmt.Errorf("%w (RemoveNonExistantElementIsError=true)", err)
+			}
+			rc.configNote("removal ignored, `%s` not found; allowed by RemoveNonExistantElementIsError=false", parentPath)
+			return nil
 		}
-		return nil
 	}
 
 	// Find the lastpath element in parentElem, and remove it.
-	if strings.HasPrefix(lastPath, "[") {
+	if strings.HasPrefix(lastPath, config.arrayOpen()) {
 		// Is an array element...
-		arrayIndex := strings.ToLower(strings.TrimPrefix(strings.TrimSuffix(lastPath, "]"), "["))
+		arrayIndex := indexerName(config, lastPath)
 
 		// Check to see if the array isn't empty first... (unless arrayIndex=all)
 		if arrayIndex != "all" && len(parentElem.ArrayContent) == 0 {
 			if config.RemoveNonExistantArrayElementIsError {
-				return errors.New("attempt to remove array element failed, array was empty")
+				return fmt.Errorf("%w: can't remove an element from `%s` (RemoveNonExistantArrayElementIsError=true)", ErrEmptyArray, parentPath)
 			}
+			rc.configNote("removal ignored, array `%s` is empty; allowed by RemoveNonExistantArrayElementIsError=false", parentPath)
+			return nil
 		}
 		switch arrayIndex {
 		case "all":
+			rc.removed(config, &documentElement{ElementType: DataTypeArray, ArrayContent: parentElem.ArrayContent})
 			parentElem.ArrayContent = []*documentElement{} // Clear the entire array
 		case "first":
+			rc.removed(config, parentElem.ArrayContent[0])
 			parentElem.ArrayContent = parentElem.ArrayContent[1:] // Take out the first item only
 		case "last":
+			rc.removed(config, parentElem.ArrayContent[len(parentElem.ArrayContent)-1])
 			parentElem.ArrayContent = parentElem.ArrayContent[:len(parentElem.ArrayContent)-1] // Take out the last item only
 		default:
-			return fmt.Errorf("`%s` is not a supported array index for the remove action", arrayIndex)
-		}
-	} else {
-		for k := range parentElem.Content.Elements {
-			if strings.EqualFold(lastPath, k) {
-				// gotcha.
-				delete(parentElem.Content.Elements, k)
+			index, err := strconv.Atoi(arrayIndex)
+			if err != nil || index < 0 {
+				return fmt.Errorf("%w: `%s` is not a supported array index for the remove action", ErrUnsupportedArrayOp, arrayIndex)
+			}
+			if index >= len(parentElem.ArrayContent) {
+				if config.RemoveNonExistantArrayElementIsError {
+					return fmt.Errorf("%w: array `%s` has no element %d (RemoveNonExistantArrayElementIsError=true)", ErrElementNotFound, parentPath, index)
+				}
+				rc.configNote("removal ignored, array `%s` has no element %d; allowed by RemoveNonExistantArrayElementIsError=false", parentPath, index)
 				return nil
 			}
+			rc.removed(config, parentElem.ArrayContent[index])
+			// Copied rather than shuffled down in place, as a snapshot may share the backing array
+			parentElem.ArrayContent = append(parentElem.ArrayContent[:index:index], parentElem.ArrayContent[index+1:]...)
+		}
+		return nil
+	} else if parentElem.ElementType == DataTypeArray {
+		if !config.ImplicitFirstSelector {
+			return missingSelectorError(config, parentElem.Name, lastPath)
+		}
+		if len(parentElem.ArrayContent) == 0 {
+			parentElem = &documentElement{ElementType: DataTypeMap, Content: &documentMap{}} // Nothing to remove from; fall through to the not found handling
+		} else {
+			parentElem = parentElem.ArrayContent[0]
+		}
+	}
+	if parentElem.ElementType != DataTypeMap || parentElem.Content == nil {
+		// e.g. an element of an array of numbers: it has no properties, so there's nothing to remove
+		if config.RemoveNonExistantElementIsError {
+			return fmt.Errorf("%w: can't remove `%s`, as `%s` is a %s rather than an object (RemoveNonExistantElementIsError=true)", ErrElementNotFound, lastPath, parentPath, parentElem.ElementType)
 		}
+		rc.configNote("removal ignored, `%s` is a %s so has no `%s`; allowed by RemoveNonExistantElementIsError=false", parentPath, parentElem.ElementType, lastPath)
+		return nil
+	}
+	// Matched as the path finder matches names, so that removal is consistent with lookup (see CaseSensitivePaths)
+	if k, elem := parentElem.Content.findElement(config, lastPath); elem != nil {
+		// gotcha.
+		rc.removed(config, elem)
+		parentElem.Content.remove(k)
+		return nil
 	}
 
 	// Element didn't exist in parent. Is this an error?
 	if config.RemoveNonExistantElementIsError {
-		return fmt.Errorf("element `%s` not found when trying to remove it", lastPath)
+		return fmt.Errorf("%w: can't remove `%s` (RemoveNonExistantElementIsError=true)", ErrElementNotFound, lastPath)
 	}
 
 	// Element didn't exist, but that's not an error.
+	rc.configNote("removal ignored, element `%s` not found; allowed by RemoveNonExistantElementIsError=false", lastPath)
 	return nil
 }
 
 // setValue overwrites a documentElement's datatype & value. It is used by all the setters.
-func (elem *documentElement) setValue(dataType DataType, value string) error {
-	elem.ElementType = dataType
+func (elem *documentElement) setValue(config *settings, dataType DataType, value string) error {
+	value, err := checkScalarValue(dataType, value)
+	if err != nil {
+		return err
+	}
+	wasMap := elem.ElementType == DataTypeMap && elem.Content != nil
 	switch dataType {
 	// First three are basic "set the value" types
 	case DataTypeString:
@@ -439,207 +1193,400 @@ func (elem *documentElement) setValue(dataType DataType, value string) error {
 	case "bool":
 		elem.Value = value
 	case "null":
+		// Drop any object or array the element held, so nothing stale can be found beneath it
 		elem.Value = ""
+		elem.Content = nil
+		elem.ArrayContent = nil
 	case "map":
 		// Decode the instruction value JSON & then apply the map
-		patchMap, err := makeMap([]byte(value))
+		patchMap, err := makeMap(config, []byte(value))
 		if err != nil {
 			// Unmarshalling error, do something here
-			log.Printf("error unmarshalling instruction value `%s`: %v", value, err)
+			config.logf("error unmarshalling instruction value `%s`: %v", value, err)
 			return err
 		}
+		if patchMap.IsArray || patchMap.IsScalar {
+			return fmt.Errorf("%w: `%s` is not a valid %s value", ErrInvalidDataType, value, dataType)
+		}
+		patchMap.snapshotArrays()
 
+		if config.MapSetMerges && wasMap {
+			// Keep the properties the value doesn't mention; see merge.go
+			elem.merge(config, &documentElement{ElementType: DataTypeMap, Content: patchMap})
+			break
+		}
 		elem.Content = patchMap // That was easier than expected...
 
 	case "array":
 		// Decode as above. This should be an array...
-		patchMap, err := makeMap([]byte(value))
+		patchMap, err := makeMap(config, []byte(value))
 		if err != nil {
 			// Unmarshalling error, do something here
-			log.Printf("error unmarshalling instruction value `%s`: %v", value, err)
+			config.logf("error unmarshalling instruction value `%s`: %v", value, err)
 			return err
 		}
+		if !patchMap.IsArray {
+			return fmt.Errorf("%w: `%s` is not a valid %s value", ErrInvalidDataType, value, dataType)
+		}
 		elem.ArrayContent = patchMap.Elements["array"].ArrayContent // Need to work on this one...
+		elem.snapshotArrays()
 
+	default:
+		// Custom data type; the value is kept as-is, for its encoder to deal with
+		elem.Value = value
 	}
 
+	// Only now the value's been decoded, so a bad one leaves the element as it was
+	elem.ElementType = dataType
 	return nil
 }
 
+// checkScalarValue checks that a number or bool value can be output as one, so a bad value is caught when it's applied
+// rather than producing invalid JSON later. Bools are normalised, e.g. `TRUE` becomes `true`; other values are
+// returned unchanged.
+func checkScalarValue(dataType DataType, value string) (string, error) {
+	switch dataType {
+	case DataTypeNumber:
+		// ParseFloat also accepts things JSON doesn't, such as `Inf` or `0x10`
+		_, err := strconv.ParseFloat(value, 64)
+		if err != nil || !json.Valid([]byte(value)) {
+			return value, fmt.Errorf("%w: `%s` is not a valid %s value", ErrInvalidDataType, value, dataType)
+		}
+	case DataTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return value, fmt.Errorf("%w: `%s` is not a valid %s value", ErrInvalidDataType, value, dataType)
+		}
+		return strconv.FormatBool(b), nil
+	}
+	return value, nil
+}
+
 /*
 	The following two functions recursively locate an item, either by an array indexer, or based purely on a path
 	e.g. Prop1.SubProp1.SubSubProp1[first].ArrayProp1 will hunt through the document map to find the ArrayProp1 element,
 		which will be in the first element of the array, which itself is a property called SubSubProp1 in object SubProp1
 		which is a property of Prop1 of the root document...(!) See the README.md file for formatted examples.
-	//TODO: introduce more flexible array indexers, e.g. conditionals as well as first, last & new
+	Indexers may be first, last, new, a numeric index, or a condition such as [sku=ABC123] (see arraycondition.go).
 */
 
-func getArrayPathElement(arrayActions, basePath string, createIfMissing bool, rootElements *[]*documentElement) (*documentElement, error) {
+func getArrayPathElement(config *settings, arrayActions, basePath string, createIfMissing bool, arrayElem *documentElement) (*documentElement, error) {
 	// Use a regex to get all [x][y][z] patterns out of arrayActions
-	matchArrays := arrayRegex.FindAllString(arrayActions, -1)
+	matchArrays := config.arrayRegex.FindAllString(arrayActions, -1)
 	if len(matchArrays) == 0 {
-		// Oops
-		panic(fmt.Sprintf("attempting to get array action from `%s`, regex failed", arrayActions))
+		// e.g. an unbalanced bracket, in a path which didn't go through validatePath
+		return nil, fmt.Errorf("malformed array indexer `%s` before `%s`", arrayActions, basePath)
 	}
-	arrayAction := strings.ToLower(strings.TrimPrefix(strings.TrimSuffix(matchArrays[0], "]"), "["))
+	arrayAction := indexerName(config, matchArrays[0])
 	nextAction := ""
 	if len(matchArrays) > 1 {
 		nextAction = strings.Join(matchArrays[1:], "")
 	}
+	if key, value, ok := parseCondition(config, matchArrays[0]); ok {
+		return getConditionalArrayElement(config, key, value, nextAction, basePath, createIfMissing, arrayElem)
+	}
+
+	rootElements := &arrayElem.ArrayContent
+	// How long the selectors think the array is - which, in snapshot mode, is how long it was at the start of the event.
+	length := arrayElem.selectorLength(config)
 
 	switch arrayAction {
-	case "first":
-		// Find the first array element. Add a new one if createIfMissing is set.
-		if len(*rootElements) > 0 {
-			if nextAction != "" {
-				// Nested array, move on to the next level
-				return getArrayPathElement(nextAction, basePath, createIfMissing, &(*rootElements)[0].ArrayContent)
+	case "first", "last":
+		// Find the first (or last) array element. Add a new one if createIfMissing is set.
+		if length > 0 && len(*rootElements) > 0 {
+			index := 0
+			if arrayAction == "last" {
+				index = len(*rootElements) - 1
 			}
-			// Found the item. Is this a plain value array?
-			if basePath != "" {
-				// Nope - continue traversing
-				return getMapPathElement(basePath, createIfMissing, (*rootElements)[0].Content)
-			}
-			// Yes; so return it
-			return (*rootElements)[0], nil
+			return resolveArrayElement(config, (*rootElements)[index], nextAction, basePath, createIfMissing)
 		} else if !createIfMissing {
 			// If createIfMissing is NOT set, then abandon.
-			return nil, errors.New("empty array encountered when seeking first element")
+			return nil, fmt.Errorf("%w: array `%s` has no %s element", ErrEmptyArray, arrayElem.Name, arrayAction)
 		}
 		// Otherwise, fall-through into the append new item code.
 		fallthrough
 	case "new":
+		if length < len(*rootElements) {
+			// Snapshot mode: an earlier instruction in this event already added the new element, so use that.
+			return resolveArrayElement(config, (*rootElements)[length], nextAction, basePath, createIfMissing)
+		} else if !createIfMissing {
+			// A lookup mustn't grow the array; the new element doesn't exist until something creates it.
+			return nil, fmt.Errorf("%w: array `%s` has no %s element, and createIfMissing is false", ErrElementNotFound, arrayElem.Name, arrayAction)
+		}
 		// Create a new array element.
+		newElem := &documentElement{
+			ElementType: "null", // We don't know what's going in here
+		}
 		if nextAction != "" {
 			// Nested array... go on then
-			*rootElements = append(*rootElements, &documentElement{
+			newElem = &documentElement{
 				ElementType:  "array",
 				ArrayContent: make([]*documentElement, 0),
-			})
-			return getArrayPathElement(nextAction, basePath, createIfMissing, &(*rootElements)[0].ArrayContent)
-		}
-		if basePath != "" {
+			}
+		} else if basePath != "" {
 			// Needs a map.
-			*rootElements = append(*rootElements, &documentElement{
+			newElem = &documentElement{
 				ElementType: "map",
 				Content: &documentMap{
 					Elements: make(map[string]*documentElement),
 				},
-			})
-			return getMapPathElement(basePath, createIfMissing, (*rootElements)[0].Content)
+			}
 		}
-		// Must be a value, then.
-		*rootElements = append(*rootElements, &documentElement{
-			ElementType: "null", // We don't know what's going in here
-		})
-		// Return the new item
-		return (*rootElements)[len(*rootElements)-1], nil
-	case "last":
-		// Find the last array element. Do NOT add a new one, in this case
-		return nil, errors.New("last array element is not yet supported")
+		err := arrayElem.appendElement(config, newElem)
+		if err != nil {
+			return nil, err
+		}
+		return resolveArrayElement(config, newElem, nextAction, basePath, createIfMissing)
 	default:
-		// Unsupported, whatever it is.
-		return nil, fmt.Errorf("array element operator `%s` is not supported", arrayAction)
+		index, err := strconv.Atoi(arrayAction)
+		if err != nil {
+			// Unsupported, whatever it is.
+			return nil, fmt.Errorf("%w: array element operator `%s` is not supported", ErrUnsupportedArrayOp, arrayAction)
+		}
+		return getIndexedArrayElement(config, index, nextAction, basePath, createIfMissing, arrayElem)
+	}
+}
+
+// getIndexedArrayElement finds the array element at a numeric index. If createIfMissing is set, the index may also be
+// the next free slot, in which case a new element is appended.
+func getIndexedArrayElement(config *settings, index int, nextAction, basePath string, createIfMissing bool, arrayElem *documentElement) (*documentElement, error) {
+	length := len(arrayElem.ArrayContent)
+	if index >= 0 && index < length {
+		return resolveArrayElement(config, arrayElem.ArrayContent[index], nextAction, basePath, createIfMissing)
+	}
+	if !createIfMissing || index != length {
+		return nil, fmt.Errorf("array index %d is out of range, array `%s` has %d elements", index, arrayElem.Name, length)
+	}
+	newElem := &documentElement{ElementType: DataTypeNull}
+	err := arrayElem.appendElement(config, newElem)
+	if err != nil {
+		return nil, err
+	}
+	return resolveArrayElement(config, newElem, nextAction, basePath, createIfMissing)
+}
+
+// appendElement adds a new element to the end of an array, enforcing Configuration.MaxArrayLength.
+func (arrayElem *documentElement) appendElement(config *settings, newElem *documentElement) error {
+	if config.MaxArrayLength > 0 && len(arrayElem.ArrayContent) >= config.MaxArrayLength && config.ArrayOverflowMode != ArrayOverflowDropOldest {
+		return fmt.Errorf("array `%s` already has the maximum of %d elements", arrayElem.Name, config.MaxArrayLength)
+	}
+	previous, previousSnapshot := arrayElem.ArrayContent, arrayElem.snapshotLength
+	config.recordUndo(func() {
+		arrayElem.ArrayContent, arrayElem.snapshotLength = previous, previousSnapshot
+	})
+	arrayElem.ArrayContent = append(arrayElem.ArrayContent, newElem)
+
+	if config.MaxArrayLength > 0 && len(arrayElem.ArrayContent) > config.MaxArrayLength {
+		dropped := len(arrayElem.ArrayContent) - config.MaxArrayLength
+		arrayElem.ArrayContent = arrayElem.ArrayContent[dropped:]
+		// Keep snapshot mode selectors pointing at the same elements
+		arrayElem.snapshotLength -= dropped
+		if arrayElem.snapshotLength < 0 {
+			arrayElem.snapshotLength = 0
+		}
+	}
+	return nil
+}
+
+// resolveArrayElement carries on from an array element found by getArrayPathElement: into a nested array if there
+// are more indexers, into a map if there is more path, or it's the element we're after.
+func resolveArrayElement(config *settings, elem *documentElement, nextAction, basePath string, createIfMissing bool) (*documentElement, error) {
+	if nextAction != "" {
+		// Nested array, move on to the next level
+		if elem.ElementType == DataTypeNull && createIfMissing {
+			elem.makeContainer(config, DataTypeArray)
+		}
+		if elem.ElementType != DataTypeArray {
+			return nil, fmt.Errorf("%w: array indexer `%s` can't be applied to a `%s` array element", ErrUnsupportedArrayOp, nextAction, elem.ElementType)
+		}
+		return getArrayPathElement(config, nextAction, basePath, createIfMissing, elem)
+	}
+	// Found the item. Is this a plain value array?
+	if basePath != "" {
+		// Nope - continue traversing
+		return descendIntoArrayElement(config, elem, basePath, createIfMissing)
+	}
+	// Yes; so return it
+	return elem, nil
+}
+
+// selectorLength returns the length of an array as the array selectors should see it: the current length, or in
+// snapshot mode the length when the current event started. Arrays created during the event start at zero.
+func (elem *documentElement) selectorLength(config *settings) int {
+	if config.ArraySelectorMode == ArraySelectorModeSnapshot {
+		return elem.snapshotLength
 	}
+	return len(elem.ArrayContent)
+}
+
+// snapshotArrays records the length of every array in the document, for snapshot mode selectors.
+func (docMap *documentMap) snapshotArrays() {
+	for _, elem := range docMap.Elements {
+		elem.snapshotArrays()
+	}
+}
+
+func (elem *documentElement) snapshotArrays() {
+	elem.snapshotLength = len(elem.ArrayContent)
+	if elem.Content != nil {
+		elem.Content.snapshotArrays()
+	}
+	for _, arrayElem := range elem.ArrayContent {
+		arrayElem.snapshotArrays()
+	}
+}
+
+// descendIntoArrayElement carries on traversing basePath from within an array element, which must be a map.
+// A null element is turned into a map if createIfMissing is set; any other element is an error.
+func descendIntoArrayElement(config *settings, elem *documentElement, basePath string, createIfMissing bool) (*documentElement, error) {
+	switch elem.ElementType {
+	case DataTypeMap:
+		return getMapPathElement(config, basePath, createIfMissing, elem.Content)
+	case DataTypeNull:
+		if createIfMissing {
+			elem.makeContainer(config, DataTypeMap)
+			return getMapPathElement(config, basePath, createIfMissing, elem.Content)
+		}
+	case DataTypeArray:
+		return nil, fmt.Errorf("%w: cannot descend into array element to find `%s` without an array indexer", ErrUnsupportedArrayOp, basePath)
+	}
+	return nil, fmt.Errorf("cannot descend into scalar array element to find `%s`", basePath)
+}
+
+// rootArrayPropertyError explains that a root array has no properties. Internally, its elements are held in a
+// property called "array" - which must not be addressable, or instructions could corrupt the document.
+func rootArrayPropertyError(config *settings, name string) error {
+	return fmt.Errorf("the document is an array, so has no property `%s`; address its elements with an indexer, e.g. `%sfirst%s`", name, config.arrayOpen(), config.arrayClose())
+}
+
+// rootScalarPropertyError explains that a path can't lead anywhere in a document which is just a string, number, etc.
+func rootScalarPropertyError(name string) error {
+	return fmt.Errorf("%w: the document is a scalar value, so has no property `%s`", ErrInvalidDataType, name)
 }
 
-func getArrayIndexer(pathPart string) (string, string) {
+// missingSelectorError explains that the path carries on past an array without saying which of its elements to use.
+func missingSelectorError(config *settings, name, next string) error {
+	return fmt.Errorf("array `%s` requires a selector before `%s`, e.g. `%s%sfirst%s.%s` (or set ImplicitFirstSelector=true)", name, next, name, config.arrayOpen(), config.arrayClose(), next)
+}
+
+func getArrayIndexer(config *settings, pathPart string) (string, string) {
 	// Split the [x] bit off a named array property. [x][y] (to any level of nesting) is handled.
 
-	// Split on first "[", and set up the array finder.
-	nameAndArrayIndex := strings.SplitN(pathPart, "[", 2)
+	// Split on first "[" (or configured equivalent), and set up the array finder.
+	nameAndArrayIndex := strings.SplitN(pathPart, config.arrayOpen(), 2)
 	pathPart = nameAndArrayIndex[0]
-	arrayPart := fmt.Sprintf("[%s", nameAndArrayIndex[1])
+	arrayPart := config.arrayOpen() + nameAndArrayIndex[1]
 
 	// Return the output (e.g. "NestedArray", "[x][y][z]")
 	return pathPart, arrayPart
 }
 
-func getMapPathElement(basePath string, createIfMissing bool, startAt *documentMap) (*documentElement, error) {
+func getMapPathElement(config *settings, basePath string, createIfMissing bool, startAt *documentMap) (*documentElement, error) {
 	// Decompose the path into elements, then navigate the map to find the entry point for our delta.
 	// Note that we have to start at a map; so this won't work where the initial path is an array element (TODO)
 	// If we end up at a dead end, either create a new element (if createIfMissing is true) or abort with an error.
-	pathParts := strings.Split(basePath, ".")
+	pathParts := splitPath(config, basePath)
 	nextPath := ""
 	if len(pathParts) > 1 {
 		nextPath = strings.Join(pathParts[1:], ".") // Rebuild the rest of the path for the next call.
 	}
 
-	findElementWithName := strings.ToLower(pathParts[0])
+	findElementWithName := pathParts[0]
 
 	// Check for arrays...
-	seekArray := strings.Contains(findElementWithName, "[")
+	seekArray := strings.Contains(findElementWithName, config.arrayOpen())
 	arrayElement := ""
 	if seekArray {
-		findElementWithName, arrayElement = getArrayIndexer(findElementWithName)
+		// The indexers keep their case, as conditional indexers compare values
+		findElementWithName, arrayElement = getArrayIndexer(config, findElementWithName)
+	}
+	if startAt.IsArray && findElementWithName != "" {
+		return nil, rootArrayPropertyError(config, pathParts[0])
+	}
+	if startAt.IsScalar {
+		return nil, rootScalarPropertyError(pathParts[0])
 	}
 
-	for _, elem := range startAt.Elements {
-		if strings.ToLower(elem.Name) == findElementWithName {
-			// Gotcha!
-			if seekArray {
-				// Expected element is an array... so jump into the array element handler.
-				return getArrayPathElement(arrayElement, nextPath, createIfMissing, &elem.ArrayContent)
-			}
-			// If element contains sub-elements, do we need to drill down?
-			if elem.ElementType == "map" && nextPath != "" {
-				return getMapPathElement(nextPath, createIfMissing, elem.Content)
+	var elem *documentElement
+	if startAt.IsArray {
+		elem = startAt.Elements["array"] // The root array has no name; any other name was rejected above
+	} else {
+		_, elem = startAt.findElement(config, findElementWithName)
+	}
+	if elem != nil {
+		// Gotcha!
+		if seekArray {
+			// Expected element is an array... so jump into the array element handler.
+			return getArrayPathElement(config, arrayElement, nextPath, createIfMissing, elem)
+		}
+		if elem.ElementType == DataTypeArray && nextPath != "" {
+			// More path, but no indexer to say which array element it's in
+			if config.ImplicitFirstSelector {
+				return getArrayPathElement(config, config.arrayOpen()+"first"+config.arrayClose(), nextPath, createIfMissing, elem)
 			}
+			return nil, missingSelectorError(config, elem.Name, pathParts[1])
+		}
+		// If element contains sub-elements, do we need to drill down?
+		if elem.ElementType == "map" && nextPath != "" {
+			return getMapPathElement(config, nextPath, createIfMissing, elem.Content)
+		}
 
-			if elem.ElementType == "null" && nextPath != "" {
-				// We've reached a NULL, but there's more to the path...
-				// Therefore we must be creating a new map...
-				if createIfMissing {
-					elem.ElementType = "map"
-					elem.Content = &documentMap{
-						Elements: make(map[string]*documentElement),
-					}
-					return getMapPathElement(nextPath, createIfMissing, elem.Content)
-				} else {
-					// Can't go on.
-					return nil, fmt.Errorf("encountered null value in path, and create path is not enabled")
-				}
+		if elem.ElementType == "null" && nextPath != "" {
+			// We've reached a NULL, but there's more to the path...
+			// Therefore we must be creating a new map...
+			if createIfMissing {
+				elem.makeContainer(config, DataTypeMap)
+				return getMapPathElement(config, nextPath, createIfMissing, elem.Content)
+			} else {
+				// Can't go on.
+				return nil, fmt.Errorf("%w: encountered null value `%s` in path, and create path is not enabled", ErrElementNotFound, elem.Name)
 			}
+		}
 
-			// If we get here, then we found the element and we don't need to drill any further 'cos nextPath is ""
-			return elem, nil
-
+		if nextPath != "" {
+			// A scalar, but there's more to the path
+			return nil, fmt.Errorf("%w: `%s` is a %s, so has no element `%s`", ErrElementNotFound, elem.Name, elem.ElementType, pathParts[1])
 		}
+
+		// If we get here, then we found the element and we don't need to drill any further 'cos nextPath is ""
+		return elem, nil
 	}
 
 	// We failed to find the element. So create it if needed...
 	if createIfMissing {
 		if seekArray {
-			startAt.Elements[pathParts[0]] = &documentElement{
-				Name:         pathParts[0],
+			// The new array is named without its indexer(s)
+			arrayName, _ := getArrayIndexer(config, pathParts[0])
+			startAt.create(config, arrayName, &documentElement{
+				Name:         arrayName,
 				ElementType:  "array",
 				ArrayContent: make([]*documentElement, 0),
-			}
-			return getArrayPathElement("", nextPath, createIfMissing, &startAt.Elements[pathParts[0]].ArrayContent)
+			})
+			return getArrayPathElement(config, arrayElement, nextPath, createIfMissing, startAt.Elements[arrayName])
 		}
 
 		if nextPath != "" {
 			// Create a new map element here, and move on
-			startAt.Elements[pathParts[0]] = &documentElement{
+			startAt.create(config, pathParts[0], &documentElement{
 				Name:        pathParts[0],
 				ElementType: "map",
 				Content: &documentMap{
 					Elements: make(map[string]*documentElement),
 				},
-			}
-			return getMapPathElement(nextPath, createIfMissing, startAt.Elements[pathParts[0]].Content)
+			})
+			return getMapPathElement(config, nextPath, createIfMissing, startAt.Elements[pathParts[0]].Content)
 		}
 
 		// If there's no path left, we've reached the end of our search (hurrah!) Return the parent element.
-		startAt.Elements[pathParts[0]] = &documentElement{
+		startAt.create(config, pathParts[0], &documentElement{
 			Name:        pathParts[0],
 			ElementType: "null", // We don't know what's going in it...
-		}
+		})
 		return startAt.Elements[pathParts[0]], nil
 
 	}
 
-	return nil, fmt.Errorf("unable to locate element named `%s` and createIfMissing is false", pathParts[0])
+	return nil, fmt.Errorf("%w: unable to locate element named `%s` and createIfMissing is false", ErrElementNotFound, pathParts[0])
 }
 
 /*
@@ -648,115 +1595,212 @@ func getMapPathElement(basePath string, createIfMissing bool, startAt *documentM
 	square brackets as applicable) valid JSON object, ready to go back to the caller.
 */
 
-func buildArray(arrayContent []*documentElement) (string, error) {
-	// Special case for empty arrays
-	if len(arrayContent) == 0 {
-		return "", nil
+// jsonWriter is where JSON is written as it's built: a strings.Builder or bytes.Buffer, or a bufio.Writer to stream it.
+// Write errors are left for the caller to pick up, e.g. from bufio.Writer.Flush.
+type jsonWriter interface {
+	io.StringWriter
+	io.ByteWriter
+}
+
+func buildArray(config *settings, arrayContent []*documentElement) (string, error) {
+	var newArray strings.Builder
+	err := writeArray(config, &newArray, arrayContent)
+	if err != nil {
+		return "", err
 	}
+	return newArray.String(), nil
+}
 
-	// Otherwise iterate over the array and build as appropriate
-	newArray := "%s"
-	for _, v := range arrayContent {
-		switch v.ElementType {
-		case DataTypeArray:
-			// Add an array item
-			subst, err := buildArray(v.ArrayContent)
-			if err != nil {
-				return "", err
-			}
-			newArray = strings.Replace(newArray, "%s", fmt.Sprintf(`[%s],%%s`, subst), -1)
-		case DataTypeMap:
-			// Add a sub-object
-			subst, err := buildMap(v.Content)
-			if err != nil {
-				return "", err
-			}
-			newArray = strings.Replace(newArray, "%s", fmt.Sprintf(`{%s},%%s`, subst), -1)
-		case DataTypeString:
-			// Add a string property
-			newArray = strings.Replace(newArray, "%s", fmt.Sprintf(`"%s",%%s`, escapeString(v.Value)), -1)
-		case DataTypeNumber:
-			// Add a numeric property
-			newArray = strings.Replace(newArray, "%s", fmt.Sprintf(`%s,%%s`, v.Value), -1)
-		case DataTypeBool:
-			// Add a boolean property
-			newArray = strings.Replace(newArray, "%s", fmt.Sprintf(`%s,%%s`, v.Value), -1)
-		case DataTypeNull:
-			// Add a named null property
-			newArray = strings.Replace(newArray, "%s", "null,%s", -1)
-		default:
-			return "", fmt.Errorf("unexpected data type `%s` found in document array", v.ElementType)
+// writeArray writes the elements of an array to out, comma-separated. Empty arrays come out as "".
+func writeArray(config *settings, out jsonWriter, arrayContent []*documentElement) error {
+	if err := config.cancelled(); err != nil {
+		return err
+	}
+	// Iterate over the array and build as appropriate.
+	for i, v := range arrayContent {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		err := writeElement(config, out, v, "array")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMap writes the properties of an object to out, comma-separated. Empty maps come out as "".
+func writeMap(config *settings, out jsonWriter, docMap *documentMap) error {
+	if err := config.cancelled(); err != nil {
+		return err
+	}
+	// Iterate over the properties & set them as appropriate.
+	first := true
+	for _, k := range docMap.keys(config) {
+		v := docMap.Elements[k]
+		if !first {
+			out.WriteByte(',')
+		}
+		first = false
+		if !docMap.IsScalar && (!docMap.IsArray || v.ElementType != DataTypeArray) {
+			// Special case if root map has "IsArray" or "IsScalar" set: its value is written without a name
+			out.WriteByte('"')
+			out.WriteString(escapeString(config, k))
+			out.WriteString(`":`)
+		}
+		err := writeElement(config, out, v, "map")
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Truncate the trailing ",%s" and return
-	return strings.TrimSuffix(newArray, ",%s"), nil
+// writeElement writes the JSON for a single element's value to out; nested objects & arrays are written straight into
+// out too, so nothing is built twice. container is only used in error messages.
+func writeElement(config *settings, out jsonWriter, v *documentElement, container string) error {
+	token, encoded, err := v.encodeValue(config)
+	if err != nil {
+		return err
+	}
+	if encoded {
+		out.WriteString(token)
+		return nil
+	}
+	switch v.ElementType {
+	case DataTypeArray:
+		// Add an array item
+		out.WriteByte('[')
+		err := writeArray(config, out, v.ArrayContent)
+		if err != nil {
+			return err
+		}
+		out.WriteByte(']')
+	case DataTypeMap:
+		// Add a sub-object
+		out.WriteByte('{')
+		err := writeMap(config, out, v.Content)
+		if err != nil {
+			return err
+		}
+		out.WriteByte('}')
+	case DataTypeString:
+		// Add a string property
+		out.WriteByte('"')
+		out.WriteString(escapeString(config, v.Value))
+		out.WriteByte('"')
+	case DataTypeNumber:
+		// Add a numeric property
+		out.WriteString(formatNumber(config, v.Value))
+	case DataTypeBool:
+		// Add a boolean property
+		out.WriteString(v.Value)
+	case DataTypeNull:
+		// Add a null property
+		out.WriteString("null")
+	default:
+		// Unexpected data type - error
+		return fmt.Errorf("%w: unexpected data type `%s` found in document %s", ErrInvalidDataType, v.ElementType, container)
+	}
+	return nil
 }
 
-func buildMap(docMap *documentMap) (string, error) {
-	// Special case for empty maps
-	if len(docMap.Elements) == 0 {
-		return "", nil
+// formatNumber applies the configured NumberPrecision to a numeric value. The value is rounded to that many decimal
+// places, half away from zero; trailing zeros are not added, so integers stay as integers. Rounding works on the
+// decimal digits as written, rather than through a float64, so it neither loses digits from large numbers nor rounds
+// e.g. 1.005 down because its nearest float is 1.00499...
+func formatNumber(config *settings, value string) string {
+	if config.NumberPrecision == nil || *config.NumberPrecision < 0 || !strings.ContainsAny(value, ".eE") {
+		// Integer literals are already as precise as they need to be
+		return value
+	}
+	mantissa, exponent := value, 0
+	if e := strings.IndexAny(value, "eE"); e >= 0 {
+		var err error
+		mantissa = value[:e]
+		exponent, err = strconv.Atoi(value[e+1:])
+		if err != nil || exponent > 10000 || exponent < -10000 {
+			// Leave anything we can't parse (or wouldn't sensibly write out in full) alone
+			return value
+		}
+	}
+	negative := strings.HasPrefix(mantissa, "-")
+	mantissa = strings.TrimPrefix(mantissa, "-")
+	intPart, fracPart := mantissa, ""
+	if dot := strings.IndexByte(mantissa, '.'); dot >= 0 {
+		intPart, fracPart = mantissa[:dot], mantissa[dot+1:]
 	}
 
-	// Otherwise iterate over the properties & set them as appropriate
-	newMap := "%s"
-	for k, v := range docMap.Elements {
-		switch v.ElementType {
-		case DataTypeArray:
-			// Add an array item
-			subst, err := buildArray(v.ArrayContent)
-			if err != nil {
-				return "", err
-			}
-			if docMap.IsArray {
-				// Special case if root map has "IsArray" set
-				newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`[%s],%%s`, subst), -1)
+	// All the digits, and where the decimal point falls among them
+	digits := []byte(intPart + fracPart)
+	point := len(intPart) + exponent
+	if point < 0 {
+		digits = append([]byte(strings.Repeat("0", -point)), digits...)
+		point = 0
+	}
+	for len(digits) < point {
+		digits = append(digits, '0')
+	}
+
+	if keep := point + *config.NumberPrecision; keep < len(digits) {
+		roundUp := digits[keep] >= '5'
+		digits = digits[:keep]
+		for i := keep - 1; roundUp && i >= 0; i-- {
+			if digits[i] == '9' {
+				digits[i] = '0'
 			} else {
-				newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`"%s":[%s],%%s`, k, subst), -1)
-			}
-		case DataTypeMap:
-			// Add a sub-object
-			subst, err := buildMap(v.Content)
-			if err != nil {
-				return "", err
+				digits[i]++
+				roundUp = false
 			}
-			newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`"%s":{%s},%%s`, k, subst), -1)
-		case DataTypeString:
-			// Add a string property
-			newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`"%s":"%s",%%s`, k, escapeString(v.Value)), -1)
-		case DataTypeNumber:
-			// Add a numeric property
-			newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`"%s":%s,%%s`, k, v.Value), -1)
-		case DataTypeBool:
-			// Add a boolean property
-			newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`"%s":%s,%%s`, k, v.Value), -1)
-		case DataTypeNull:
-			// Add a named null property
-			newMap = strings.Replace(newMap, "%s", fmt.Sprintf(`"%s":null,%%s`, k), -1)
-		default:
-			// Unexpected data type - error
-			return "", fmt.Errorf("unexpected data type `%s` found in document map", v.ElementType)
-		}
-	}
-
-	// Truncate the trailing ",%s" and return
-	return strings.TrimSuffix(newMap, ",%s"), nil
-}
-
-// escapeString simply returns a string value, with internal quotes and backslashes escaped with backslashes; for use when the source jSON value
-// contained a string containing quotes and/or backslashes (e.g. a JSON string)
-func escapeString(input string) string {
-	// Escape backslashes and quotes in a string value
-	return strings.Replace(
-		strings.Replace(
-			input,
-			"\\",
-			"\\\\",
-			-1,
-		),
-		"\"",
-		"\\\"",
-		-1,
-	)
+		}
+		if roundUp {
+			// Carried all the way, e.g. 9.996 becoming 10.00
+			digits = append([]byte{'1'}, digits...)
+			point++
+		}
+	}
+
+	whole := strings.TrimLeft(string(digits[:point]), "0")
+	if whole == "" {
+		whole = "0"
+	}
+	fraction := strings.TrimRight(string(digits[point:]), "0")
+	rounded := whole
+	if fraction != "" {
+		rounded += "." + fraction
+	}
+	if negative && rounded != "0" {
+		rounded = "-" + rounded
+	}
+	return rounded
+}
+
+// escapeString returns a string value escaped for use inside a JSON string (without the surrounding quotes): quotes,
+// backslashes and control characters are escaped exactly as encoding/json would; as are <, > and & if EscapeHTML is set,
+// so the result can be embedded in HTML <script> tags.
+func escapeString(config *settings, input string) string {
+	if !needsEscaping(config, input) {
+		return input
+	}
+	var escaped bytes.Buffer
+	encoder := json.NewEncoder(&escaped)
+	encoder.SetEscapeHTML(config.EscapeHTML)
+	_ = encoder.Encode(input) // Encoding a string can't fail
+	// Strip the quotes, and the newline which Encode adds
+	encoded := escaped.Bytes()
+	return string(encoded[1 : len(encoded)-2])
+}
+
+// needsEscaping reports whether escapeString would change input, so plain ASCII - the usual case, for property names
+// especially - can be written as it is. Anything outside printable ASCII takes the slow path.
+func needsEscaping(config *settings, input string) bool {
+	for i := 0; i < len(input); i++ {
+		switch c := input[i]; {
+		case c < 0x20, c >= 0x80, c == '"', c == '\\':
+			return true
+		case config.EscapeHTML && (c == '<' || c == '>' || c == '&'):
+			return true
+		}
+	}
+	return false
 }
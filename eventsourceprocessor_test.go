@@ -2,8 +2,10 @@ package eventsourceprocessor_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
 
 	eventsourceprocessor "github.com/adev73/event-source-processor"
@@ -183,20 +185,1084 @@ func TestAddEvent6bToNotEmptyObject_Fails(t *testing.T) {
 	// Event 6a
 }
 
+func TestAddEvent6bToNotEmptyObjectAllowed(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.AllowReplaceNonEmptyBase = true })
+	inputDoc := buildDocument("TestAddEvent6", "base.json", []string{"event6b.json"})
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	that.Nil(err)
+	// Event 6b replaced everything in the base document
+	that.Contains(string(outputDoc), `"id":"some-uuid-we-generated"`)
+	that.NotContains(string(outputDoc), `"stringField"`)
+}
+
+func TestReplaceNonEmptyArrayBaseAllowed(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.AllowReplaceNonEmptyBase = true })
+	inputDoc := inlineDocument(`[1,2,3]`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"reset":true}`},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"reset":true}`, string(outputDoc))
+}
+
+func TestReplaceNonEmptyBaseByDefault_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":1}`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: `[1]`},
+	)
+	_, err := inputDoc.GetCurrentState()
+
+	that.True(errors.Is(err, eventsourceprocessor.ErrReplaceNonEmptyBase))
+}
+
 func TestAddEvent6cToEmptyObject(t *testing.T) {
 	that := assert.New(t)
-	inputDoc := buildDocument("TestAddEvent6c", "emptyBase.json", []string{"event6c.json"})
-	outputDoc, err := inputDoc.GetCurrentState()
-	prettyPrintObject("Input Document", inputDoc)
-	prettyPrint("Output Document", outputDoc)
+	inputDoc := buildDocument("TestAddEvent6c", "emptyBase.json", []string{"event6c.json"})
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrintObject("Input Document", inputDoc)
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	// Event 6c
+	that.Equal(string(outputDoc), `["ArrayElement1","ArrayElement2"]`)
+}
+
+func TestAddEvent7WithCurlyArrayDelimiters(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.ArrayDelimiters = eventsourceprocessor.ArrayDelimiters{Open: '{', Close: '}'}
+	})
+	inputDoc := buildDocument("TestAddEvent7WithCurlyArrayDelimiters", "base.json", []string{"event7.json"})
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrintObject("Input Document", inputDoc)
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	// Event 7
+	that.NotContains(string(outputDoc), `"arrayObjectId":0`) // Removed via {first}
+	that.Contains(string(outputDoc), `"arrayObjectId":1`)    // Was already there
+	that.Contains(string(outputDoc), `"arrayObjectId":2`)    // ...should have been added via {new}
+}
+
+func TestAddEvent7WithDefaultArrayDelimiters_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestAddEvent7WithDefaultArrayDelimiters_Fails", "base.json", []string{"event7.json"})
+	_, err := inputDoc.GetCurrentState()
+
+	// `{first}` is just part of a property name with the default delimiters, so the remove can't find it
+	that.NotNil(err)
+}
+
+func TestSetOnlyInsideScalarArrayElement_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["a","b"]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items[first].x",
+		ActionType: eventsourceprocessor.ActionTypeSetOnly,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "nope",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "cannot descend into scalar array element")
+	}
+}
+
+func TestNumberPrecision(t *testing.T) {
+	that := assert.New(t)
+	precision := 2
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.NumberPrecision = &precision
+	})
+	inputDoc := inlineDocument(`{"pi":3.14159,"half":0.5,"count":42,"big":10000000000000001,"list":[1.005,2.999,-7.126,10,9.999,-0.001,1.2345e2,5e-3,1E+2]}`)
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"pi":3.14`)
+	that.Contains(string(outputDoc), `"half":0.5`)
+	that.Contains(string(outputDoc), `"count":42`)
+	that.NotContains(string(outputDoc), `"count":42.`)          // Integers don't grow decimals
+	that.Contains(string(outputDoc), `"big":10000000000000001`) // Integers aren't rounded through a float64
+	// Rounded on the decimal digits, so 1.005 rounds up; exponents are written out in full
+	that.Contains(string(outputDoc), `"list":[1.01,3,-7.13,10,10,0,123.45,0.01,100]`)
+}
+
+func TestNumberPrecisionNotSet(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"pi":3.14159,"list":[1.005,true,null,"x"]}`)
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong, and full precision is kept
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"pi":3.14159`)
+	that.Contains(string(outputDoc), `"list":[1.005,true,null,"x"]`)
+}
+
+func TestGetCurrentStateLazyLoadsBaseForEvents(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGetCurrentStateLazyLoadsBaseForEvents", "emptyBase.json", []string{"event1.json"})
+	calls := 0
+	outputDoc, err := inputDoc.GetCurrentStateLazy(func() ([]byte, error) {
+		calls++
+		return loadFile("./test_data/base.json")
+	})
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong, and the events were applied to the lazily loaded base
+	that.Nil(err)
+	that.Equal(1, calls)
+	that.Contains(string(outputDoc), `"masterId":"123"`)
+	that.Contains(string(outputDoc), `"newFieldFromEvent1":"Event 1 adds this field"`)
+}
+
+func TestGetCurrentStateLazySkipsBaseWithoutEvents(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGetCurrentStateLazySkipsBaseWithoutEvents", "emptyBase.json", nil)
+	loadBase := func() ([]byte, error) {
+		t.Fatal("base document should not be loaded when there are no events")
+		return nil, nil
+	}
+
+	outputDoc, err := inputDoc.GetCurrentStateLazy(loadBase)
+	that.Nil(err)
+	that.Empty(outputDoc)
+
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.LazyNoEventsResultIsNull = true
+	})
+	outputDoc, err = inputDoc.GetCurrentStateLazy(loadBase)
+	that.Nil(err)
+	that.Equal("null", string(outputDoc))
+}
+
+func TestGetCurrentStateLazyLoadFailure_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGetCurrentStateLazyLoadFailure_Fails", "emptyBase.json", []string{"event1.json"})
+	_, err := inputDoc.GetCurrentStateLazy(func() ([]byte, error) {
+		return nil, errors.New("store unavailable")
+	})
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "store unavailable")
+	}
+}
+
+func TestReplaceAtIndex(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["zero","one","two"]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items[1]",
+		ActionType: eventsourceprocessor.ActionTypeReplaceAt,
+		DataType:   eventsourceprocessor.DataTypeMap,
+		Value:      `{"replaced":true}`,
+	})
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Equal(`{"items":["zero",{"replaced":true},"two"]}`, string(outputDoc))
+}
+
+func TestReplaceAtIndexOutOfRange_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["zero","one","two"]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items[3]",
+		ActionType: eventsourceprocessor.ActionTypeReplaceAt,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "three",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	// No silent append
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "array index 3 is out of range")
+	}
+}
+
+func TestReplaceAtNonNumericIndex_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["zero"]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items[new]",
+		ActionType: eventsourceprocessor.ActionTypeReplaceAt,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "one",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	that.NotNil(err)
+}
+
+func TestNumericIndexer(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"lineItems":[{"price":1},{"price":2},{"price":3}]}`,
+		eventsourceprocessor.EventInstruction{Path: "lineItems[1].price", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNumber, Value: "20"},
+		eventsourceprocessor.EventInstruction{Path: "lineItems[2]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "two"},
+		// The next free slot is appended
+		eventsourceprocessor.EventInstruction{Path: "lineItems[3].price", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "4"},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"lineItems":[{"price":1},{"price":20},"two",{"price":4}]}`, string(outputDoc))
+}
+
+func TestLastIndexer(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"myArray":[{"field":1},{"field":2}],"a":[[1],[2,3]],"empty":[],"nested":[]}`,
+		eventsourceprocessor.EventInstruction{Path: "myArray[last].field", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNumber, Value: "20"},
+		eventsourceprocessor.EventInstruction{Path: "a[last][last]", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNumber, Value: "30"},
+		// An empty array gets a new element
+		eventsourceprocessor.EventInstruction{Path: "empty[last].field", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "new"},
+		eventsourceprocessor.EventInstruction{Path: "nested[last][last]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "new"},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"myArray":[{"field":1},{"field":20}],"a":[[1],[2,30]],"empty":[{"field":"new"}],"nested":[["new"]]}`, string(outputDoc))
+}
+
+func TestLastIndexerEmptyArray_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"myArray":[]}`, eventsourceprocessor.EventInstruction{
+		Path:       "myArray[last].field",
+		ActionType: eventsourceprocessor.ActionTypeSetOnly,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "value",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Equal("event[0] (id=00000000-0000-0000-0000-000000000000) instruction[0] path `myArray[last].field`: array is empty: array `myArray` has no last element", err.Error())
+	}
+}
+
+func TestNumericIndexerRead(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"orders":[{"totals":[1]},{"totals":[2,3]}]}`)
+	sum, err := inputDoc.Sum("orders[1].totals")
+
+	that.Nil(err)
+	that.Equal(float64(5), sum)
+}
+
+func TestNumericIndexerOutOfRange_Fails(t *testing.T) {
+	that := assert.New(t)
+	for _, instruction := range []eventsourceprocessor.EventInstruction{
+		// SetOnly can't append
+		{Path: "items[2]", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "two"},
+		// SetOrAdd can only append to the next free slot
+		{Path: "items[3]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "three"},
+		{Path: "items[-1]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "minus one"},
+	} {
+		inputDoc := inlineDocument(`{"items":["zero","one"]}`, instruction)
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err, instruction.Path) {
+			that.Contains(err.Error(), "is out of range, array `items` has 2 elements", instruction.Path)
+		}
+	}
+}
+
+func twoAppendsInOneEvent() eventsourceprocessor.Document {
+	return inlineDocument(`{"items":["existing"]}`,
+		eventsourceprocessor.EventInstruction{Path: "items[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "first append"},
+		eventsourceprocessor.EventInstruction{Path: "items[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "second append"},
+	)
+}
+
+func TestArraySelectorsLive(t *testing.T) {
+	that := assert.New(t)
+	outputDoc, err := twoAppendsInOneEvent().GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Each [new] sees the array as changed by the instruction before it
+	that.Nil(err)
+	that.Equal(`{"items":["existing","first append","second append"]}`, string(outputDoc))
+}
+
+func TestArraySelectorsSnapshot(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.ArraySelectorMode = eventsourceprocessor.ArraySelectorModeSnapshot
+	})
+	inputDoc := twoAppendsInOneEvent()
+	// A second event gets a fresh snapshot, so it appends again
+	inputDoc.Events = append(inputDoc.Events, eventsourceprocessor.DocumentEvent{
+		Instructions: []eventsourceprocessor.EventInstruction{
+			{Path: "items[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "next event"},
+		},
+	})
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Both [new]s in the first event refer to the same new element, so the second overwrites the first
+	that.Nil(err)
+	that.Equal(`{"items":["existing","second append","next event"]}`, string(outputDoc))
+}
+
+func TestArraySelectorsSnapshotNewElementFields(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.ArraySelectorMode = eventsourceprocessor.ArraySelectorModeSnapshot
+	})
+	inputDoc := inlineDocument(`{"items":[]}`,
+		eventsourceprocessor.EventInstruction{Path: "items[new].id", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "1"},
+		eventsourceprocessor.EventInstruction{Path: "items[new].name", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "one"},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Snapshot mode lets one event build up a single new element field by field
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"id":1`)
+	that.Contains(string(outputDoc), `"name":"one"`)
+	that.NotContains(string(outputDoc), `},{`)
+}
+
+func TestMalformedPathSegments_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, path := range []string{"items[first]extra[new]", "items]", "items[", "items[first]]", "items[[first]]", "a.b]c.d", "items[first]x"} {
+		inputDoc := inlineDocument(`{"items":[{"extra":[]}]}`, eventsourceprocessor.EventInstruction{
+			Path:       path,
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "value",
+		})
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err, path) {
+			that.Contains(err.Error(), "malformed path segment", path)
+		}
+	}
+}
+
+func TestWellFormedPathSegments(t *testing.T) {
+	that := assert.New(t)
+	for _, path := range []string{"items[first].extra[new]", "items[new][new]", "plain", "objectField.nested"} {
+		inputDoc := inlineDocument(`{"items":[{"extra":[]}]}`, eventsourceprocessor.EventInstruction{
+			Path:       path,
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "value",
+		})
+		_, err := inputDoc.GetCurrentState()
+
+		that.Nil(err, path)
+	}
+}
+
+func TestGetCurrentStateInto(t *testing.T) {
+	that := assert.New(t)
+	type address struct {
+		City string `json:"city"`
+	}
+	type customer struct {
+		Name    string   `json:"name"`
+		Address address  `json:"address"`
+		Tags    []string `json:"tags"`
+		Visits  int      `json:"visits"`
+	}
+	inputDoc := inlineDocument(`{"name":"someone","address":{"city":"Leeds"},"tags":["new"],"visits":1}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "address.city",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "York",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "tags[new]",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "returning",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "visits",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeNumber,
+			Value:      "2",
+		},
+	)
+	var result customer
+	err := inputDoc.GetCurrentStateInto(&result)
+
+	that.Nil(err)
+	that.Equal(customer{Name: "someone", Address: address{City: "York"}, Tags: []string{"new", "returning"}, Visits: 2}, result)
+}
+
+func TestGetCurrentStateIntoMismatchedType_Fail(t *testing.T) {
+	that := assert.New(t)
+	var result struct {
+		Name int `json:"name"`
+	}
+	err := inlineDocument(`{"name":"someone"}`).GetCurrentStateInto(&result)
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "unable to decode current state")
+	}
+}
+
+func rootReplaceThenAppend() []eventsourceprocessor.EventInstruction {
+	return []eventsourceprocessor.EventInstruction{
+		{
+			Path:       "",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeArray,
+			Value:      `["ArrayElement1",{"name":"ArrayElement2"}]`,
+		},
+		{
+			Path:       "[new]",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "ArrayElement3",
+		},
+		{
+			Path:       "[new].name",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "ArrayElement4",
+		},
+		{
+			Path:       "[first]",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "ArrayElement0",
+		},
+	}
+}
+
+func TestRootArrayAppendAfterReplace(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, rootReplaceThenAppend()...)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`["ArrayElement0",{"name":"ArrayElement2"},"ArrayElement3",{"name":"ArrayElement4"}]`, string(result))
+}
+
+func TestRootArrayAppendAfterReplaceInLaterEvent(t *testing.T) {
+	that := assert.New(t)
+	instructions := rootReplaceThenAppend()
+	inputDoc := inlineDocument(`{}`, instructions[0])
+	inputDoc.Events = append(inputDoc.Events, eventsourceprocessor.DocumentEvent{Instructions: instructions[1:]})
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`["ArrayElement0",{"name":"ArrayElement2"},"ArrayElement3",{"name":"ArrayElement4"}]`, string(result))
+}
+
+func TestRootArrayAppendAfterReplaceSnapshotMode(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.ArraySelectorMode = eventsourceprocessor.ArraySelectorModeSnapshot
+	})
+	instructions := rootReplaceThenAppend()
+	// In snapshot mode, both [new] selectors refer to the same new element - so only set it once
+	inputDoc := inlineDocument(`{}`, instructions[0], instructions[2], instructions[3])
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`["ArrayElement0",{"name":"ArrayElement2"},{"name":"ArrayElement4"}]`, string(result))
+}
+
+func TestArrayWithoutSelector_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, actionType := range []eventsourceprocessor.ActionType{eventsourceprocessor.ActionTypeSetOrAdd, eventsourceprocessor.ActionTypeSetOnly} {
+		inputDoc := inlineDocument(`{"items":[{"field":"value"}]}`, eventsourceprocessor.EventInstruction{
+			Path:       "items.field",
+			ActionType: actionType,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "newValue",
+		})
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err, actionType) {
+			that.Equal("event[0] (id=00000000-0000-0000-0000-000000000000) instruction[0] path `items.field`: array `items` requires a selector before `field`, e.g. `items[first].field` (or set ImplicitFirstSelector=true)", err.Error())
+		}
+	}
+}
+
+func TestRemoveFromArrayWithoutSelector_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":[{"field":"value"}]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items.field",
+		ActionType: eventsourceprocessor.ActionTypeRemove,
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Equal("event[0] (id=00000000-0000-0000-0000-000000000000) instruction[0] path `items.field`: array `items` requires a selector before `field`, e.g. `items[first].field` (or set ImplicitFirstSelector=true)", err.Error())
+	}
+}
+
+func TestArrayWithoutSelectorImplicitFirst(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.ImplicitFirstSelector = true })
+	inputDoc := inlineDocument(`{"items":[{"field":"value","other":1},{"field":"second"}]}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "items.field",
+			ActionType: eventsourceprocessor.ActionTypeSetOnly,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "newValue",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "items.other",
+			ActionType: eventsourceprocessor.ActionTypeRemove,
+		},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"items":[{"field":"newValue"},{"field":"second"}]}`, string(result))
+}
+
+func TestArrayWithoutSelectorImplicitFirstEmptyArray(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.ImplicitFirstSelector = true })
+	inputDoc := inlineDocument(`{"items":[]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items.field",
+		ActionType: eventsourceprocessor.ActionTypeSetOnly,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "newValue",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	that.NotNil(err)
+}
+
+func TestMaxDepthBaseDocument(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.MaxDepth = 3 })
+
+	_, err := inlineDocument(`{"a":{"b":[1,2]}}`).GetCurrentState()
+	that.Nil(err)
+
+	for _, base := range []string{`{"a":{"b":{"c":{}}}}`, `{"a":[[[1]]]}`, `[[{"c":[]}]]`} {
+		_, err = inlineDocument(base).GetCurrentState()
+		if that.NotNil(err, base) {
+			that.Equal("document is nested more than 3 levels deep", err.Error(), base)
+		}
+	}
+}
+
+func TestMaxDepthInstructionValue_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.MaxDepth = 2 })
+	inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{
+		Path:       "field",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeMap,
+		Value:      `{"a":{"b":{}}}`,
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	that.NotNil(err)
+}
+
+func TestAppendEvent(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"new","items":[]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items[new]",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "first",
+	})
+
+	state, updated, err := inputDoc.AppendEvent(setEvent(2, "status", "pending"))
+	that.Nil(err)
+	that.JSONEq(`{"status":"pending","items":["first"]}`, string(state))
+	that.Equal(inputDoc.EntityId, updated.EntityId)
+	that.Equal(state, updated.BaseDocument)
+	that.Empty(updated.Events)
+	that.Len(inputDoc.Events, 1)
+
+	state, updated, err = updated.AppendEvent(appendEvent(3, "items", "second"))
+	that.Nil(err)
+	that.JSONEq(`{"status":"pending","items":["first","second"]}`, string(state))
+	that.Equal(state, updated.BaseDocument)
+	that.Empty(updated.Events)
+}
+
+func TestAppendEventInvalid_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"new"}`)
+	event := setEvent(2, "missing", "value")
+	event.Instructions[0].ActionType = eventsourceprocessor.ActionTypeSetOnly
+
+	state, updated, err := inputDoc.AppendEvent(event)
+
+	that.NotNil(err)
+	that.Nil(state)
+	that.Equal(inputDoc, updated)
+}
+
+func TestCustomDataTypeEncoder(t *testing.T) {
+	that := assert.New(t)
+	decimalPattern := regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.Encoders = map[eventsourceprocessor.DataType]eventsourceprocessor.DataTypeEncoder{
+			"decimal": func(value string) (string, error) {
+				if !decimalPattern.MatchString(value) {
+					return "", errors.New("not a decimal")
+				}
+				return value, nil
+			},
+		}
+	})
+	inputDoc := inlineDocument(`{"name":"someone","history":[]}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "price",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   "decimal",
+			Value:      "1.10",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "history[new]",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   "decimal",
+			Value:      "0.30",
+		},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.Contains(string(result), `"price":1.10`)
+	that.Contains(string(result), `"history":[0.30]`)
+	that.JSONEq(`{"name":"someone","price":1.1,"history":[0.3]}`, string(result))
+
+	inputDoc.Events[0].Instructions[0].Value = "1.1O"
+	_, err = inputDoc.GetCurrentState()
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "unable to encode decimal value `1.1O`")
+	}
+}
+
+func TestSetOnlyPreservesType(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.SetOnlyPreservesType = true })
+	setOnly := func(dataType eventsourceprocessor.DataType, value string) eventsourceprocessor.Document {
+		return inlineDocument(`{"code":"A1","items":[{"qty":1}]}`,
+			eventsourceprocessor.EventInstruction{
+				Path:       "code",
+				ActionType: eventsourceprocessor.ActionTypeSetOnly,
+				DataType:   dataType,
+				Value:      value,
+			},
+			eventsourceprocessor.EventInstruction{
+				Path:       "items[first].qty",
+				ActionType: eventsourceprocessor.ActionTypeSetOnly,
+				DataType:   eventsourceprocessor.DataTypeNumber,
+				Value:      "2",
+			},
+		)
+	}
+
+	result, err := setOnly(eventsourceprocessor.DataTypeString, "B2").GetCurrentState()
+	that.Nil(err)
+	that.JSONEq(`{"code":"B2","items":[{"qty":2}]}`, string(result))
+
+	_, err = setOnly(eventsourceprocessor.DataTypeNumber, "42").GetCurrentState()
+	if that.NotNil(err) {
+		that.Equal("event[0] (id=00000000-0000-0000-0000-000000000000) instruction[0] path `code`: `code` is a string, and SetOnly may not change it to a float64", err.Error())
+	}
+}
+
+func TestBaseDocumentWithBOM(t *testing.T) {
+	that := assert.New(t)
+	for _, base := range []string{"\xef\xbb\xbf{\"name\":\"someone\"}", " \r\n\xef\xbb\xbf\t{\"name\":\"someone\"}\n\n"} {
+		inputDoc := inlineDocument(base, eventsourceprocessor.EventInstruction{
+			Path:       "status",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "active",
+		})
+		result, err := inputDoc.GetCurrentState()
+
+		that.Nil(err)
+		that.JSONEq(`{"name":"someone","status":"active"}`, string(result))
+	}
+}
+
+func TestWithComputedBaseFrom(t *testing.T) {
+	that := assert.New(t)
+	parent := inlineDocument(`{"brand":"Acme","settings":{"currency":"GBP"}}`, eventsourceprocessor.EventInstruction{
+		Path:       "settings.locale",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "en-GB",
+	})
+	child := eventsourceprocessor.Document{
+		EntityId: "store-42",
+		Events: []eventsourceprocessor.DocumentEvent{
+			setEvent(1, "settings.currency", "EUR"),
+			setEvent(2, "store", "Paris"),
+		},
+	}
+
+	combined, err := child.WithComputedBaseFrom(parent)
+	that.Nil(err)
+	that.Equal(child.EntityId, combined.EntityId)
+	that.Nil(child.BaseDocument)
+
+	result, err := combined.GetCurrentState()
+	that.Nil(err)
+	that.JSONEq(`{"brand":"Acme","settings":{"currency":"EUR","locale":"en-GB"},"store":"Paris"}`, string(result))
+}
+
+func TestWithComputedBaseFromInvalid_Fail(t *testing.T) {
+	that := assert.New(t)
+	parent := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly})
+	_, err := inlineDocument(`{}`).WithComputedBaseFrom(parent)
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "unable to compute base document")
+	}
+}
+
+func recentActivityDocument() eventsourceprocessor.Document {
+	return eventsourceprocessor.Document{
+		BaseDocument: []byte(`{"recent":["a","b"]}`),
+		Events: []eventsourceprocessor.DocumentEvent{
+			appendEvent(1, "recent", "c"),
+			appendEvent(2, "recent", "d"),
+			appendEvent(3, "recent", "e"),
+		},
+	}
+}
+
+func TestMaxArrayLengthError_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.MaxArrayLength = 3 })
+	_, err := recentActivityDocument().GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Equal("event[1] (id=00000000-0000-0000-0000-000000000000) instruction[0] path `recent[new]`: array `recent` already has the maximum of 3 elements", err.Error())
+	}
+}
+
+func TestMaxArrayLengthDropOldest(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.MaxArrayLength = 3
+		c.ArrayOverflowMode = eventsourceprocessor.ArrayOverflowDropOldest
+	})
+	result, err := recentActivityDocument().GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"recent":["c","d","e"]}`, string(result))
+}
+
+func TestMaxArrayLengthDropOldestSnapshotMode(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.MaxArrayLength = 2
+		c.ArrayOverflowMode = eventsourceprocessor.ArrayOverflowDropOldest
+		c.ArraySelectorMode = eventsourceprocessor.ArraySelectorModeSnapshot
+	})
+	inputDoc := inlineDocument(`{"recent":[{"id":1},{"id":2}]}`,
+		eventsourceprocessor.EventInstruction{Path: "recent[new].id", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "3"},
+		eventsourceprocessor.EventInstruction{Path: "recent[new].by", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "someone"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"recent":[{"id":2},{"id":3,"by":"someone"}]}`, string(result))
+}
+
+func TestRootArrayHolderNotAddressable_Fail(t *testing.T) {
+	that := assert.New(t)
+	instructions := []eventsourceprocessor.EventInstruction{
+		{Path: "array[first]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+		{Path: "array[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+		{Path: "Array", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: "[]"},
+		{Path: "array", ActionType: eventsourceprocessor.ActionTypeRemove},
+		{Path: "array[first]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		{Path: "name", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+	}
+	for _, instruction := range instructions {
+		_, err := inlineDocument(`["a","b"]`, instruction).GetCurrentState()
+
+		if that.NotNil(err, instruction.Path) {
+			that.Contains(err.Error(), "the document is an array, so has no property", instruction.Path)
+		}
+	}
+}
+
+func TestParentPathSegments(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":{"b":{"c":"old"},"d":"old"},"items":[{"x":1}]}`,
+		eventsourceprocessor.EventInstruction{Path: "a.b.^.d", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "new"},
+		eventsourceprocessor.EventInstruction{Path: "a.b.c.^.^.e", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "added"},
+		eventsourceprocessor.EventInstruction{Path: "items[first].^.a.b", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "a.^.top", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeBool, Value: "true"},
+	)
+	result, err := inputDoc.GetCurrentState()
 
-	// Nothing unexpected went wrong
 	that.Nil(err)
-	// Event 6c
-	that.Equal(string(outputDoc), `["ArrayElement1","ArrayElement2"]`)
+	that.JSONEq(`{"a":{"d":"new","e":"added"},"items":[{"x":1}],"top":true}`, string(result))
+}
+
+func TestParentPathSegmentAboveRoot_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, path := range []string{"^", "^.a", "a.^.^.b", "a.b.^.^.^"} {
+		inputDoc := inlineDocument(`{"a":{"b":1}}`, eventsourceprocessor.EventInstruction{
+			Path:       path,
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "value",
+		})
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err, path) {
+			that.Contains(err.Error(), "refers to the parent of the document root", path)
+		}
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":[]}`,
+		eventsourceprocessor.EventInstruction{Path: "comment", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: `<script>alert("a & b")</script>`},
+		eventsourceprocessor.EventInstruction{Path: "items[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "<b>"},
+	)
+
+	result, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	that.Contains(string(result), `"comment":"<script>alert(\"a & b\")</script>"`)
+	that.Contains(string(result), `"items":["<b>"]`)
+
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.EscapeHTML = true })
+	result, err = inputDoc.GetCurrentState()
+	that.Nil(err)
+	that.Contains(string(result), `"comment":"\u003cscript\u003ealert(\"a \u0026 b\")\u003c/script\u003e"`)
+	that.Contains(string(result), `"items":["\u003cb\u003e"]`)
+	that.NotContains(string(result), "<")
+
+	// Either way, the values are the same once decoded
+	var decoded map[string]interface{}
+	that.Nil(json.Unmarshal(result, &decoded))
+	that.Equal(`<script>alert("a & b")</script>`, decoded["comment"])
+}
+
+func numberTokensDocument() eventsourceprocessor.Document {
+	return inlineDocument(`{"price":1.10,"id":9007199254740993,"history":[1.10,9007199254740993]}`,
+		eventsourceprocessor.EventInstruction{Path: "order", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"total":20.50,"lines":[1.10,1e2]}`},
+		eventsourceprocessor.EventInstruction{Path: "history[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "2.50"},
+	)
+}
+
+func TestPreserveNumberTokens(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.PreserveNumberTokens = true })
+	result, err := numberTokensDocument().GetCurrentState()
+
+	that.Nil(err)
+	that.Contains(string(result), `"price":1.10`)
+	that.Contains(string(result), `"id":9007199254740993`)
+	that.Contains(string(result), `"history":[1.10,9007199254740993,2.50]`)
+	that.Contains(string(result), `"total":20.50`)
+	that.Contains(string(result), `"lines":[1.10,1e2]`)
+}
+
+func TestWithoutPreserveNumberTokens(t *testing.T) {
+	that := assert.New(t)
+	result, err := numberTokensDocument().GetCurrentState()
+
+	// Numbers from JSON pass through float64 - apart from integers, which are kept exactly
+	that.Nil(err)
+	that.Contains(string(result), `"price":1.1`)
+	that.Contains(string(result), `"id":9007199254740993`)
+	that.Contains(string(result), `"lines":[1.1,100]`)
+}
+
+func TestIntegersSurviveRoundTrip(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"id":10000000000000001,"ids":[10000000000000001,-12345678901234567890],"count":2}`,
+		eventsourceprocessor.EventInstruction{Path: "nested", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"id":10000000000000001}`},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.Equal(`{"count":2,"id":10000000000000001,"ids":[10000000000000001,-12345678901234567890],"nested":{"id":10000000000000001}}`, string(result))
+}
+
+func TestOutOfRangeNumber_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := inlineDocument(`{"huge":1e400}`).GetCurrentState()
+
+	that.NotNil(err)
+}
+
+func TestPreserveNumberTokensTrailingData_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.PreserveNumberTokens = true })
+	_, err := inlineDocument(`{"a":1} {"b":2}`).GetCurrentState()
+
+	that.NotNil(err)
+}
+
+func TestStrayClosingDelimiter_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, base := range []string{`{"a":1}}`, `[1]]`, `{"a":1}]`, `"x"}`} {
+		_, err := inlineDocument(base).GetCurrentState()
+		that.Error(err, base)
+	}
+}
+
+func TestSkipEmptyArrayCreation(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.SkipEmptyArrayCreation = true })
+	inputDoc := inlineDocument(`{"name":"someone","tags":["a"]}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: "[]"},
+		eventsourceprocessor.EventInstruction{Path: "deep.missing", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: " [ ] "},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"name":"someone","tags":["a"]}`, string(result))
+}
+
+func TestSkipEmptyArrayCreationStillSetsExisting(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.SkipEmptyArrayCreation = true })
+	inputDoc := inlineDocument(`{"tags":["a"]}`,
+		eventsourceprocessor.EventInstruction{Path: "tags", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: "[]"},
+		eventsourceprocessor.EventInstruction{Path: "ids", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: "[1]"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"tags":[],"ids":[1]}`, string(result))
+}
+
+func TestEmptyArrayCreation(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: "[]"},
+		eventsourceprocessor.EventInstruction{Path: "Appended[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "a"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"missing":[],"Appended":["a"]}`, string(result))
+}
+
+func TestRootShapeTransitions(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		// object -> array
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: `["a"]`},
+		eventsourceprocessor.EventInstruction{Path: "[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "b"},
+		// Emptying the array allows it to be replaced in turn: array -> object
+		eventsourceprocessor.EventInstruction{Path: "[all]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"name":"someone"}`},
+		eventsourceprocessor.EventInstruction{Path: "status", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "active"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"name":"someone","status":"active"}`, string(result))
+}
+
+func TestRootScalarReplacesEmptyBase(t *testing.T) {
+	that := assert.New(t)
+	cases := []struct {
+		base        string
+		instruction eventsourceprocessor.EventInstruction
+		expected    string
+	}{
+		{`{}`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "bare string"}, `"bare string"`},
+		{`[]`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "42.5"}, `42.5`},
+		{``, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeBool, Value: "true"}, `true`},
+		{`[]`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNull}, `null`},
+	}
+	for _, c := range cases {
+		result, err := inlineDocument(c.base, c.instruction).GetCurrentState()
+
+		if that.Nil(err, c.base) {
+			that.Equal(c.expected, string(result), c.base)
+		}
+	}
+}
+
+func TestRootScalarReplacesNonEmptyBase(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.AllowReplaceNonEmptyBase = true })
+	inputDoc := inlineDocument(`{"a":1}`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "first"},
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "second"},
+	)
+
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.Equal(`"second"`, string(result))
+}
+
+func TestRootIncrement(t *testing.T) {
+	that := assert.New(t)
+	result, err := inlineDocument(`41`, incrementInstruction("", "1")).GetCurrentState()
+	if that.Nil(err) {
+		that.Equal(`42`, string(result))
+	}
+
+	_, err = inlineDocument(`{}`, incrementInstruction("", "5")).GetCurrentState()
+	that.ErrorContains(err, "the document is a map, so can't be incremented")
+}
+
+func TestRootPositionalActions_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, actionType := range []eventsourceprocessor.ActionType{eventsourceprocessor.ActionTypeInsertAt, eventsourceprocessor.ActionTypeReplaceAt} {
+		_, err := inlineDocument(`[]`, eventsourceprocessor.EventInstruction{Path: "", ActionType: actionType, DataType: eventsourceprocessor.DataTypeString, Value: "x"}).GetCurrentState()
+
+		that.ErrorContains(err, "action needs a path ending with a numeric array index", actionType)
+	}
+}
+
+func TestRootShapeTransitionsInvalid_Fail(t *testing.T) {
+	that := assert.New(t)
+	cases := []struct {
+		base        string
+		instruction eventsourceprocessor.EventInstruction
+		message     string
+	}{
+		{`["a"]`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{}`}, "can't replace non-empty base document"},
+		{`{"a":1}`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: `[]`}, "can't replace non-empty base document"},
+		{`{"a":1}`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "scalar"}, "can't replace non-empty base document"},
+		{`[1]`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "1"}, "can't replace non-empty base document"},
+		{`{"a":{}}`, eventsourceprocessor.EventInstruction{Path: "a.^", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNull}, "can't replace non-empty base document"},
+		{`{}`, eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: "widget", Value: "w"}, "can only be replaced by a map, array, string, number, bool or null, not a widget"},
+	}
+	for _, c := range cases {
+		_, err := inlineDocument(c.base, c.instruction).GetCurrentState()
+
+		if that.NotNil(err, c.base) {
+			that.Contains(err.Error(), c.message, c.base)
+		}
+	}
 }
 
 // Helper functions
+func configure(t *testing.T, change func(*eventsourceprocessor.Configuration)) {
+	// Apply a configuration change for the duration of a single test
+	previous := eventsourceprocessor.Configure(nil)
+	updated := previous
+	change(&updated)
+	eventsourceprocessor.Configure(&updated)
+	t.Cleanup(func() {
+		eventsourceprocessor.Configure(&previous)
+	})
+}
+
 func prettyPrint(description string, doc []byte) {
 	if !debugOutput {
 		return
@@ -244,7 +1310,368 @@ func buildDocument(caller string, baseFile string, eventFiles []string) eventsou
 	return theDocument
 }
 
+func inlineDocument(base string, instructions ...eventsourceprocessor.EventInstruction) eventsourceprocessor.Document {
+	// Build a document with a single event from an inline base document
+	return eventsourceprocessor.Document{
+		BaseDocument: []byte(base),
+		Events: []eventsourceprocessor.DocumentEvent{
+			{Instructions: instructions},
+		},
+	}
+}
+
 func loadFile(fileName string) ([]byte, error) {
 	// Attempt to load the file. If we faile, return an error
 	return os.ReadFile(fileName)
 }
+
+func TestValueContainingFormatVerb(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["50%s"],"other":"x"}`,
+		eventsourceprocessor.EventInstruction{Path: "confidence", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "100%s sure"},
+		eventsourceprocessor.EventInstruction{Path: "items[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "%s%%s"},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	var decoded map[string]interface{}
+	that.Nil(json.Unmarshal(outputDoc, &decoded))
+	that.Equal("100%s sure", decoded["confidence"])
+	that.Equal([]interface{}{"50%s", "%s%%s"}, decoded["items"])
+	that.Equal("x", decoded["other"])
+}
+
+func TestValueContainingControlCharacters(t *testing.T) {
+	that := assert.New(t)
+	value := "line one\nline two\tand a tab\r\b\f\x01\x1f \"quoted\" \\ done"
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "text", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: value},
+		eventsourceprocessor.EventInstruction{Path: "lines[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: value},
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	var decoded map[string]interface{}
+	that.Nil(json.Unmarshal(outputDoc, &decoded))
+	that.Equal(value, decoded["text"])
+	that.Equal([]interface{}{value}, decoded["lines"])
+}
+
+func TestKeysContainingSpecialCharacters(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a\"b":1,"back\\slash":{"new\nline":true}}`,
+		scalarSet("tab\there", "x"),
+		scalarSet("back\\slash.quote\"d", "y"),
+	)
+	outputDoc, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	var decoded map[string]interface{}
+	if that.Nil(json.Unmarshal(outputDoc, &decoded), string(outputDoc)) {
+		that.Equal(map[string]interface{}{
+			"a\"b":        1.0,
+			"back\\slash": map[string]interface{}{"new\nline": true, "quote\"d": "y"},
+			"tab\there":   "x",
+		}, decoded)
+	}
+}
+
+func TestInvalidBoolValue_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"active":true}`, eventsourceprocessor.EventInstruction{Path: "active", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeBool, Value: "maybe"})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+		that.Contains(err.Error(), "`maybe` is not a valid bool value")
+	}
+}
+
+func TestInvalidNumberValue_Fails(t *testing.T) {
+	that := assert.New(t)
+	for _, value := range []string{"12abc", "Inf", "0x10", ""} {
+		inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{Path: "price", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: value})
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err, value) {
+			that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType), value)
+			that.Contains(err.Error(), "`"+value+"` is not a valid float64 value")
+		}
+	}
+}
+
+func TestBoolValueIsNormalised(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{Path: "active", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeBool, Value: "TRUE"})
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"active":true}`, string(result))
+}
+
+func TestSetObjectToNullClearsContent(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"field":{"a":1,"b":[1,2]},"list":[{"c":3}]}`,
+		eventsourceprocessor.EventInstruction{Path: "field", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNull},
+		eventsourceprocessor.EventInstruction{Path: "list", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNull},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"field":null,"list":null}`, string(result))
+
+	// Nothing can be found beneath the null
+	inputDoc.Events[0].Instructions = append(inputDoc.Events[0].Instructions,
+		eventsourceprocessor.EventInstruction{Path: "field.a", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeNumber, Value: "2"})
+	_, err = inputDoc.GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+}
+
+func TestScalarBaseDocumentRoundTrip(t *testing.T) {
+	that := assert.New(t)
+	for _, base := range []string{`"hello"`, `42`, `1.5`, `true`, `"<a & b>"`} {
+		result, err := inlineDocument(base).GetCurrentState()
+
+		if that.Nil(err, base) {
+			that.Equal(base, string(result))
+		}
+	}
+}
+
+func TestScalarBaseDocumentHasNoProperties_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`"hello"`, scalarSet("greeting", "hi"))
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+		that.Contains(err.Error(), "the document is a scalar value, so has no property `greeting`")
+	}
+}
+
+func TestScalarBaseDocumentReplacedWhenAllowed(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.AllowReplaceNonEmptyBase = true })
+	inputDoc := inlineDocument(`42`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"answer":42}`},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"answer":42}`, string(result))
+}
+
+func TestMapValueWhichIsNotAnObject_Fails(t *testing.T) {
+	that := assert.New(t)
+	for _, value := range []string{`42`, `[1]`} {
+		inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{Path: "field", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: value})
+		_, err := inputDoc.GetCurrentState()
+
+		that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType), value)
+	}
+}
+
+func TestEmptyBaseDocumentIsObject(t *testing.T) {
+	that := assert.New(t)
+	for _, base := range [][]byte{nil, {}, []byte("  \n")} {
+		inputDoc := eventsourceprocessor.Document{
+			BaseDocument: base,
+			Events: []eventsourceprocessor.DocumentEvent{
+				{Instructions: []eventsourceprocessor.EventInstruction{scalarSet("name", "first")}},
+			},
+		}
+		result, err := inputDoc.GetCurrentState()
+
+		if that.Nil(err, "%q", base) {
+			that.JSONEq(`{"name":"first"}`, string(result))
+		}
+	}
+}
+
+func TestEmptyBaseDocumentNotObject_Fails(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.EmptyBaseIsError = true })
+	inputDoc := eventsourceprocessor.Document{
+		Events: []eventsourceprocessor.DocumentEvent{
+			{Instructions: []eventsourceprocessor.EventInstruction{scalarSet("name", "first")}},
+		},
+	}
+	_, err := inputDoc.GetCurrentState()
+
+	that.True(errors.Is(err, eventsourceprocessor.ErrEmptyBaseDocument))
+}
+
+// copyDocument makes a deep copy of a document, so it can be compared with the original later.
+func copyDocument(doc eventsourceprocessor.Document) eventsourceprocessor.Document {
+	copied := doc
+	copied.BaseDocument = append([]byte(nil), doc.BaseDocument...)
+	copied.Events = nil
+	for _, event := range doc.Events {
+		event.Instructions = append([]eventsourceprocessor.EventInstruction(nil), event.Instructions...)
+		copied.Events = append(copied.Events, event)
+	}
+	return copied
+}
+
+func TestGetCurrentStateDoesNotModifyDocument(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.InferDataType = true })
+	inputDoc := inlineDocument("\ufeff {\"a\":{\"b\":1},\"list\":[3,1,2]} ",
+		eventsourceprocessor.EventInstruction{Path: "a.b.^.c", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, Value: "2"},
+		eventsourceprocessor.EventInstruction{Path: "list[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64, Value: gzipBase64(`{"d":4}`)},
+		eventsourceprocessor.EventInstruction{Path: "list[first]", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	inputDoc.Events = append(inputDoc.Events, setEvent(1, "a.e", "5"))
+	snapshot := copyDocument(inputDoc)
+
+	first, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	that.Equal(snapshot, inputDoc)
+
+	_, err = inputDoc.IsConvergent()
+	that.Nil(err)
+	_, err = inputDoc.GetAllStates()
+	that.Nil(err)
+	that.Equal(snapshot, inputDoc)
+
+	second, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	that.Equal(string(first), string(second))
+}
+
+func TestUnbalancedArrayIndexer_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":[1,2]}`, scalarSet("items[", "x"))
+	_, err := inputDoc.GetCurrentState()
+	that.NotNil(err)
+
+	// Reads don't validate the path first, so get as far as the array
+	inputDoc.Events = nil
+	for _, path := range []string{"items[", "items[first"} {
+		that.NotPanics(func() {
+			_, err = inputDoc.Sum(path)
+		}, path)
+		if that.NotNil(err, path) {
+			that.Contains(err.Error(), "malformed array indexer", path)
+		}
+	}
+}
+
+func TestRemovePropertyOfValueArrayElement(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":[1,2]}`, eventsourceprocessor.EventInstruction{Path: "items[first].name", ActionType: eventsourceprocessor.ActionTypeRemove})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+		that.Contains(err.Error(), "can't remove `name`, as `items[first]` is a float64 rather than an object")
+	}
+
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.RemoveNonExistantElementIsError = false })
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"items":[1,2]}`, string(result))
+}
+
+func TestRemoveArrayElementByIndex(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["a","b","c"],"rows":[[1,2,3]]}`,
+		eventsourceprocessor.EventInstruction{Path: "items[1]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "rows[0][1]", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	result, report, err := inputDoc.GetCurrentStateWithReport()
+
+	that.Nil(err)
+	that.JSONEq(`{"items":["a","c"],"rows":[[1,3]]}`, string(result))
+	that.Len(report.Removed, 2)
+}
+
+func TestRemoveArrayElementByIndexOutOfRange(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":["a","b","c"]}`, eventsourceprocessor.EventInstruction{Path: "items[3]", ActionType: eventsourceprocessor.ActionTypeRemove})
+	result, report, err := inputDoc.GetCurrentStateWithReport()
+
+	// Ignored by default, as for [first] & [last] on an empty array
+	that.Nil(err)
+	that.JSONEq(`{"items":["a","b","c"]}`, string(result))
+	that.Len(report.ConfigNotes, 1)
+
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.RemoveNonExistantArrayElementIsError = true })
+	_, err = inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+		that.Contains(err.Error(), "array `items` has no element 3")
+	}
+}
+
+func TestPathCaseCollision(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, scalarSet("Foo", "a"), scalarSet("foo", "b"))
+	result, err := inputDoc.GetCurrentState()
+
+	// The second path finds the element the first created
+	that.Nil(err)
+	that.JSONEq(`{"Foo":"b"}`, string(result))
+}
+
+func TestPathCaseCollisionCaseSensitive(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.CaseSensitivePaths = true })
+	inputDoc := inlineDocument(`{}`, scalarSet("Foo", "a"), scalarSet("foo", "b"))
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"Foo":"a","foo":"b"}`, string(result))
+
+	inputDoc = inlineDocument(`{"foo":"a"}`, eventsourceprocessor.EventInstruction{Path: "FOO", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "b"})
+	_, err = inputDoc.GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+}
+
+func TestPathCaseCollisionInBaseDocument(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"Foo":{"n":1},"foo":{"n":2}}`,
+		// An exact match wins; otherwise the first matching name in sorted order, i.e. `Foo`
+		scalarSet("foo.n", "exact"),
+		scalarSet("FOO.n", "folded"),
+		scalarSet("Foo.m", "exact"),
+		scalarSet("foo.m", "exact"),
+	)
+	for i := 0; i < 10; i++ {
+		result, err := inputDoc.GetCurrentState()
+
+		that.Nil(err)
+		that.JSONEq(`{"Foo":{"n":"folded","m":"exact"},"foo":{"n":"exact","m":"exact"}}`, string(result))
+	}
+}
+
+func TestRemoveCaseSensitive(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.CaseSensitivePaths = true
+		c.RemoveNonExistantElementIsError = false
+	})
+	inputDoc := inlineDocument(`{"name":"someone","Other":1,"other":2}`,
+		eventsourceprocessor.EventInstruction{Path: "Name", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "other", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"name":"someone","Other":1}`, string(result))
+}
+
+func TestRemoveCaseInsensitive(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"name":"someone","Other":1,"other":2}`,
+		eventsourceprocessor.EventInstruction{Path: "Name", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "other", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	// An exact match is preferred, as for lookups
+	that.Nil(err)
+	that.JSONEq(`{"Other":1}`, string(result))
+}
@@ -0,0 +1,50 @@
+package eventsourceprocessor
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Fingerprint returns a SHA-256 hash (hex encoded) of the document's base and events. Documents with identical
+// bases and events share a fingerprint, so callers can use it to spot exact duplicates. EntityId and
+// IdempotencyKey are not part of the fingerprint.
+func (doc Document) Fingerprint() string {
+	hash := sha256.New()
+
+	// Length-prefix the base, so its bytes can't run into the events
+	binary.Write(hash, binary.BigEndian, uint64(len(doc.BaseDocument)))
+	hash.Write(doc.BaseDocument)
+
+	// Events are plain data, so marshalling them can't fail
+	events, _ := json.Marshal(doc.Events)
+	hash.Write(events)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// StateHash returns a SHA-256 hash (hex encoded) of the document's current state, e.g. for an HTTP ETag. The state is
+// hashed with its properties sorted by name, whatever Configuration.KeyOrder says, so documents with the same content
+// share a hash however their properties are ordered.
+func (doc Document) StateHash() (string, error) {
+	return doc.stateHash(currentSettings())
+}
+
+// StateHash works like Document.StateHash, using the processor's configuration.
+func (processor *Processor) StateHash(doc Document) (string, error) {
+	return doc.stateHash(processor.config)
+}
+
+// stateHash does the work of StateHash, with the supplied settings.
+func (doc Document) stateHash(config *settings) (string, error) {
+	canonical := *config
+	canonical.KeyOrder = KeyOrderSorted
+	state, err := doc.currentState(&canonical)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(state)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,67 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintIdenticalDocuments(t *testing.T) {
+	that := assert.New(t)
+	firstDoc := buildDocument("TestFingerprintIdenticalDocuments", "base.json", []string{"event1.json", "event2.json"})
+	secondDoc := buildDocument("TestFingerprintIdenticalDocuments", "base.json", []string{"event1.json", "event2.json"})
+	secondDoc.EntityId = "another-entity"
+	secondDoc.IdempotencyKey = "another-key"
+
+	that.Len(firstDoc.Fingerprint(), 64)
+	that.Equal(firstDoc.Fingerprint(), secondDoc.Fingerprint())
+}
+
+func TestFingerprintDifferentDocuments(t *testing.T) {
+	that := assert.New(t)
+	baseDoc := buildDocument("TestFingerprintDifferentDocuments", "base.json", []string{"event1.json"})
+	moreEvents := buildDocument("TestFingerprintDifferentDocuments", "base.json", []string{"event1.json", "event2.json"})
+	otherBase := buildDocument("TestFingerprintDifferentDocuments", "emptyBase.json", []string{"event1.json"})
+
+	that.NotEqual(baseDoc.Fingerprint(), moreEvents.Fingerprint())
+	that.NotEqual(baseDoc.Fingerprint(), otherBase.Fingerprint())
+}
+
+func TestStateHashReorderedKeys(t *testing.T) {
+	that := assert.New(t)
+	firstDoc := inlineDocument(`{"a":1,"b":{"c":true,"d":[1,2]}}`, scalarSet("e", "x"))
+	secondDoc := inlineDocument(`{"b":{"d":[1,2],"c":true},"a":1}`, scalarSet("e", "x"))
+
+	firstHash, err := firstDoc.StateHash()
+	that.NoError(err)
+	secondHash, err := secondDoc.StateHash()
+	that.NoError(err)
+
+	that.Len(firstHash, 64)
+	that.Equal(firstHash, secondHash)
+	that.NotEqual(firstDoc.Fingerprint(), secondDoc.Fingerprint())
+
+	// The same, even when the output keeps the document's key order
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.KeyOrder = eventsourceprocessor.KeyOrderDocument })
+	documentOrderHash, err := secondDoc.StateHash()
+	that.NoError(err)
+	that.Equal(firstHash, documentOrderHash)
+}
+
+func TestStateHashDifferentStates(t *testing.T) {
+	that := assert.New(t)
+	firstHash, err := inlineDocument(`{"a":1}`, scalarSet("b", "x")).StateHash()
+	that.NoError(err)
+	secondHash, err := inlineDocument(`{"a":1}`, scalarSet("b", "y")).StateHash()
+	that.NoError(err)
+	// Different events, same state
+	sameHash, err := inlineDocument(`{"a":1,"b":"z"}`, scalarSet("b", "x")).StateHash()
+	that.NoError(err)
+
+	that.NotEqual(firstHash, secondHash)
+	that.Equal(firstHash, sameHash)
+
+	_, err = inlineDocument(`{`).StateHash()
+	that.Error(err)
+}
@@ -0,0 +1,90 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// increment adds the instruction's value, a number, to the number at its path. A missing (or null) element counts as
+// zero, unless IncrementNonExistantElementIsError is set.
+func (docMap *documentMap) increment(config *settings, instruction EventInstruction) error {
+	if instruction.DataType != DataTypeNumber && instruction.DataType != DataTypeNone {
+		return fmt.Errorf("%w: the %s action needs a %s value, not a %s", ErrInvalidDataType, instruction.ActionType, DataTypeNumber, instruction.DataType)
+	}
+	delta, err := checkScalarValue(DataTypeNumber, instruction.Value)
+	if err != nil {
+		return err
+	}
+
+	// An empty path increments the document itself, which must then be a bare number (or null)
+	elem, name := rootElement(docMap), "the document"
+	if instruction.Path != "" {
+		elem, err = docMap.locate(config, instruction.Path, !config.IncrementNonExistantElementIsError)
+		if err != nil {
+			return err
+		}
+		name = "`" + instruction.Path + "`"
+	}
+	current := "0"
+	switch elem.ElementType {
+	case DataTypeNumber:
+		current = elem.Value
+	case DataTypeNull:
+		if config.IncrementNonExistantElementIsError {
+			return fmt.Errorf("%w: %s is null, so can't be incremented (IncrementNonExistantElementIsError=true)", ErrElementNotFound, name)
+		}
+	default:
+		return fmt.Errorf("%w: %s is a %s, so can't be incremented", ErrInvalidDataType, name, elem.ElementType)
+	}
+
+	return elem.setValue(config, DataTypeNumber, addNumbers(current, delta))
+}
+
+// addNumbers adds two JSON numbers exactly, working on their decimal digits rather than through float64s, so e.g.
+// 0.2 + 0.1 is 0.3 and integers don't overflow. The sum is written in the shortest form which holds it exactly. Only a
+// number with an exponent too large to write out in full is added as float64s.
+func addNumbers(a, b string) string {
+	x, okX := exactNumber(a)
+	y, okY := exactNumber(b)
+	if !okX || !okY {
+		fx, _ := strconv.ParseFloat(a, 64)
+		fy, _ := strconv.ParseFloat(b, 64)
+		return strconv.FormatFloat(fx+fy, 'g', -1, 64)
+	}
+	sum := new(big.Rat).Add(x, y)
+	if sum.IsInt() {
+		return sum.Num().String()
+	}
+	// The sum of two decimals is a decimal, whose denominator is 2^m * 5^n; max(m, n) decimal places hold it exactly
+	denom := new(big.Int).Set(sum.Denom())
+	twos := int(denom.TrailingZeroBits())
+	denom.Rsh(denom, uint(twos))
+	fives := 0
+	five, remainder := big.NewInt(5), new(big.Int)
+	for denom.Cmp(big.NewInt(1)) > 0 {
+		quotient, _ := new(big.Int).QuoRem(denom, five, remainder)
+		if remainder.Sign() != 0 {
+			break
+		}
+		denom = quotient
+		fives++
+	}
+	places := twos
+	if fives > places {
+		places = fives
+	}
+	return sum.FloatString(places)
+}
+
+// exactNumber parses a JSON number as an exact rational, unless its exponent is too large to sensibly write out.
+func exactNumber(value string) (*big.Rat, bool) {
+	if e := strings.IndexAny(value, "eE"); e >= 0 {
+		exponent, err := strconv.Atoi(value[e+1:])
+		if err != nil || exponent > 10000 || exponent < -10000 {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(value)
+}
@@ -0,0 +1,75 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func incrementInstruction(path string, delta string) eventsourceprocessor.EventInstruction {
+	return eventsourceprocessor.EventInstruction{Path: path, ActionType: eventsourceprocessor.ActionTypeIncrement, DataType: eventsourceprocessor.DataTypeNumber, Value: delta}
+}
+
+func TestIncrementExistingNumber(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"counters":{"views":41,"big":9007199254740993,"ratio":0.5}}`,
+		incrementInstruction("counters.views", "1"),
+		incrementInstruction("counters.big", "-2"),
+		incrementInstruction("counters.ratio", "0.25"),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	// Integers are added exactly
+	that.Nil(err)
+	that.JSONEq(`{"counters":{"views":42,"big":9007199254740991,"ratio":0.75}}`, string(result))
+}
+
+func TestIncrementExact(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"decimal":0.2,"max":9223372036854775807,"min":-9223372036854775808,"exponent":1.5e2,"tiny":1e-20}`,
+		incrementInstruction("decimal", "0.1"),
+		incrementInstruction("max", "1"),
+		incrementInstruction("min", "-0.5"),
+		incrementInstruction("exponent", "0.25"),
+		incrementInstruction("tiny", "1"),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	// Decimals are added on their digits, and integers past int64 don't overflow
+	that.Nil(err)
+	that.Equal(`{"decimal":0.3,"exponent":150.25,"max":9223372036854775808,"min":-9223372036854775808.5,"tiny":1.00000000000000000001}`, string(result))
+}
+
+func TestIncrementMissingNumber(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"reset":null}`,
+		incrementInstruction("counters.views", "5"),
+		incrementInstruction("counters.views", "5"),
+		incrementInstruction("reset", "1"),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"counters":{"views":10},"reset":1}`, string(result))
+}
+
+func TestIncrementMissingNumber_Fails(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.IncrementNonExistantElementIsError = true })
+	_, err := inlineDocument(`{}`, incrementInstruction("views", "1")).GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+
+	_, err = inlineDocument(`{"views":null}`, incrementInstruction("views", "1")).GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+}
+
+func TestIncrementNonNumber_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := inlineDocument(`{"views":"many"}`, incrementInstruction("views", "1")).GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+
+	_, err = inlineDocument(`{"views":1}`, incrementInstruction("views", "one")).GetCurrentState()
+	that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+}
@@ -0,0 +1,57 @@
+package eventsourceprocessor
+
+import "fmt"
+
+// InverseEvents works out the events which undo the document's events: applied after them, in the order returned, they
+// take the document back to its base. The first undoes the last event, the second the one before it, and so on.
+//
+//	Each inverse is worked out by comparing the document before and after the event it undoes, as Diff does - so a
+//	SetOrAdd which created a property is undone by a Remove, one which overwrote a value by a SetOrAdd of the old
+//	value, and a Remove by a SetOrAdd of what was removed. The inverse events have no EventId or Timestamp; set them as
+//	the stream requires. An event which changes the shape of the document can only be undone if
+//	Configuration.AllowReplaceNonEmptyBase is set, as undoing it replaces the whole document.
+func (doc Document) InverseEvents() ([]DocumentEvent, error) {
+	return doc.inverseEvents(currentSettings())
+}
+
+// InverseEvents works like Document.InverseEvents, using the processor's configuration.
+func (processor *Processor) InverseEvents(doc Document) ([]DocumentEvent, error) {
+	return doc.inverseEvents(processor.config)
+}
+
+// inverseEvents does the work of InverseEvents, with the supplied settings.
+func (doc Document) inverseEvents(config *settings) ([]DocumentEvent, error) {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	inverses := make([]DocumentEvent, len(doc.Events))
+	var before *documentMap
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		beforeEvent: func(int) error {
+			before = docMap.clone()
+			return nil
+		},
+		afterEvent: func(eventIndex int) error {
+			instructions, err := diffDocuments(config, docMap, before)
+			if err != nil {
+				return fmt.Errorf("event[%d] (id=%s) can't be undone: %w", eventIndex, doc.Events[eventIndex].EventId, err)
+			}
+			inverses[len(doc.Events)-1-eventIndex] = DocumentEvent{Instructions: instructions}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inverses, nil
+}
+
+// clone makes a deep copy of a document map, so the copy is unaffected by any changes to the original.
+func (docMap *documentMap) clone() *documentMap {
+	copied := (&documentElement{ElementType: DataTypeMap, Content: docMap}).clone().Content
+	copied.IsArray = docMap.IsArray
+	copied.IsScalar = docMap.IsScalar
+	return copied
+}
@@ -0,0 +1,95 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+// undone applies a document's events followed by their inverses, returning the result.
+func undone(t *testing.T, inputDoc eventsourceprocessor.Document) []byte {
+	inverses, err := inputDoc.InverseEvents()
+	assert.Nil(t, err)
+	undoneDoc := copyDocument(inputDoc)
+	undoneDoc.Events = append(undoneDoc.Events, inverses...)
+	result, err := undoneDoc.GetCurrentState()
+	assert.Nil(t, err)
+	return result
+}
+
+func TestInverseEvents(t *testing.T) {
+	that := assert.New(t)
+	base := `{"status":"new","customer":{"name":"someone","address":{"city":"Leeds"}},"lines":[{"sku":"A"}],"count":1}`
+	inputDoc := inlineDocument(base,
+		scalarSet("status", "paid"),
+		scalarSet("notes", "created"),
+		eventsourceprocessor.EventInstruction{Path: "customer.address", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	inputDoc.Events = append(inputDoc.Events,
+		eventsourceprocessor.DocumentEvent{Instructions: []eventsourceprocessor.EventInstruction{
+			scalarSet("lines[new].sku", "B"),
+			incrementInstruction("count", "4"),
+			moveInstruction("customer.name", "billing.name"),
+		}},
+	)
+
+	inverses, err := inputDoc.InverseEvents()
+
+	that.Nil(err)
+	if that.Len(inverses, 2) {
+		// The last event is undone first
+		that.Contains(inverses[0].Instructions, eventsourceprocessor.EventInstruction{Path: "lines[last]", ActionType: eventsourceprocessor.ActionTypeRemove})
+		that.Contains(inverses[1].Instructions, eventsourceprocessor.EventInstruction{Path: "notes", ActionType: eventsourceprocessor.ActionTypeRemove})
+		that.Contains(inverses[1].Instructions, eventsourceprocessor.EventInstruction{Path: "status", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "new"})
+		that.Contains(inverses[1].Instructions, eventsourceprocessor.EventInstruction{Path: "customer.address", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"city":"Leeds"}`})
+	}
+	that.JSONEq(base, string(undone(t, inputDoc)))
+}
+
+func TestInverseEventsEachEvent(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := recentActivityDocument()
+	base := inputDoc.BaseDocument
+
+	inverses, err := inputDoc.InverseEvents()
+	that.Nil(err)
+
+	// Undoing the last n events gives the state after the others
+	for n := 1; n <= len(inputDoc.Events); n++ {
+		partial := eventsourceprocessor.Document{BaseDocument: base, Events: inputDoc.Events[:len(inputDoc.Events)-n]}
+		expected, err := partial.GetCurrentState()
+		that.Nil(err)
+
+		undoneDoc := eventsourceprocessor.Document{BaseDocument: base, Events: append(append([]eventsourceprocessor.DocumentEvent{}, inputDoc.Events...), inverses[:n]...)}
+		result, err := undoneDoc.GetCurrentState()
+		that.Nil(err)
+		that.JSONEq(string(expected), string(result))
+	}
+}
+
+func TestInverseEventsCaseOnlyRename(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"Foo":1}`, moveInstruction("Foo", "foo"))
+
+	result, err := inputDoc.GetCurrentState()
+	if that.NoError(err) {
+		that.JSONEq(`{"foo":1}`, string(result))
+	}
+	that.JSONEq(`{"Foo":1}`, string(undone(t, inputDoc)))
+}
+
+func TestInverseEventsShapeChange(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: `[1,2]`},
+	)
+
+	_, err := inputDoc.InverseEvents()
+	that.ErrorContains(err, "event[0] (id=00000000-0000-0000-0000-000000000000) can't be undone")
+
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.AllowReplaceNonEmptyBase = true
+	})
+	that.JSONEq(`{}`, string(undone(t, inputDoc)))
+}
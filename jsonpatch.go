@@ -0,0 +1,443 @@
+package eventsourceprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// patchOperation is a single operation of a JSON Patch (RFC 6902).
+type patchOperation struct {
+	Op    string          `json:"op"`
+	From  string          `json:"from,omitempty"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchInput is an operation of a JSON Patch being read, where a missing member must be told apart from an empty one.
+type patchInput struct {
+	Op    string          `json:"op"`
+	From  *string         `json:"from"`
+	Path  *string         `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ToJSONPatch translates the document's events into a JSON Patch (RFC 6902) which, applied to the base document,
+// gives the current state. The events are replayed as they would be by GetCurrentState, so array selectors become the
+// index they referred to at the time - `[last]` becomes the last index, `[new]` becomes `-` - and paths are written
+// as JSON Pointers, e.g. `/a/b/0`.
+//
+//	SetOrAdd and SetOnly become `replace` where the element already existed, and `add` where it didn't; if the
+//	instruction had to create parents along the way, a single `add` puts the outermost new element, with everything
+//	beneath it. Remove becomes `remove`, Append and InsertAt become `add`, and Move and Copy become `move` and `copy`.
+//
+//	Some instructions can't be expressed exactly, and are translated into what they did rather than how:
+//	  - Increment and Merge become a `replace` with the resulting value.
+//	  - CompareAndSet becomes a `test` of the value it matched, then a `replace`.
+//	  - Removing `[all]` of an array becomes a `replace` with an empty array.
+//	  - Move and Copy onto an existing array element replace it here, but insert before it in JSON Patch; and JSON
+//	    Patch won't create missing parents of their destination.
+//	  - NoOps, and instructions skipped via SkipValueErrorPaths, don't appear; nor do event boundaries or ids.
+func (doc Document) ToJSONPatch() ([]byte, error) {
+	return doc.toJSONPatch(currentSettings())
+}
+
+// ToJSONPatch works like Document.ToJSONPatch, using the processor's configuration.
+func (processor *Processor) ToJSONPatch(doc Document) ([]byte, error) {
+	return doc.toJSONPatch(processor.config)
+}
+
+// toJSONPatch does the work of ToJSONPatch, with the supplied settings.
+func (doc Document) toJSONPatch(config *settings) ([]byte, error) {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := []patchOperation{}
+	var tokens, from []string
+	var exists bool
+	var before *documentElement
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		beforeInstruction: func(_, _ int, instruction EventInstruction) {
+			if instruction.ActionType == ActionTypeNoOp {
+				return
+			}
+			var resolved string
+			resolved, exists = docMap.resolvePath(config, instruction.Path)
+			tokens = pointerTokens(config, resolved)
+			from = nil
+			if instruction.ActionType == ActionTypeMove || instruction.ActionType == ActionTypeCopy {
+				source, _ := docMap.resolvePath(config, instruction.Value)
+				from = pointerTokens(config, source)
+			}
+			before = rootElement(docMap).snapshot(tokens, instruction.ActionType == ActionTypeCompareAndSet)
+		},
+		afterInstruction: func(_, _ int, instruction EventInstruction, err error, _ bool) error {
+			if err != nil || instruction.ActionType == ActionTypeNoOp {
+				return nil
+			}
+			operations, err := patchOperations(config, instruction, before, rootElement(docMap), tokens, exists, from)
+			patch = append(patch, operations...)
+			return err
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(patch)
+}
+
+// snapshot copies what patchOperations needs to know of the document before an instruction is applied: each element
+// along tokens, with its type and (for arrays) its length, but none of its other children. The element at the end of
+// the path is copied in full if withValue is set, e.g. for the value a CompareAndSet tests.
+func (elem *documentElement) snapshot(tokens []string, withValue bool) *documentElement {
+	if len(tokens) == 0 && withValue {
+		return elem.clone()
+	}
+	copied := &documentElement{Name: elem.Name, ElementType: elem.ElementType, Value: elem.Value}
+	var next *documentElement
+	if len(tokens) > 0 {
+		next = elem.child(tokens[0])
+	}
+	switch elem.ElementType {
+	case DataTypeMap:
+		copied.Content = &documentMap{Elements: map[string]*documentElement{}}
+		if next != nil {
+			copied.Content.Elements[tokens[0]] = next.snapshot(tokens[1:], withValue)
+		}
+	case DataTypeArray:
+		// Only the element on the path is filled in; the rest are nil, as descend never reaches them
+		copied.ArrayContent = make([]*documentElement, len(elem.ArrayContent))
+		if next != nil {
+			index, _ := strconv.Atoi(tokens[0])
+			copied.ArrayContent[index] = next.snapshot(tokens[1:], withValue)
+		}
+	}
+	return copied
+}
+
+// patchOperations works out the JSON Patch operations for an instruction which has just been applied, given the
+// document before (as a snapshot of its path) and after, and the JSON Pointer tokens of its (resolved) path and source path.
+func patchOperations(config *settings, instruction EventInstruction, before, after *documentElement, tokens []string, exists bool, from []string) ([]patchOperation, error) {
+	switch instruction.ActionType {
+	case ActionTypeRemove:
+		if exists {
+			return []patchOperation{{Op: "remove", Path: jsonPointer(tokens)}}, nil
+		}
+		all := config.arrayOpen() + "all" + config.arrayClose()
+		if len(tokens) > 0 && strings.EqualFold(tokens[len(tokens)-1], all) {
+			// The path was left unresolved, so its last token is still the selector
+			arrayTokens := tokens[:len(tokens)-1]
+			if before.descend(arrayTokens) != nil {
+				return []patchOperation{{Op: "replace", Path: jsonPointer(arrayTokens), Value: json.RawMessage("[]")}}, nil
+			}
+		}
+		return nil, nil
+
+	case ActionTypeMove, ActionTypeCopy:
+		return []patchOperation{{Op: strings.ToLower(string(instruction.ActionType)), From: jsonPointer(from), Path: before.targetPointer(tokens)}}, nil
+
+	case ActionTypeAppend:
+		if array := before.descend(tokens); array != nil && array.ElementType == DataTypeArray {
+			appended := strconv.Itoa(len(array.ArrayContent))
+			return valueOperation(config, "add", jsonPointer(tokens)+"/-", after, append(tokens[:len(tokens):len(tokens)], appended))
+		}
+
+	case ActionTypeInsertAt:
+		if len(tokens) == 0 {
+			break
+		}
+		if array := before.descend(tokens[:len(tokens)-1]); array != nil && array.ElementType == DataTypeArray {
+			return valueOperation(config, "add", jsonPointer(tokens), after, tokens)
+		}
+
+	case ActionTypeCompareAndSet:
+		if before.descend(tokens) == nil {
+			break // It matched a missing element; there's nothing to test
+		}
+		test, err := valueOperation(config, "test", jsonPointer(tokens), before, tokens)
+		if err != nil {
+			return nil, err
+		}
+		set, err := setOperations(config, before, after, tokens)
+		return append(test, set...), err
+	}
+	return setOperations(config, before, after, tokens)
+}
+
+// setOperations gives the operation which puts the value at tokens in place: a `replace` if it existed before, or an
+// `add` of the first element along the path which didn't. Where the path went through a scalar, which has been
+// turned into an object or array, the scalar is replaced.
+func setOperations(config *settings, before, after *documentElement, tokens []string) ([]patchOperation, error) {
+	elem := before
+	for i, token := range tokens {
+		if elem.ElementType != DataTypeMap && elem.ElementType != DataTypeArray {
+			return valueOperation(config, "replace", jsonPointer(tokens[:i]), after, tokens[:i])
+		}
+		child := elem.child(token)
+		if child == nil {
+			return valueOperation(config, "add", before.targetPointer(tokens[:i+1]), after, tokens[:i+1])
+		}
+		elem = child
+	}
+	return valueOperation(config, "replace", jsonPointer(tokens), after, tokens)
+}
+
+// valueOperation builds an operation at path, taking its value from the element of doc at valueTokens.
+func valueOperation(config *settings, op string, path string, doc *documentElement, valueTokens []string) ([]patchOperation, error) {
+	elem := doc.descend(valueTokens)
+	if elem == nil {
+		return nil, fmt.Errorf("%w: `%s` is missing from the replayed document", ErrElementNotFound, jsonPointer(valueTokens))
+	}
+	value, err := buildArray(config, []*documentElement{elem})
+	if err != nil {
+		return nil, err
+	}
+	return []patchOperation{{Op: op, Path: path, Value: json.RawMessage(value)}}, nil
+}
+
+// targetPointer gives the pointer for an operation which puts an element at tokens, where elem is the document before
+// the operation: the last token becomes `-` if it appends to an array.
+func (elem *documentElement) targetPointer(tokens []string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	last := len(tokens) - 1
+	parent := elem.descend(tokens[:last])
+	if parent != nil && parent.ElementType == DataTypeArray && tokens[last] == strconv.Itoa(len(parent.ArrayContent)) {
+		return jsonPointer(append(tokens[:last:last], "-"))
+	}
+	return jsonPointer(tokens)
+}
+
+// child returns the property or array element of elem named by a JSON Pointer token, or nil if there isn't one.
+func (elem *documentElement) child(token string) *documentElement {
+	switch elem.ElementType {
+	case DataTypeMap:
+		if elem.Content != nil {
+			return elem.Content.Elements[token]
+		}
+	case DataTypeArray:
+		index, err := strconv.Atoi(token)
+		if err == nil && index >= 0 && index < len(elem.ArrayContent) {
+			return elem.ArrayContent[index]
+		}
+	}
+	return nil
+}
+
+// descend follows JSON Pointer tokens down from elem, returning nil if they don't all exist.
+func (elem *documentElement) descend(tokens []string) *documentElement {
+	for _, token := range tokens {
+		if elem = elem.child(token); elem == nil {
+			return nil
+		}
+	}
+	return elem
+}
+
+// pointerTokens splits a path into JSON Pointer reference tokens: `a.b[0]` becomes `a`, `b`, `0`. Resolved selectors
+// are already numeric; `[new]`, or any other selector left unresolved, keeps its brackets.
+func pointerTokens(config *settings, path string) []string {
+	var tokens []string
+	if path == "" {
+		return tokens
+	}
+	for _, segment := range splitPath(config, path) {
+		name, indexers := segment, ""
+		if strings.Contains(segment, config.arrayOpen()) {
+			name, indexers = getArrayIndexer(config, segment)
+		}
+		if name != "" {
+			tokens = append(tokens, name)
+		}
+		for _, indexer := range config.arrayRegex.FindAllString(indexers, -1) {
+			if _, err := strconv.Atoi(indexerName(config, indexer)); err == nil {
+				indexer = indexerName(config, indexer)
+			}
+			tokens = append(tokens, indexer)
+		}
+	}
+	return tokens
+}
+
+// jsonPointer joins reference tokens into a JSON Pointer (RFC 6901), escaping `~` and `/`.
+func jsonPointer(tokens []string) string {
+	var pointer strings.Builder
+	for _, token := range tokens {
+		pointer.WriteByte('/')
+		pointer.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return pointer.String()
+}
+
+// JSONPatchToEvent converts a JSON Patch (RFC 6902) into an equivalent event. `add` becomes SetOrAdd - except at a
+// numeric array index, which inserts, so becomes InsertAt. `replace` needs its target to exist, so becomes SetOnly, or
+// ReplaceAt at an array index. `remove` becomes Remove, and `move` and `copy` become Move and Copy. JSON Pointer paths are converted to this package's paths, e.g.
+// `/items/0/sku` becomes `items[0].sku`, and `/items/-` becomes `items[new]`.
+//
+//	Numeric pointer tokens are always taken as array indices, as there's no document to tell otherwise; and property
+//	names containing `.` or the array delimiters can't be expressed. `test` operations aren't supported. An `add` or
+//	`replace` of the whole document is subject to the usual rules for replacing the base (see AllowReplaceNonEmptyBase).
+func JSONPatchToEvent(patch []byte) (DocumentEvent, error) {
+	return jsonPatchToEvent(currentSettings(), patch)
+}
+
+// JSONPatchToEvent works like the package-level JSONPatchToEvent, using the processor's configuration.
+func (processor *Processor) JSONPatchToEvent(patch []byte) (DocumentEvent, error) {
+	return jsonPatchToEvent(processor.config, patch)
+}
+
+// jsonPatchToEvent does the work of JSONPatchToEvent, with the supplied settings.
+func jsonPatchToEvent(config *settings, patch []byte) (DocumentEvent, error) {
+	var operations []patchInput
+	err := json.NewDecoder(bytes.NewReader(patch)).Decode(&operations)
+	if err != nil {
+		return DocumentEvent{}, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+
+	event := DocumentEvent{}
+	for i, operation := range operations {
+		instruction, err := patchInstruction(config, operation)
+		if err != nil {
+			return DocumentEvent{}, fmt.Errorf("JSON patch operation %d (%s): %w", i, operation.Op, err)
+		}
+		event.Instructions = append(event.Instructions, instruction)
+	}
+	return event, nil
+}
+
+// patchInstruction converts a single JSON Patch operation into an instruction.
+func patchInstruction(config *settings, operation patchInput) (EventInstruction, error) {
+	if operation.Path == nil {
+		return EventInstruction{}, errors.New("the operation has no path")
+	}
+	path, err := jsonPointerToPath(config, *operation.Path)
+	if err != nil {
+		return EventInstruction{}, err
+	}
+
+	switch operation.Op {
+	case "add", "replace":
+		// An add at an array index inserts there; a replace needs its target to exist already
+		instruction := EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd}
+		tokens := strings.Split(*operation.Path, "/")
+		indexed := isArrayIndexToken(tokens[len(tokens)-1])
+		switch {
+		case operation.Op == "add" && indexed:
+			instruction.ActionType = ActionTypeInsertAt
+		case operation.Op == "replace" && indexed:
+			instruction.ActionType = ActionTypeReplaceAt
+		case operation.Op == "replace":
+			instruction.ActionType = ActionTypeSetOnly
+		}
+		instruction.DataType, instruction.Value, err = patchValue(operation.Value)
+		return instruction, err
+
+	case "remove":
+		if path == "" {
+			return EventInstruction{}, errors.New("the whole document can't be removed")
+		}
+		return EventInstruction{Path: path, ActionType: ActionTypeRemove}, nil
+
+	case "move", "copy":
+		if operation.From == nil {
+			return EventInstruction{}, errors.New("the operation has no from path")
+		}
+		from, err := jsonPointerToPath(config, *operation.From)
+		if err != nil {
+			return EventInstruction{}, err
+		}
+		actionType := ActionTypeMove
+		if operation.Op == "copy" {
+			actionType = ActionTypeCopy
+		}
+		return EventInstruction{Path: path, ActionType: actionType, Value: from}, nil
+
+	case "test":
+		return EventInstruction{}, errors.New("`test` operations aren't supported, as there's no equivalent action")
+	}
+	return EventInstruction{}, fmt.Errorf("unknown operation `%s`", operation.Op)
+}
+
+// patchValue works out the data type and instruction value for an operation's JSON value.
+func patchValue(value json.RawMessage) (DataType, string, error) {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return DataTypeNone, "", errors.New("the operation has no value")
+	}
+	switch value[0] {
+	case '{':
+		return DataTypeMap, string(value), nil
+	case '[':
+		return DataTypeArray, string(value), nil
+	case '"':
+		var text string
+		err := json.Unmarshal(value, &text)
+		return DataTypeString, text, err
+	case 't', 'f':
+		return DataTypeBool, string(value), nil
+	case 'n':
+		return DataTypeNull, "", nil
+	}
+	return DataTypeNumber, string(value), nil
+}
+
+// nativePath converts a path written as a JSON Pointer, i.e. starting with `/`, into this package's path syntax. Any
+// other path is returned as it is.
+func nativePath(config *settings, path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return path, nil
+	}
+	return jsonPointerToPath(config, path)
+}
+
+// jsonPointerToPath converts a JSON Pointer (RFC 6901) into a path: `~1` and `~0` are unescaped, property names are
+// joined with `.`, numeric tokens become array indexers, and `-` becomes `[new]`.
+func jsonPointerToPath(config *settings, pointer string) (string, error) {
+	if pointer == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("JSON pointer `%s` must start with `/`", pointer)
+	}
+	var path strings.Builder
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch {
+		case token == "-":
+			path.WriteString(config.arrayOpen() + "new" + config.arrayClose())
+		case isArrayIndexToken(token):
+			path.WriteString(config.arrayOpen() + token + config.arrayClose())
+		case token == "" || token == "^" || strings.ContainsAny(token, "."+config.arrayOpen()+config.arrayClose()):
+			return "", fmt.Errorf("JSON pointer `%s`: property `%s` can't be expressed as a path", pointer, token)
+		default:
+			if path.Len() > 0 {
+				path.WriteByte('.')
+			}
+			path.WriteString(token)
+		}
+	}
+	err := validatePath(config, path.String())
+	if err != nil {
+		return "", fmt.Errorf("JSON pointer `%s`: %w", pointer, err)
+	}
+	return path.String(), nil
+}
+
+// isArrayIndexToken reports whether a JSON Pointer token is an array index: digits, without a leading zero.
+func isArrayIndexToken(token string) bool {
+	if token == "" || (token[0] == '0' && len(token) > 1) {
+		return false
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToJSONPatch(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"name":"order","status":"new","count":1,"lines":[{"sku":"A"},{"sku":"B"}],"tags":["x","y"],"old":true}`,
+		scalarSet("status", "paid"),
+		scalarSet("customer.address.city", "Leeds"),
+		eventsourceprocessor.EventInstruction{Path: "lines[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"sku":"C"}`},
+		scalarSet("lines[last].sku", "C2"),
+		eventsourceprocessor.EventInstruction{Path: "lines[first]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "old", ActionType: eventsourceprocessor.ActionTypeRemove},
+		incrementInstruction("count", "2"),
+		eventsourceprocessor.EventInstruction{Path: "tags", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeString, Value: "z"},
+		insertAtInstruction("tags[0]", "w"),
+		copyInstruction("name", "title"),
+		moveInstruction("tags[last]", "lastTag"),
+		eventsourceprocessor.EventInstruction{Path: "tags[all]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeNoOp, Value: "note"},
+	)
+
+	patch, err := inputDoc.ToJSONPatch()
+	prettyPrint("JSON Patch", patch)
+
+	that.Nil(err)
+	that.JSONEq(`[
+		{"op":"replace","path":"/status","value":"paid"},
+		{"op":"add","path":"/customer","value":{"address":{"city":"Leeds"}}},
+		{"op":"add","path":"/lines/-","value":{"sku":"C"}},
+		{"op":"replace","path":"/lines/2/sku","value":"C2"},
+		{"op":"remove","path":"/lines/0"},
+		{"op":"remove","path":"/old"},
+		{"op":"replace","path":"/count","value":3},
+		{"op":"add","path":"/tags/-","value":"z"},
+		{"op":"add","path":"/tags/0","value":"w"},
+		{"op":"copy","from":"/name","path":"/title"},
+		{"op":"move","from":"/tags/3","path":"/lastTag"},
+		{"op":"replace","path":"/tags","value":[]}
+	]`, string(patch))
+}
+
+func TestToJSONPatchRootAndEscaping(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`[]`,
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: `[{"a/b":1}]`},
+		eventsourceprocessor.EventInstruction{Path: "[0].a/b", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "2"},
+		scalarSet("[0].c~d", "e"),
+	)
+
+	patch, err := inputDoc.ToJSONPatch()
+
+	that.Nil(err)
+	that.JSONEq(`[
+		{"op":"replace","path":"","value":[{"a/b":1}]},
+		{"op":"replace","path":"/0/a~1b","value":2},
+		{"op":"add","path":"/0/c~0d","value":"e"}
+	]`, string(patch))
+}
+
+func TestToJSONPatchCompareAndSet(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := compareAndSetDocument("address.city", eventsourceprocessor.DataTypeString, "Leeds")
+
+	patch, err := inputDoc.ToJSONPatch()
+
+	that.Nil(err)
+	that.JSONEq(`[
+		{"op":"test","path":"/address/city","value":"Leeds"},
+		{"op":"replace","path":"/address/city","value":"replaced"}
+	]`, string(patch))
+}
+
+func TestToJSONPatchFailingInstruction_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+	)
+
+	_, err := inputDoc.ToJSONPatch()
+
+	var instructionErr eventsourceprocessor.InstructionError
+	that.ErrorAs(err, &instructionErr)
+}
+
+func TestJSONPatchToEvent(t *testing.T) {
+	that := assert.New(t)
+	event, err := eventsourceprocessor.JSONPatchToEvent([]byte(`[
+		{"op":"replace","path":"/status","value":"paid"},
+		{"op":"add","path":"/customer","value":{"name":"someone"}},
+		{"op":"add","path":"/lines/-","value":{"sku":"C","qty":2}},
+		{"op":"add","path":"/lines/0","value":{"sku":"Z"}},
+		{"op":"replace","path":"/lines/1/qty","value":5},
+		{"op":"remove","path":"/lines/2/qty"},
+		{"op":"add","path":"/paid","value":true},
+		{"op":"add","path":"/note","value":null},
+		{"op":"copy","from":"/customer/name","path":"/a~1b"},
+		{"op":"move","from":"/old","path":"/archived"}
+	]`))
+	that.Nil(err)
+	that.Equal(eventsourceprocessor.EventInstruction{Path: "lines[0]", ActionType: eventsourceprocessor.ActionTypeInsertAt, DataType: eventsourceprocessor.DataTypeMap, Value: `{"sku":"Z"}`}, event.Instructions[3])
+	that.Equal(eventsourceprocessor.EventInstruction{Path: "a/b", ActionType: eventsourceprocessor.ActionTypeCopy, Value: "customer.name"}, event.Instructions[8])
+
+	inputDoc := inlineDocument(`{"status":"new","lines":[{"sku":"A","qty":1},{"sku":"B","qty":1}],"old":1}`)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{
+		"status":"paid",
+		"customer":{"name":"someone"},
+		"lines":[{"sku":"Z"},{"sku":"A","qty":5},{"sku":"B"},{"sku":"C","qty":2}],
+		"paid":true,
+		"note":null,
+		"a/b":"someone",
+		"archived":1
+	}`, string(result))
+}
+
+func TestJSONPatchReplaceMissingTarget_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, patch := range []string{
+		`[{"op":"replace","path":"/lines/2","value":"C"}]`,
+		`[{"op":"replace","path":"/lines/-","value":"C"}]`,
+		`[{"op":"replace","path":"/missing","value":"C"}]`,
+	} {
+		event, err := eventsourceprocessor.JSONPatchToEvent([]byte(patch))
+		if !that.Nil(err, patch) {
+			continue
+		}
+		inputDoc := inlineDocument(`{"lines":["A","B"]}`)
+		inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+
+		_, err = inputDoc.GetCurrentState()
+
+		that.Error(err, patch)
+	}
+}
+
+func TestJSONPatchRoundTrip(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"count":1,"lines":[{"sku":"A"}],"tags":["x"]}`,
+		incrementInstruction("count", "2"),
+		scalarSet("lines[new].sku", "B"),
+		scalarSet("customer.name", "someone"),
+		eventsourceprocessor.EventInstruction{Path: "tags", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeString, Value: "y"},
+		eventsourceprocessor.EventInstruction{Path: "lines[first].sku", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	expected, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	patch, err := inputDoc.ToJSONPatch()
+	that.Nil(err)
+	event, err := eventsourceprocessor.JSONPatchToEvent(patch)
+	that.Nil(err)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(string(expected), string(result))
+}
+
+func TestJSONPatchToEventUnsupported_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, patch := range []string{
+		`[{"op":"test","path":"/a","value":1}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"add","path":"a","value":1}]`,
+		`[{"op":"add","path":"/a.b","value":1}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"remove"}]`,
+		`{"op":"remove","path":"/a"}`,
+	} {
+		_, err := eventsourceprocessor.JSONPatchToEvent([]byte(patch))
+		that.NotNil(err, patch)
+	}
+	_, err := eventsourceprocessor.JSONPatchToEvent([]byte(`[{"op":"test","path":"/a","value":1}]`))
+	that.ErrorContains(err, "JSON patch operation 0 (test): `test` operations aren't supported")
+}
+
+func TestJSONPointerPaths(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"order":{"lines":[{"sku":"A"}]},"a/b":{"c~d":1}}`,
+		scalarSet("/order/lines/0/sku", "B"),
+		scalarSet("/order/lines/-/sku", "C"),
+		scalarSet("/order/customer/name", "someone"),
+		eventsourceprocessor.EventInstruction{Path: "/a~1b/c~0d", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "2"},
+		scalarSet("/a~1b/~01", "tilde-one"),
+		copyInstruction("/order/customer", "copied"),
+		scalarSet("order.status", "native"), // The native syntax still works alongside
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{
+		"order":{"lines":[{"sku":"B"},{"sku":"C"}],"customer":{"name":"someone"},"status":"native"},
+		"a/b":{"c~d":2,"~1":"tilde-one"},
+		"copied":{"name":"someone"}
+	}`, string(result))
+}
+
+func TestJSONPointerPathsInvalid_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, path := range []string{"/", "/a//b", "/a.b", "/a[0]"} {
+		_, err := inlineDocument(`{}`, scalarSet(path, "x")).GetCurrentState()
+		that.ErrorContains(err, "can't be expressed as a path", path)
+	}
+}
+
+func TestJSONPatchToEventRemoveArrayElement(t *testing.T) {
+	that := assert.New(t)
+	event, err := eventsourceprocessor.JSONPatchToEvent([]byte(`[{"op":"remove","path":"/lines/1"}]`))
+	that.Nil(err)
+	that.Equal(eventsourceprocessor.EventInstruction{Path: "lines[1]", ActionType: eventsourceprocessor.ActionTypeRemove}, event.Instructions[0])
+
+	inputDoc := inlineDocument(`{"lines":[{"sku":"A"},{"sku":"B"},{"sku":"C"}]}`)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"lines":[{"sku":"A"},{"sku":"C"}]}`, string(result))
+}
@@ -0,0 +1,53 @@
+package eventsourceprocessor
+
+import "sort"
+
+// KeyOrder determines the order in which the properties of each object are output.
+type KeyOrder string
+
+const (
+	KeyOrderSorted   KeyOrder = "sorted"   // Properties are sorted by name (the default)
+	KeyOrderDocument KeyOrder = "document" // Properties keep the order they appear in the base document, with new ones added at the end
+)
+
+// add puts an element into the map, remembering the order in which new keys arrived.
+func (docMap *documentMap) add(key string, elem *documentElement) {
+	if _, exists := docMap.Elements[key]; !exists {
+		docMap.Order = append(docMap.Order, key)
+	}
+	docMap.Elements[key] = elem
+}
+
+// remove takes an element out of the map, forgetting where its key was; if it's added again, it goes at the end.
+func (docMap *documentMap) remove(key string) {
+	delete(docMap.Elements, key)
+	for i, orderedKey := range docMap.Order {
+		if orderedKey == key {
+			docMap.Order = append(docMap.Order[:i], docMap.Order[i+1:]...)
+			break
+		}
+	}
+}
+
+// keys returns the keys of the map in the configured output order. In document order, keys which were added without
+// their order being recorded come last, sorted by name.
+func (docMap *documentMap) keys(config *settings) []string {
+	keys := make([]string, 0, len(docMap.Elements))
+	seen := make(map[string]bool, len(docMap.Elements))
+	if config.KeyOrder == KeyOrderDocument {
+		for _, key := range docMap.Order {
+			if _, exists := docMap.Elements[key]; exists && !seen[key] {
+				keys = append(keys, key)
+				seen[key] = true
+			}
+		}
+	}
+	unordered := make([]string, 0, len(docMap.Elements)-len(keys))
+	for key := range docMap.Elements {
+		if !seen[key] {
+			unordered = append(unordered, key)
+		}
+	}
+	sort.Strings(unordered)
+	return append(keys, unordered...)
+}
@@ -0,0 +1,60 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+const unorderedDocument = `{"zebra":1,"apple":{"y":true,"x":null},"mango":[{"b":"2","a":"1"}],"kiwi":"k"}`
+
+func TestKeyOrderSortedByDefault(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(unorderedDocument, eventsourceprocessor.EventInstruction{
+		Path:       "banana",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "b",
+	})
+	first, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	for i := 0; i < 20; i++ {
+		again, err := inputDoc.GetCurrentState()
+		that.Nil(err)
+		that.Equal(string(first), string(again))
+	}
+	that.Equal(`{"apple":{"x":null,"y":true},"banana":"b","kiwi":"k","mango":[{"a":"1","b":"2"}],"zebra":1}`, string(first))
+}
+
+func TestKeyOrderDocument(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.KeyOrder = eventsourceprocessor.KeyOrderDocument })
+	inputDoc := inlineDocument(unorderedDocument,
+		eventsourceprocessor.EventInstruction{Path: "banana", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "b"},
+		eventsourceprocessor.EventInstruction{Path: "apple.w", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "w"},
+		eventsourceprocessor.EventInstruction{Path: "mango[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"d":4,"c":3}`},
+		// A removed key which comes back goes to the end
+		eventsourceprocessor.EventInstruction{Path: "zebra", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "zebra", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "2"},
+	)
+	first, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	for i := 0; i < 20; i++ {
+		again, err := inputDoc.GetCurrentState()
+		that.Nil(err)
+		that.Equal(string(first), string(again))
+	}
+	that.Equal(`{"apple":{"y":true,"x":null,"w":"w"},"mango":[{"b":"2","a":"1"},{"d":4,"c":3}],"kiwi":"k","banana":"b","zebra":2}`, string(first))
+}
+
+func TestKeyOrderDocumentDuplicateKeys(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.KeyOrder = eventsourceprocessor.KeyOrderDocument })
+	inputDoc := inlineDocument(`{"b":{"x":1},"a":1,"b":2}`)
+	outputDoc, err := inputDoc.GetCurrentState()
+
+	// As json.Unmarshal, the last duplicate wins
+	that.Nil(err)
+	that.Equal(`{"b":2,"a":1}`, string(outputDoc))
+}
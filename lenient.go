@@ -0,0 +1,94 @@
+package eventsourceprocessor
+
+// GetCurrentStateLenient works like GetCurrentState, except that a failing instruction doesn't stop the others: it's
+// skipped, its error recorded (as an InstructionError, saying which it was), and the rest are applied. This suits bulk
+// imports, where as much as possible should land. No errors means everything applied cleanly.
+//
+//	An instruction which fails part way through is taken back out: any parents of its path it created are removed.
+//	If the base document itself is invalid, nothing can be applied, and its error is the only one.
+func (doc Document) GetCurrentStateLenient() ([]byte, []error) {
+	return doc.currentStateLenient(currentSettings())
+}
+
+// GetCurrentStateLenient works like Document.GetCurrentStateLenient, using the processor's configuration.
+func (processor *Processor) GetCurrentStateLenient(doc Document) ([]byte, []error) {
+	return doc.currentStateLenient(processor.config)
+}
+
+// currentStateLenient does the work of GetCurrentStateLenient, with the supplied settings.
+func (doc Document) currentStateLenient(config *settings) ([]byte, []error) {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var errs []error
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		afterInstruction: func(_, _ int, _ EventInstruction, err error, skipped bool) error {
+			if err != nil && !skipped {
+				errs = append(errs, err)
+			}
+			return nil
+		},
+		keepGoing: true,
+	})
+	if err != nil {
+		// e.g. cancelled, or ValidateBeforeApply found a bad instruction
+		return nil, append(errs, err)
+	}
+
+	result, err := docMap.buildResult(config)
+	if err != nil {
+		return nil, append(errs, err)
+	}
+	return result, errs
+}
+
+// undoLog records how to undo the changes an instruction makes while finding its path - the objects, arrays and array
+// elements it creates on the way - so they can be removed again if the instruction then fails.
+type undoLog struct {
+	steps []func()
+}
+
+// recordUndo adds a step to the undo log, if one is being kept.
+func (config *settings) recordUndo(step func()) {
+	if config.undo != nil {
+		config.undo.steps = append(config.undo.steps, step)
+	}
+}
+
+// rollback undoes every recorded change, most recent first.
+func (log *undoLog) rollback() {
+	if log == nil {
+		return
+	}
+	for i := len(log.steps) - 1; i >= 0; i-- {
+		log.steps[i]()
+	}
+	log.reset()
+}
+
+// reset forgets the recorded changes, ready for the next instruction.
+func (log *undoLog) reset() {
+	if log != nil {
+		log.steps = log.steps[:0]
+	}
+}
+
+// create adds a new element to the map, which was missing from a path being followed.
+func (docMap *documentMap) create(config *settings, key string, elem *documentElement) {
+	docMap.add(key, elem)
+	config.recordUndo(func() { docMap.remove(key) })
+}
+
+// makeContainer turns a null element into an empty map or array, for a path to carry on through.
+func (elem *documentElement) makeContainer(config *settings, dataType DataType) {
+	previous := *elem
+	config.recordUndo(func() { *elem = previous })
+	elem.ElementType = dataType
+	if dataType == DataTypeMap {
+		elem.Content = &documentMap{Elements: make(map[string]*documentElement)}
+	} else {
+		elem.ArrayContent = make([]*documentElement, 0)
+	}
+}
@@ -0,0 +1,71 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCurrentStateLenient(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"new","lines":[]}`,
+		scalarSet("status", "paid"),
+		eventsourceprocessor.EventInstruction{Path: "missing.field", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+		scalarSet("lines[new].sku", "A"),
+	)
+	inputDoc.Events = append(inputDoc.Events, setEvent(1, "customer.name", "someone"))
+
+	result, errs := inputDoc.GetCurrentStateLenient()
+
+	that.JSONEq(`{"status":"paid","lines":[{"sku":"A"}],"customer":{"name":"someone"}}`, string(result))
+	if that.Len(errs, 1) {
+		var instructionErr eventsourceprocessor.InstructionError
+		if that.ErrorAs(errs[0], &instructionErr) {
+			that.Equal(0, instructionErr.EventIndex)
+			that.Equal(1, instructionErr.InstructionIndex)
+			that.Equal("missing.field", instructionErr.Path)
+		}
+	}
+}
+
+func TestGetCurrentStateLenientClean(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, scalarSet("a", "b"))
+
+	result, errs := inputDoc.GetCurrentStateLenient()
+
+	that.Empty(errs)
+	that.JSONEq(`{"a":"b"}`, string(result))
+}
+
+func TestGetCurrentStateLenientInvalidBase_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":`, scalarSet("a", "b"))
+
+	result, errs := inputDoc.GetCurrentStateLenient()
+
+	that.Nil(result)
+	that.Len(errs, 1)
+}
+
+func TestGetCurrentStateLenientUndoesCreatedParents(t *testing.T) {
+	that := assert.New(t)
+	badNumber := func(path string) eventsourceprocessor.EventInstruction {
+		return eventsourceprocessor.EventInstruction{Path: path, ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "many"}
+	}
+	inputDoc := inlineDocument(`{"a":1,"lines":[],"empty":null}`,
+		eventsourceprocessor.EventInstruction{Path: "x.y.z", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"broken"`},
+		badNumber("lines[new].qty"),
+		badNumber("empty.qty"),
+		badNumber("grid[new][new]"),
+		eventsourceprocessor.EventInstruction{Path: "empty", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeMap, Value: `[1]`},
+		eventsourceprocessor.EventInstruction{Path: "list", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeMap, Value: `[1]`},
+		scalarSet("b", "kept"),
+	)
+
+	result, errs := inputDoc.GetCurrentStateLenient()
+
+	that.Len(errs, 6)
+	that.JSONEq(`{"a":1,"lines":[],"empty":null,"b":"kept"}`, string(result))
+}
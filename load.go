@@ -0,0 +1,49 @@
+package eventsourceprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// LoadAndApply reads a base document, and a sequence of event files, from disk; then applies the events and returns
+// the resulting document. Each event file holds a JSON array of EventInstructions, and becomes one event.
+func LoadAndApply(baseFile string, eventFiles []string) ([]byte, error) {
+	return loadAndApply(os.ReadFile, baseFile, eventFiles)
+}
+
+// LoadAndApplyFS works like LoadAndApply, but reads the files from fsys.
+func LoadAndApplyFS(fsys fs.FS, baseFile string, eventFiles []string) ([]byte, error) {
+	return loadAndApply(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}, baseFile, eventFiles)
+}
+
+func loadAndApply(readFile func(name string) ([]byte, error), baseFile string, eventFiles []string) ([]byte, error) {
+	baseDocument, err := readFile(baseFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load base document: %w", err)
+	}
+	doc := Document{
+		BaseDocument: baseDocument,
+		Events:       []DocumentEvent{},
+	}
+
+	for _, eventFile := range eventFiles {
+		instructionSource, err := readFile(eventFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load event file: %w", err)
+		}
+		var instructions []EventInstruction
+		err = json.Unmarshal(instructionSource, &instructions)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode event file %s: %w", eventFile, err)
+		}
+		doc.Events = append(doc.Events, DocumentEvent{
+			Instructions: instructions,
+		})
+	}
+
+	return doc.GetCurrentState()
+}
@@ -0,0 +1,54 @@
+package eventsourceprocessor_test
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAndApply(t *testing.T) {
+	that := assert.New(t)
+	expected, err := buildDocument("TestLoadAndApply", "base.json", []string{"event1.json", "event2.json"}).GetCurrentState()
+	that.Nil(err)
+
+	result, err := eventsourceprocessor.LoadAndApply("./test_data/base.json", []string{"./test_data/event1.json", "./test_data/event2.json"})
+
+	that.Nil(err)
+	that.JSONEq(string(expected), string(result))
+}
+
+func TestLoadAndApplyFS(t *testing.T) {
+	that := assert.New(t)
+	expected, err := buildDocument("TestLoadAndApplyFS", "emptyBase.json", []string{"event6c.json"}).GetCurrentState()
+	that.Nil(err)
+
+	result, err := eventsourceprocessor.LoadAndApplyFS(os.DirFS("test_data"), "emptyBase.json", []string{"event6c.json"})
+
+	that.Nil(err)
+	that.JSONEq(string(expected), string(result))
+}
+
+func TestLoadAndApplyMissingFile_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.LoadAndApply("./test_data/base.json", []string{"./test_data/noSuchEvent.json"})
+
+	if that.NotNil(err) {
+		that.ErrorIs(err, os.ErrNotExist)
+	}
+}
+
+func TestLoadAndApplyFSInvalidEventFile_Fail(t *testing.T) {
+	that := assert.New(t)
+	fsys := fstest.MapFS{
+		"base.json":  {Data: []byte(`{}`)},
+		"event.json": {Data: []byte(`{"Path":"not an array"}`)},
+	}
+	_, err := eventsourceprocessor.LoadAndApplyFS(fsys, "base.json", []string{"event.json"})
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "unable to decode event file event.json")
+	}
+}
@@ -0,0 +1,68 @@
+package eventsourceprocessor_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubLogger collects the lines logged to it.
+type stubLogger struct {
+	lines []string
+}
+
+func (logger *stubLogger) Printf(format string, v ...interface{}) {
+	logger.lines = append(logger.lines, fmt.Sprintf(format, v...))
+}
+
+// badValueDocument has map and array values which are valid JSON, but can't be decoded, as their numbers are too big.
+func badValueDocument() eventsourceprocessor.Document {
+	return inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"b":1e999}`},
+		eventsourceprocessor.EventInstruction{Path: "c", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeArray, Value: `[1e999]`},
+	)
+}
+
+func TestLogger(t *testing.T) {
+	that := assert.New(t)
+	logger := &stubLogger{}
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.Logger = logger })
+
+	result, errs := badValueDocument().GetCurrentStateLenient()
+
+	that.Len(errs, 2)
+	// The elements created for the values, which then couldn't be set, are removed again
+	that.JSONEq(`{}`, string(result))
+	if that.Len(logger.lines, 2) {
+		that.Contains(logger.lines[0], "error unmarshalling instruction value `{\"b\":1e999}`")
+		that.Contains(logger.lines[1], "error unmarshalling instruction value `[1e999]`")
+	}
+}
+
+func TestLoggerStandardLibrary(t *testing.T) {
+	that := assert.New(t)
+	var out bytes.Buffer
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{Logger: log.New(&out, "esp: ", 0)})
+
+	_, err := processor.GetCurrentState(badValueDocument())
+
+	that.Error(err)
+	that.Equal("esp: error unmarshalling instruction value `{\"b\":1e999}`: number 1e999 can't be represented as a float64: strconv.ParseFloat: parsing \"1e999\": value out of range\n", out.String())
+}
+
+func TestLoggerDefaultIsSilent(t *testing.T) {
+	that := assert.New(t)
+	var out bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	_, err := badValueDocument().GetCurrentState()
+
+	that.Error(err)
+	that.Zero(out.Len())
+}
@@ -0,0 +1,50 @@
+package eventsourceprocessor
+
+import "fmt"
+
+// mergeElement deep-merges the instruction's map value into the object at its path, creating the path if it doesn't
+// exist. An empty path merges into the document itself, which must be an object.
+func (docMap *documentMap) mergeElement(config *settings, instruction EventInstruction) error {
+	if instruction.DataType != DataTypeMap {
+		return fmt.Errorf("%w: the %s action needs a map value, not a %s", ErrInvalidDataType, instruction.ActionType, instruction.DataType)
+	}
+	patch := &documentElement{}
+	err := patch.setValue(config, DataTypeMap, instruction.Value)
+	if err != nil {
+		return err
+	}
+
+	if instruction.Path == "" {
+		if docMap.IsArray || docMap.IsScalar {
+			return fmt.Errorf("%w: the %s action can only merge into a document which is an object", ErrInvalidDataType, instruction.ActionType)
+		}
+		root := &documentElement{ElementType: DataTypeMap, Content: docMap}
+		root.merge(config, patch)
+		return nil
+	}
+	elem, err := docMap.locate(config, instruction.Path, true)
+	if err != nil {
+		return err
+	}
+	elem.merge(config, patch)
+	return nil
+}
+
+// merge deep-merges patch into elem. Where both are objects, each property of patch is merged into the property of
+// elem with the same name (matched as paths are), or added if there isn't one; otherwise patch overwrites elem.
+func (elem *documentElement) merge(config *settings, patch *documentElement) {
+	if elem.ElementType != DataTypeMap || elem.Content == nil || patch.ElementType != DataTypeMap {
+		name := elem.Name
+		*elem = *patch
+		elem.Name = name
+		return
+	}
+	for _, key := range patch.Content.keys(config) {
+		property := patch.Content.Elements[key]
+		if _, existing := elem.Content.findElement(config, key); existing != nil {
+			existing.merge(config, property)
+		} else {
+			elem.Content.add(key, property)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func mergeInstruction(path string, value string) eventsourceprocessor.EventInstruction {
+	return eventsourceprocessor.EventInstruction{Path: path, ActionType: eventsourceprocessor.ActionTypeMerge, DataType: eventsourceprocessor.DataTypeMap, Value: value}
+}
+
+func TestMergeKeepsExistingProperties(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"obj":{"a":1}}`, mergeInstruction("obj", `{"b":2}`))
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"obj":{"a":1,"b":2}}`, string(result))
+}
+
+func TestMergeIntoRoot(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":1}`, mergeInstruction("", `{"b":2}`))
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"a":1,"b":2}`, string(result))
+}
+
+func TestMergeIsDeep(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"customer":{"name":"someone","address":{"city":"Leeds","postcode":"LS1"},"tags":["a","b"],"note":{"text":"hi"}}}`,
+		mergeInstruction("Customer", `{"address":{"City":"York"},"tags":["c"],"note":null,"email":"someone@example.com"}`),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	// Objects merge, matching names as paths do; arrays and nulls overwrite
+	that.Nil(err)
+	that.JSONEq(`{"customer":{"name":"someone","address":{"city":"York","postcode":"LS1"},"tags":["c"],"note":null,"email":"someone@example.com"}}`, string(result))
+}
+
+func TestMergeCreatesPath(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":"scalar"}`,
+		mergeInstruction("new.object", `{"b":2}`),
+		mergeInstruction("a", `{"c":3}`),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	// A missing object is created, and anything which isn't an object is overwritten
+	that.Nil(err)
+	that.JSONEq(`{"new":{"object":{"b":2}},"a":{"c":3}}`, string(result))
+}
+
+func TestMergeNonMapValue_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":{}}`, eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeMerge, DataType: eventsourceprocessor.DataTypeArray, Value: `[1]`})
+	_, err := inputDoc.GetCurrentState()
+
+	that.True(errors.Is(err, eventsourceprocessor.ErrInvalidDataType))
+}
+
+func mapSetDocument() eventsourceprocessor.Document {
+	return inlineDocument(`{"obj":{"a":1,"nested":{"x":1,"y":2}}}`,
+		eventsourceprocessor.EventInstruction{Path: "obj", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"b":2,"nested":{"y":3}}`},
+	)
+}
+
+func TestMapSetReplacesByDefault(t *testing.T) {
+	that := assert.New(t)
+	result, err := mapSetDocument().GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"obj":{"b":2,"nested":{"y":3}}}`, string(result))
+}
+
+func TestMapSetMerges(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.MapSetMerges = true })
+	inputDoc := mapSetDocument()
+	inputDoc.Events[0].Instructions = append(inputDoc.Events[0].Instructions,
+		eventsourceprocessor.EventInstruction{Path: "created", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"c":3}`},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"obj":{"a":1,"b":2,"nested":{"x":1,"y":3}},"created":{"c":3}}`, string(result))
+}
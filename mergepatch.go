@@ -0,0 +1,95 @@
+package eventsourceprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// MergePatchToEvent converts a JSON Merge Patch (RFC 7386) into an equivalent event. Each member of the patch becomes
+// a SetOrAdd instruction, nested objects are merged member-by-member, and arrays replace the target array wholesale.
+// Each nested object starts with a Merge of `{}`, which leaves an existing object as it is but replaces anything else
+// with an empty object, as the RFC requires; so `{"e":{}}` still creates `e`.
+//
+//	A null in the patch becomes a Remove instruction, as the RFC requires - or, if Configuration.MergePatchNullSetsNull
+//	is set, a SetOrAdd of JSON null. The RFC treats removing a missing member as a no-op; to match that when the
+//	event is applied, set Configuration.RemoveNonExistantElementIsError to false. Member names which can't be expressed
+//	as paths are an error, as for Diff.
+func MergePatchToEvent(patch []byte) (DocumentEvent, error) {
+	return mergePatchToEvent(currentSettings(), patch)
+}
+
+// MergePatchToEvent works like the package-level MergePatchToEvent, using the processor's configuration.
+func (processor *Processor) MergePatchToEvent(patch []byte) (DocumentEvent, error) {
+	return mergePatchToEvent(processor.config, patch)
+}
+
+// mergePatchToEvent does the work of MergePatchToEvent, with the supplied settings.
+func mergePatchToEvent(config *settings, patch []byte) (DocumentEvent, error) {
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.UseNumber()
+	var patchObject interface{}
+	err := decoder.Decode(&patchObject)
+	if err != nil {
+		return DocumentEvent{}, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	members, isObject := patchObject.(map[string]interface{})
+	if !isObject {
+		return DocumentEvent{}, errors.New("invalid merge patch: the patch must be a JSON object")
+	}
+
+	event := DocumentEvent{}
+	err = mergePatchInstructions(config, members, "", &event.Instructions)
+	if err != nil {
+		return DocumentEvent{}, err
+	}
+	return event, nil
+}
+
+// mergePatchInstructions appends the instructions for one (possibly nested) patch object.
+func mergePatchInstructions(config *settings, members map[string]interface{}, parentPath string, instructions *[]EventInstruction) error {
+	// Sort the members, so the same patch always produces the same event
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// Members are checked as Diff checks property names, e.g. an empty name would otherwise replace the document
+		path, err := diffPropertyPath(config, parentPath, name)
+		if err != nil {
+			return fmt.Errorf("invalid merge patch member: %w", err)
+		}
+
+		switch value := members[name].(type) {
+		case nil:
+			if config.MergePatchNullSetsNull {
+				*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd, DataType: DataTypeNull})
+			} else {
+				*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeRemove})
+			}
+		case map[string]interface{}:
+			*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeMerge, DataType: DataTypeMap, Value: "{}"})
+			err = mergePatchInstructions(config, value, path, instructions)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("merge patch member `%s`: %w", path, err)
+			}
+			*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd, DataType: DataTypeArray, Value: string(encoded)})
+		case string:
+			*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd, DataType: DataTypeString, Value: value})
+		case json.Number:
+			*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd, DataType: DataTypeNumber, Value: value.String()})
+		case bool:
+			*instructions = append(*instructions, EventInstruction{Path: path, ActionType: ActionTypeSetOrAdd, DataType: DataTypeBool, Value: fmt.Sprint(value)})
+		}
+	}
+	return nil
+}
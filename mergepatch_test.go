@@ -0,0 +1,92 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+const mergePatch = `{
+	"stringField": "patched",
+	"numberField": 12.50,
+	"nullField": null,
+	"objectField": {"objectName": null, "objectValue": true, "newName": "added"},
+	"arrayField": ["replaced", 1]
+}`
+
+func TestMergePatchNullRemoves(t *testing.T) {
+	that := assert.New(t)
+	event, err := eventsourceprocessor.MergePatchToEvent([]byte(mergePatch))
+	that.Nil(err)
+	that.Contains(event.Instructions, eventsourceprocessor.EventInstruction{Path: "nullField", ActionType: eventsourceprocessor.ActionTypeRemove})
+	that.Contains(event.Instructions, eventsourceprocessor.EventInstruction{Path: "objectField.objectName", ActionType: eventsourceprocessor.ActionTypeRemove})
+
+	inputDoc := buildDocument("TestMergePatchNullRemoves", "base.json", nil)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrintObject("Input Document", inputDoc)
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"stringField":"patched"`)
+	that.Contains(string(outputDoc), `"numberField":12.50`)
+	that.Contains(string(outputDoc), `"objectValue":true`)
+	that.Contains(string(outputDoc), `"newName":"added"`)
+	that.Contains(string(outputDoc), `"objectId":"456"`) // Not mentioned in the patch, so merged around
+	that.Contains(string(outputDoc), `"arrayField":["replaced",1]`)
+	that.NotContains(string(outputDoc), `"nullField"`)
+	that.NotContains(string(outputDoc), `"objectName"`)
+}
+
+func TestMergePatchNullSetsNull(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.MergePatchNullSetsNull = true
+	})
+	event, err := eventsourceprocessor.MergePatchToEvent([]byte(mergePatch))
+	that.Nil(err)
+	that.Contains(event.Instructions, eventsourceprocessor.EventInstruction{Path: "objectField.objectName", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNull})
+
+	inputDoc := buildDocument("TestMergePatchNullSetsNull", "base.json", nil)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"nullField":null`)
+	that.Contains(string(outputDoc), `"objectName":null`)
+}
+
+func TestMergePatchNotAnObject_Fails(t *testing.T) {
+	that := assert.New(t)
+	for _, patch := range []string{`["a"]`, `"a"`, `{"a":`, `{"a.b":1}`, `{"":5}`, `{"a":{"^":1}}`, `{"/x":1}`, `{"a":{"b[0]":1}}`} {
+		_, err := eventsourceprocessor.MergePatchToEvent([]byte(patch))
+		that.NotNil(err, patch)
+	}
+}
+
+func TestMergePatchNestedObjects(t *testing.T) {
+	that := assert.New(t)
+	event, err := eventsourceprocessor.MergePatchToEvent([]byte(`{"s":{"y":1},"e":{},"o":{},"n":{"m":{"x":true}}}`))
+	that.Nil(err)
+
+	inputDoc := inlineDocument(`{"s":"str","o":{"a":1},"n":[1]}`)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{event}
+	result, err := inputDoc.GetCurrentState()
+
+	// Anything which isn't an object is replaced by one; an object is merged into
+	that.Nil(err)
+	that.JSONEq(`{"s":{"y":1},"e":{},"o":{"a":1},"n":{"m":{"x":true}}}`, string(result))
+}
+
+func TestMergePatchInexpressibleMember_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.MergePatchToEvent([]byte(`{"":5}`))
+	that.ErrorContains(err, "invalid merge patch member: property `` can't be expressed as a path")
+
+	_, err = eventsourceprocessor.MergePatchToEvent([]byte(`{"a":{"^":1}}`))
+	that.ErrorContains(err, "property `^` can't be expressed as a path")
+}
@@ -0,0 +1,129 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// moveOrCopy implements the Move and Copy actions, which take the element at the path held in the instruction's Value
+// (as JSON Patch's `from`) and put it at the instruction's Path, creating the path if need be. Move detaches the
+// source; Copy leaves it in place and puts a deep copy at the destination.
+func (docMap *documentMap) moveOrCopy(config *settings, instruction EventInstruction) error {
+	if instruction.Path == "" {
+		return fmt.Errorf("the %s action can't replace the document root", instruction.ActionType)
+	}
+	from, source, err := docMap.moveOrCopySource(config, instruction)
+	if err != nil {
+		return err
+	}
+
+	value := source.clone()
+	restore := func() {}
+	if instruction.ActionType == ActionTypeMove {
+		to, within := config.foldPath(instruction.Path), config.foldPath(from)
+		if strings.HasPrefix(to, within+".") || strings.HasPrefix(to, within+config.arrayOpen()) {
+			return fmt.Errorf("can't move `%s` inside itself, to `%s`", from, instruction.Path)
+		}
+		// As in JSON Patch, the destination is found once the source has gone, so indices see the shorter array
+		restore = docMap.detach(source)
+	}
+
+	destination, err := docMap.locate(config, instruction.Path, true)
+	if err != nil {
+		// Put the source back, so a move to somewhere unreachable doesn't lose it
+		restore()
+		return err
+	}
+	name := destination.Name
+	*destination = *value
+	destination.Name = name
+	return nil
+}
+
+// moveOrCopySource finds the element a Move or Copy takes, returning its (native) path. The source must exist, and is
+// found before anything is written; so an instruction whose source is missing fails without changing the document.
+func (docMap *documentMap) moveOrCopySource(config *settings, instruction EventInstruction) (string, *documentElement, error) {
+	if instruction.Value == "" {
+		return "", nil, fmt.Errorf("the %s action needs a source path in its value", instruction.ActionType)
+	}
+	from, err := nativePath(config, instruction.Value)
+	if err == nil {
+		from, err = resolveParentSegments(config, from)
+	}
+	if err == nil {
+		err = validatePath(config, from)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid %s source path: %w", instruction.ActionType, err)
+	}
+	if from == "" {
+		return "", nil, fmt.Errorf("the %s action can't take the document root as its source", instruction.ActionType)
+	}
+	source, err := getMapPathElement(config, from, false, docMap)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to find the %s source `%s`: %w", instruction.ActionType, from, err)
+	}
+	return from, source, nil
+}
+
+// clone makes a deep copy of an element, so the copy can be changed without affecting the original.
+func (elem *documentElement) clone() *documentElement {
+	copied := *elem
+	if elem.Content != nil {
+		copied.Content = &documentMap{
+			Elements: make(map[string]*documentElement, len(elem.Content.Elements)),
+			Order:    append([]string(nil), elem.Content.Order...),
+		}
+		for key, child := range elem.Content.Elements {
+			copied.Content.Elements[key] = child.clone()
+		}
+	}
+	if elem.ArrayContent != nil {
+		copied.ArrayContent = make([]*documentElement, len(elem.ArrayContent))
+		for i, child := range elem.ArrayContent {
+			copied.ArrayContent[i] = child.clone()
+		}
+	}
+	return &copied
+}
+
+// detach removes an element from wherever it is in the document. It returns a function which puts the element back
+// where it was, or nil if it wasn't found.
+func (docMap *documentMap) detach(target *documentElement) func() {
+	for key, elem := range docMap.Elements {
+		if elem == target {
+			order := append([]string(nil), docMap.Order...)
+			docMap.remove(key)
+			return func() {
+				docMap.Elements[key] = target
+				docMap.Order = order
+			}
+		}
+		if restore := elem.detach(target); restore != nil {
+			return restore
+		}
+	}
+	return nil
+}
+
+func (elem *documentElement) detach(target *documentElement) func() {
+	if elem.Content != nil {
+		if restore := elem.Content.detach(target); restore != nil {
+			return restore
+		}
+	}
+	for i, child := range elem.ArrayContent {
+		if child == target {
+			// Copied rather than shuffled down in place, as a snapshot may share the backing array
+			original := elem.ArrayContent
+			elem.ArrayContent = append(original[:i:i], original[i+1:]...)
+			return func() {
+				elem.ArrayContent = original
+			}
+		}
+		if restore := child.detach(target); restore != nil {
+			return restore
+		}
+	}
+	return nil
+}
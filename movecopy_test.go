@@ -0,0 +1,92 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func moveInstruction(from string, to string) eventsourceprocessor.EventInstruction {
+	return eventsourceprocessor.EventInstruction{Path: to, ActionType: eventsourceprocessor.ActionTypeMove, Value: from}
+}
+
+func copyInstruction(from string, to string) eventsourceprocessor.EventInstruction {
+	return eventsourceprocessor.EventInstruction{Path: to, ActionType: eventsourceprocessor.ActionTypeCopy, Value: from}
+}
+
+func TestMoveNestedField(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"customer":{"address":{"city":"Leeds","lines":["1 Street"]}},"orders":[{"id":1},{"id":2}]}`,
+		moveInstruction("customer.address", "billing.address"),
+		moveInstruction("orders[0]", "archived"),
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"customer":{},"billing":{"address":{"city":"Leeds","lines":["1 Street"]}},"orders":[{"id":2}],"archived":{"id":1}}`, string(result))
+}
+
+func TestCopyArray(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"tags":["a",{"b":1}]}`,
+		copyInstruction("tags", "backup.tags"),
+		// Changing the copy doesn't change the original
+		scalarSet("backup.tags[1].b", "changed"),
+		eventsourceprocessor.EventInstruction{Path: "backup.tags[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "c"},
+	)
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"tags":["a",{"b":1}],"backup":{"tags":["a",{"b":"changed"},"c"]}}`, string(result))
+}
+
+func TestMoveMissingSource_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := inlineDocument(`{"a":1}`, moveInstruction("b", "c")).GetCurrentState()
+
+	if that.NotNil(err) {
+		that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+		that.Contains(err.Error(), "unable to find the Move source `b`")
+	}
+}
+
+func TestMoveEmptySource_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := inlineDocument(`{"a":1}`, moveInstruction("", "c")).GetCurrentState()
+
+	that.ErrorContains(err, "the Move action needs a source path in its value")
+}
+
+func TestCopyMissingSource_ChangesNothing(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":1}`, copyInstruction("b.c", "d.e"), moveInstruction("a[first]", "f"))
+
+	result, errs := inputDoc.GetCurrentStateLenient()
+
+	if that.Len(errs, 2) {
+		that.True(errors.Is(errs[0], eventsourceprocessor.ErrElementNotFound))
+		that.ErrorContains(errs[0], "unable to find the Copy source `b.c`")
+	}
+	that.JSONEq(`{"a":1}`, string(result))
+	// ValidateStream finds the missing sources as it goes, too
+	that.Len(eventsourceprocessor.ValidateStream(inputDoc), 2)
+}
+
+func TestMoveInsideItself_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := inlineDocument(`{"a":{"b":1}}`, moveInstruction("a", "A.c")).GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "can't move `a` inside itself")
+	}
+}
+
+func TestMoveUnreachableDestination_KeepsSource(t *testing.T) {
+	that := assert.New(t)
+	result, errs := inlineDocument(`{"a":1,"s":["x"]}`, moveInstruction("a", "s[first].y")).GetCurrentStateLenient()
+
+	that.Len(errs, 1)
+	that.JSONEq(`{"a":1,"s":["x"]}`, string(result))
+}
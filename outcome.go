@@ -0,0 +1,205 @@
+package eventsourceprocessor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// OutcomeKind describes what applying an instruction did to the document.
+type OutcomeKind string
+
+const (
+	OutcomeCreated OutcomeKind = "created" // A new element was added
+	OutcomeUpdated OutcomeKind = "updated" // An existing element was overwritten
+	OutcomeRemoved OutcomeKind = "removed" // An element was removed
+	OutcomeNoOp    OutcomeKind = "noop"    // Nothing changed, e.g. a NoOp instruction, or removing something already absent
+	OutcomeSkipped OutcomeKind = "skipped" // The instruction was not applied, e.g. a bad value on a SkipValueErrorPaths path
+	OutcomeFailed  OutcomeKind = "failed"  // The instruction failed; no further instructions were applied
+)
+
+// InstructionOutcome is the result of applying a single instruction.
+type InstructionOutcome struct {
+	EventIndex       int         // Zero-based index of the event in Document.Events
+	InstructionIndex int         // Zero-based index of the instruction within the event
+	Path             string      // Path from the instruction
+	ResolvedPath     string      // Path with array selectors resolved to numeric indices where possible, e.g. `items[2]` for `items[new]`
+	Kind             OutcomeKind // What happened
+	Err              error       // Why the instruction was skipped or failed
+}
+
+// ApplyDetailed works like GetCurrentState, but also returns the outcome of each instruction, in order.
+//
+//	If an instruction fails, the outcomes up to and including the failed one are returned along with the error, an
+//	InstructionError saying which instruction it was.
+func (doc Document) ApplyDetailed() ([]InstructionOutcome, []byte, error) {
+	return doc.applyDetailed(currentSettings())
+}
+
+// ApplyDetailed works like Document.ApplyDetailed, using the processor's configuration.
+func (processor *Processor) ApplyDetailed(doc Document) ([]InstructionOutcome, []byte, error) {
+	return doc.applyDetailed(processor.config)
+}
+
+// applyDetailed does the work of ApplyDetailed, with the supplied settings.
+func (doc Document) applyDetailed(config *settings) ([]InstructionOutcome, []byte, error) {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var outcomes []InstructionOutcome
+	var outcome InstructionOutcome
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		beforeInstruction: func(eventIndex, instructionIndex int, instruction EventInstruction) {
+			resolvedPath, exists := docMap.resolvePath(config, instruction.Path)
+			outcome = InstructionOutcome{
+				EventIndex:       eventIndex,
+				InstructionIndex: instructionIndex,
+				Path:             instruction.Path,
+				ResolvedPath:     resolvedPath,
+				Kind:             expectedOutcome(instruction, exists),
+			}
+		},
+		afterInstruction: func(_, _ int, _ EventInstruction, err error, skipped bool) error {
+			switch {
+			case skipped:
+				outcome.Err, outcome.Kind = err, OutcomeSkipped
+			case err != nil:
+				outcome.Err, outcome.Kind = err, OutcomeFailed
+			}
+			outcomes = append(outcomes, outcome)
+			return nil
+		},
+	})
+	if err != nil {
+		return outcomes, nil, err
+	}
+
+	result, err := docMap.buildResult(config)
+	return outcomes, result, err
+}
+
+// expectedOutcome works out what an instruction will do if it succeeds, given whether its path exists beforehand.
+func expectedOutcome(instruction EventInstruction, exists bool) OutcomeKind {
+	switch {
+	case instruction.ActionType == ActionTypeNoOp:
+		return OutcomeNoOp
+	case instruction.ActionType == ActionTypeRemove && exists:
+		return OutcomeRemoved
+	case instruction.ActionType == ActionTypeRemove:
+		return OutcomeNoOp
+	case instruction.ActionType == ActionTypeSetOrAdd && !exists:
+		return OutcomeCreated
+	}
+	return OutcomeUpdated
+}
+
+// resolvePath follows a path through the document without changing it, replacing array selectors with the numeric
+// index they refer to. It also reports whether the path already exists. Once the path runs out of existing elements,
+// or meets a selector it can't resolve, the rest of the path is returned as given. The path is read the same way as
+// by applyInstruction, so e.g. an array without a selector only leads on if ImplicitFirstSelector is set.
+func (docMap *documentMap) resolvePath(config *settings, path string) (string, bool) {
+	path, err := nativePath(config, path)
+	if err == nil {
+		err = validatePath(config, path)
+	}
+	if err == nil {
+		path, err = resolveParentSegments(config, path)
+	}
+	if err != nil {
+		return path, false
+	}
+	if path == "" {
+		return "", true
+	}
+	segments := splitPath(config, path)
+	resolved := make([]string, 0, len(segments))
+	unresolved := func(i int, partial string) (string, bool) {
+		return strings.Join(append(append(resolved, partial), segments[i+1:]...), "."), false
+	}
+
+	root := rootElement(docMap)
+	current := root
+	for i, segment := range segments {
+		name, indexers := segment, ""
+		if strings.Contains(segment, config.arrayOpen()) {
+			name, indexers = getArrayIndexer(config, segment)
+		}
+		if current.ElementType == DataTypeArray && current != root && config.ImplicitFirstSelector {
+			// More path, but no selector: as getMapPathElement does, carry on in the first element
+			if len(current.ArrayContent) == 0 {
+				return unresolved(i, segment)
+			}
+			resolved[i-1] += config.arrayOpen() + "0" + config.arrayClose()
+			current = current.ArrayContent[0]
+		}
+
+		var elem *documentElement
+		resolvedSegment := name
+		switch {
+		case current == root && docMap.IsArray:
+			if name == "" {
+				elem = root // The root array has no name; any other name isn't a property of it
+			}
+		case current.ElementType == DataTypeMap && current.Content != nil:
+			_, elem = current.Content.findElement(config, name)
+			if elem != nil {
+				resolvedSegment = elem.Name
+			}
+		}
+		if elem == nil {
+			return unresolved(i, segment)
+		}
+
+		matchArrays := config.arrayRegex.FindAllString(indexers, -1)
+		for j, indexer := range matchArrays {
+			index, exists, ok := elem.resolveIndexer(config, indexer)
+			if !ok {
+				return unresolved(i, resolvedSegment+strings.Join(matchArrays[j:], ""))
+			}
+			resolvedSegment += config.arrayOpen() + strconv.Itoa(index) + config.arrayClose()
+			if !exists {
+				return unresolved(i, resolvedSegment+strings.Join(matchArrays[j+1:], ""))
+			}
+			elem = elem.ArrayContent[index]
+		}
+		resolved = append(resolved, resolvedSegment)
+		current = elem
+	}
+	return strings.Join(resolved, "."), true
+}
+
+// resolveIndexer works out which element of an array an indexer refers to, and whether that element exists yet.
+func (elem *documentElement) resolveIndexer(config *settings, indexer string) (index int, exists bool, ok bool) {
+	if elem.ElementType != DataTypeArray {
+		return 0, false, false
+	}
+	if key, value, isCondition := parseCondition(config, indexer); isCondition {
+		index = elem.findMatching(config, key, value)
+		if index < 0 {
+			// A new element would be appended
+			return len(elem.ArrayContent), false, true
+		}
+		return index, true, true
+	}
+	indexer = indexerName(config, indexer)
+	length := elem.selectorLength(config)
+	switch indexer {
+	case "first":
+		if length > 0 {
+			return 0, true, true
+		}
+		return length, length < len(elem.ArrayContent), true
+	case "new":
+		return length, length < len(elem.ArrayContent), true
+	case "last":
+		if length > 0 {
+			return len(elem.ArrayContent) - 1, true, true
+		}
+		return length, length < len(elem.ArrayContent), true
+	}
+	if index, err := strconv.Atoi(indexer); err == nil && index >= 0 && index <= len(elem.ArrayContent) {
+		return index, index < len(elem.ArrayContent), true
+	}
+	return 0, false, false
+}
@@ -0,0 +1,125 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDetailed(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.SkipValueErrorPaths = []string{"payload"}
+		c.RemoveNonExistantElementIsError = false
+	})
+	inputDoc := inlineDocument(`{"Status":"new","items":[{"sku":"A"}],"old":true}`,
+		eventsourceprocessor.EventInstruction{Path: "status", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "open"},
+		eventsourceprocessor.EventInstruction{Path: "owner.name", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "someone"},
+		eventsourceprocessor.EventInstruction{Path: "items[new].sku", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "B"},
+		eventsourceprocessor.EventInstruction{Path: "items[first].sku", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "C"},
+		eventsourceprocessor.EventInstruction{Path: "old", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "older", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "note", ActionType: eventsourceprocessor.ActionTypeNoOp, Value: "marker"},
+		eventsourceprocessor.EventInstruction{Path: "payload", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"broken"`},
+	)
+	outcomes, result, err := inputDoc.ApplyDetailed()
+
+	that.Nil(err)
+	that.JSONEq(`{"Status":"open","items":[{"sku":"C"},{"sku":"B"}],"owner":{"name":"someone"}}`, string(result))
+	expected := []struct {
+		resolvedPath string
+		kind         eventsourceprocessor.OutcomeKind
+	}{
+		{"Status", eventsourceprocessor.OutcomeUpdated},
+		{"owner.name", eventsourceprocessor.OutcomeCreated},
+		{"items[1].sku", eventsourceprocessor.OutcomeCreated},
+		{"items[0].sku", eventsourceprocessor.OutcomeUpdated},
+		{"old", eventsourceprocessor.OutcomeRemoved},
+		{"older", eventsourceprocessor.OutcomeNoOp},
+		{"note", eventsourceprocessor.OutcomeNoOp},
+		{"payload", eventsourceprocessor.OutcomeSkipped},
+	}
+	if that.Len(outcomes, len(expected)) {
+		for i, outcome := range outcomes {
+			that.Equal(i, outcome.InstructionIndex)
+			that.Equal(inputDoc.Events[0].Instructions[i].Path, outcome.Path)
+			that.Equal(expected[i].resolvedPath, outcome.ResolvedPath, outcome.Path)
+			that.Equal(expected[i].kind, outcome.Kind, outcome.Path)
+		}
+		that.NotNil(outcomes[7].Err)
+	}
+}
+
+func TestApplyDetailedFailure(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"new"}`,
+		eventsourceprocessor.EventInstruction{Path: "status", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "open"},
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "value"},
+		eventsourceprocessor.EventInstruction{Path: "status", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "closed"},
+	)
+	outcomes, result, err := inputDoc.ApplyDetailed()
+
+	that.NotNil(err)
+	that.Nil(result)
+	if that.Len(outcomes, 2) {
+		that.Equal(eventsourceprocessor.OutcomeUpdated, outcomes[0].Kind)
+		that.Equal(eventsourceprocessor.OutcomeFailed, outcomes[1].Kind)
+		that.Equal(err, outcomes[1].Err)
+	}
+	var instructionErr eventsourceprocessor.InstructionError
+	if that.ErrorAs(err, &instructionErr) {
+		that.Equal(1, instructionErr.InstructionIndex)
+		that.ErrorIs(err, eventsourceprocessor.ErrElementNotFound)
+	}
+}
+
+func TestApplyDetailedRootHolderNames(t *testing.T) {
+	that := assert.New(t)
+	for _, test := range []struct {
+		base string
+		path string
+	}{
+		{`[{"sku":"A"}]`, "array"},
+		{`[{"sku":"A"}]`, "array[0].sku"},
+		{`"text"`, "value"},
+	} {
+		inputDoc := inlineDocument(test.base,
+			eventsourceprocessor.EventInstruction{Path: test.path, ActionType: eventsourceprocessor.ActionTypeRemove},
+		)
+		outcomes, _, _ := inputDoc.ApplyDetailed()
+
+		if that.Len(outcomes, 1, test.path) {
+			that.Equal(test.path, outcomes[0].ResolvedPath, test.path)
+			that.NotEqual(eventsourceprocessor.OutcomeRemoved, outcomes[0].Kind, test.path)
+		}
+	}
+}
+
+func TestApplyDetailedImplicitFirstSelector(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.ImplicitFirstSelector = true })
+	inputDoc := inlineDocument(`{"items":[{"sku":"A"},{"sku":"B"}],"empty":[]}`,
+		eventsourceprocessor.EventInstruction{Path: "items.sku", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "C"},
+		eventsourceprocessor.EventInstruction{Path: "items.qty", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "1"},
+		eventsourceprocessor.EventInstruction{Path: "empty.sku", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "D"},
+	)
+	outcomes, result, err := inputDoc.ApplyDetailed()
+
+	that.Nil(err)
+	that.JSONEq(`{"items":[{"sku":"C","qty":1},{"sku":"B"}],"empty":[{"sku":"D"}]}`, string(result))
+	expected := []struct {
+		resolvedPath string
+		kind         eventsourceprocessor.OutcomeKind
+	}{
+		{"items[0].sku", eventsourceprocessor.OutcomeUpdated},
+		{"items[0].qty", eventsourceprocessor.OutcomeCreated},
+		{"empty.sku", eventsourceprocessor.OutcomeCreated},
+	}
+	if that.Len(outcomes, len(expected)) {
+		for i, outcome := range outcomes {
+			that.Equal(expected[i].resolvedPath, outcome.ResolvedPath, outcome.Path)
+			that.Equal(expected[i].kind, outcome.Kind, outcome.Path)
+		}
+	}
+}
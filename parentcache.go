@@ -0,0 +1,69 @@
+package eventsourceprocessor
+
+import "strings"
+
+// Within an event, it's common for many instructions to set fields of the same object, e.g. `order.customer.name`,
+// `order.customer.email` and so on. Rather than traversing from the document root for each one, the setters remember
+// the map holding each parent path they've resolved. The cache only holds plain paths (no array indexers, which can
+// refer to different elements from one instruction to the next), and is thrown away whenever an instruction might
+// have changed the structure of the document.
+
+// startParentCache gives the document an empty parent cache, ready for a new event.
+func (docMap *documentMap) startParentCache() {
+	docMap.parents = make(map[string]*documentMap)
+}
+
+// locate finds the element at path, as getMapPathElement does, via the parent cache where possible.
+func (docMap *documentMap) locate(config *settings, path string, createIfMissing bool) (*documentElement, error) {
+	lastDot := strings.LastIndex(path, ".")
+	if docMap.parents == nil || lastDot < 0 || strings.Contains(path, config.arrayOpen()) {
+		return getMapPathElement(config, path, createIfMissing, docMap)
+	}
+	parentPath, name := path[:lastDot], path[lastDot+1:]
+
+	// Keyed by the path as written: with case-insensitive paths, `Foo` and `foo` may still find different elements
+	key := parentPath
+	parent, found := docMap.parents[key]
+	if !found {
+		parentElem, err := getMapPathElement(config, parentPath, createIfMissing, docMap)
+		if err != nil || parentElem.ElementType != DataTypeMap {
+			// Let the full traversal deal with it - e.g. turning a null into a map, or reporting the error
+			return getMapPathElement(config, path, createIfMissing, docMap)
+		}
+		parent = parentElem.Content
+		docMap.parents[key] = parent
+	}
+	return getMapPathElement(config, name, createIfMissing, parent)
+}
+
+// foldPath returns a path in the form used to compare paths which may refer to the same element: lower case, unless
+// CaseSensitivePaths is set.
+func (config *settings) foldPath(path string) string {
+	if config.CaseSensitivePaths {
+		return path
+	}
+	return strings.ToLower(path)
+}
+
+// forgetParents removes anything an instruction may have made stale from the parent cache. Setting a plain path to a
+// scalar can only affect what's cached beneath it (as it may have been a map); anything else, or an instruction which
+// failed part way through, could have restructured the document, so the whole cache goes.
+func (docMap *documentMap) forgetParents(config *settings, instruction EventInstruction, err error) {
+	if docMap.parents == nil {
+		return
+	}
+	scalarSet := (instruction.ActionType == ActionTypeSetOrAdd || instruction.ActionType == ActionTypeSetOnly) &&
+		instruction.DataType != DataTypeMap && instruction.DataType != DataTypeArray &&
+		!strings.Contains(instruction.Path, config.arrayOpen())
+	if err != nil || !scalarSet {
+		docMap.startParentCache()
+		return
+	}
+	path := config.foldPath(instruction.Path)
+	for key := range docMap.parents {
+		folded := config.foldPath(key)
+		if folded == path || strings.HasPrefix(folded, path+".") {
+			delete(docMap.parents, key)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func scalarSet(path string, value string) eventsourceprocessor.EventInstruction {
+	return eventsourceprocessor.EventInstruction{Path: path, ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: value}
+}
+
+// oneEventPerInstruction splits a document's single event into one event per instruction - so nothing is carried
+// between instructions, as each event starts afresh.
+func oneEventPerInstruction(doc eventsourceprocessor.Document) eventsourceprocessor.Document {
+	split := eventsourceprocessor.Document{BaseDocument: doc.BaseDocument}
+	for _, instruction := range doc.Events[0].Instructions {
+		split.Events = append(split.Events, eventsourceprocessor.DocumentEvent{Instructions: []eventsourceprocessor.EventInstruction{instruction}})
+	}
+	return split
+}
+
+func TestParentCacheMatchesUncached(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"order":{"customer":{"name":"someone"},"lines":[]}}`,
+		scalarSet("order.customer.name", "someone else"),
+		scalarSet("Order.Customer.email", "someone@example.com"),
+		// Replace a cached parent with a scalar
+		scalarSet("order.customer", "anonymous"),
+		// Replace a cached parent with a new map
+		eventsourceprocessor.EventInstruction{Path: "order.billing", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"city":"Leeds"}`},
+		scalarSet("order.billing.postcode", "LS1"),
+		eventsourceprocessor.EventInstruction{Path: "order.billing", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{}`},
+		scalarSet("order.billing.city", "York"),
+		// Remove a cached parent, then recreate it
+		eventsourceprocessor.EventInstruction{Path: "order.billing", ActionType: eventsourceprocessor.ActionTypeRemove},
+		scalarSet("order.billing.city", "Hull"),
+		// Parents inside arrays
+		eventsourceprocessor.EventInstruction{Path: "order.lines[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"sku":"A"}`},
+		scalarSet("order.lines[0].qty", "1"),
+		eventsourceprocessor.EventInstruction{Path: "order.lines[first]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		scalarSet("order.lines[new].sku", "B"),
+	)
+	cached, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+	uncached, err := oneEventPerInstruction(inputDoc).GetCurrentState()
+	that.Nil(err)
+
+	that.JSONEq(string(uncached), string(cached))
+	that.JSONEq(`{"order":{"customer":"anonymous","billing":{"city":"Hull"},"lines":[{"sku":"B"}]}}`, string(cached))
+}
+
+func TestParentCacheScalarParent_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"order":{"customer":{"name":"someone"}}}`,
+		scalarSet("order.customer.name", "someone else"),
+		// Replace a cached parent with a scalar, then try to carry on past it
+		scalarSet("order.customer", "anonymous"),
+		scalarSet("order.customer.name", "ignored?"),
+	)
+	_, err := inputDoc.GetCurrentState()
+	that.ErrorIs(err, eventsourceprocessor.ErrElementNotFound)
+	_, err = oneEventPerInstruction(inputDoc).GetCurrentState()
+	that.ErrorIs(err, eventsourceprocessor.ErrElementNotFound)
+}
+
+func TestParentCacheSetOnlyFailureMatchesUncached(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":{"b":{"c":1}}}`,
+		scalarSet("a.b.c", "2"),
+		eventsourceprocessor.EventInstruction{Path: "a.b", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "a.b.c", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "3"},
+	)
+	_, cachedErr := inputDoc.GetCurrentState()
+	_, uncachedErr := oneEventPerInstruction(inputDoc).GetCurrentState()
+
+	if that.NotNil(cachedErr) && that.NotNil(uncachedErr) {
+		// The instruction indices differ, as the events were split; what went wrong shouldn't
+		that.Equal(errors.Unwrap(uncachedErr).Error(), errors.Unwrap(cachedErr).Error())
+	}
+}
+
+// prefixHeavyDocument builds an event which sets many fields under a handful of deeply nested objects.
+func prefixHeavyDocument() eventsourceprocessor.Document {
+	var instructions []eventsourceprocessor.EventInstruction
+	for object := 0; object < 10; object++ {
+		for field := 0; field < 50; field++ {
+			instructions = append(instructions, scalarSet(fmt.Sprintf("a.b.c.d.e.object%d.field%d", object, field), "value"))
+		}
+	}
+	return inlineDocument(`{}`, instructions...)
+}
+
+func BenchmarkPrefixHeavyEvent(b *testing.B) {
+	inputDoc := prefixHeavyDocument()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := inputDoc.GetCurrentState()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrefixHeavyEventUncached(b *testing.B) {
+	inputDoc := oneEventPerInstruction(prefixHeavyDocument())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := inputDoc.GetCurrentState()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
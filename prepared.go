@@ -0,0 +1,97 @@
+package eventsourceprocessor
+
+import "strings"
+
+// PreparedBase is a base document which has already been mapped, so batches of events can be applied to it over and
+// over without mapping it again each time. It's never changed, so is safe for concurrent use.
+type PreparedBase struct {
+	config *settings
+	docMap *documentMap
+}
+
+// Prepare maps a base document once, ready for events to be applied to it with Apply. An empty base document is
+// treated as it is by GetCurrentState.
+func (processor *Processor) Prepare(base []byte) (*PreparedBase, error) {
+	docMap, err := makeBaseMap(processor.config, base)
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedBase{config: processor.config, docMap: docMap}, nil
+}
+
+// Apply applies events to a copy of the prepared base document, returning the resulting document - just as
+// GetCurrentState would for a Document with the same base document & events. The prepared base itself is left as it
+// was, so each batch of events starts from the same base.
+//
+//	The copy shares the base's top-level properties until an instruction's path leads into one, when that property
+//	alone is copied; so a few events on a wide document copy little of it.
+func (prepared *PreparedBase) Apply(events []DocumentEvent) ([]byte, error) {
+	config := prepared.config
+	doc := Document{Events: events}
+	if prepared.docMap.IsArray || prepared.docMap.IsScalar || config.ArraySelectorMode == ArraySelectorModeSnapshot {
+		// Every instruction reaches into the single root element; or, in snapshot mode, every event records the length
+		// of every array. Either way, the whole document is needed.
+		return doc.currentStateFrom(config, func() (*documentMap, error) {
+			return prepared.docMap.clone(), nil
+		})
+	}
+
+	docMap := &documentMap{
+		Elements: make(map[string]*documentElement, len(prepared.docMap.Elements)),
+		Order:    append([]string(nil), prepared.docMap.Order...),
+	}
+	for key, elem := range prepared.docMap.Elements {
+		docMap.Elements[key] = elem
+	}
+	copied := map[string]bool{}
+	err := docMap.applyEvents(config, doc, nil, applyHooks{
+		beforeInstruction: func(_, _ int, instruction EventInstruction) {
+			switch instruction.ActionType {
+			case ActionTypeNoOp:
+				return
+			case ActionTypeMove, ActionTypeCopy:
+				docMap.copyShared(config, instruction.Value, copied)
+			}
+			docMap.copyShared(config, instruction.Path, copied)
+		},
+	})
+	if err != nil {
+		if !config.Atomic {
+			docMap = nil
+		}
+		return docMap.untouchedResult(config), err
+	}
+	return docMap.buildResult(config)
+}
+
+// copyShared replaces the top-level property which path leads into with a copy, unless it has been copied already, so
+// an instruction on path can't change the prepared base. A path which doesn't name a property (e.g. the root) has
+// every property copied.
+func (docMap *documentMap) copyShared(config *settings, path string, copied map[string]bool) {
+	path, err := nativePath(config, path)
+	if err == nil {
+		path, err = resolveParentSegments(config, path)
+	}
+	if err != nil {
+		return // The instruction will fail before it changes anything
+	}
+	name := splitPath(config, path)[0]
+	if i := strings.Index(name, config.arrayOpen()); i >= 0 {
+		name = name[:i]
+	}
+
+	if name == "" {
+		for key, elem := range docMap.Elements {
+			if !copied[key] {
+				docMap.Elements[key] = elem.clone()
+				copied[key] = true
+			}
+		}
+		return
+	}
+	key, elem := docMap.findElement(config, name)
+	if elem != nil && !copied[key] {
+		docMap.Elements[key] = elem.clone()
+		copied[key] = true
+	}
+}
@@ -0,0 +1,125 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreparedBaseApply(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := recentActivityDocument()
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configure(nil))
+
+	prepared, err := processor.Prepare(inputDoc.BaseDocument)
+	that.NoError(err)
+	expected, err := processor.GetCurrentState(inputDoc)
+	that.NoError(err)
+
+	for batch := 0; batch < 2; batch++ {
+		// Each batch starts from the same, unchanged base
+		result, err := prepared.Apply(inputDoc.Events)
+		if that.NoError(err, "batch %d", batch) {
+			that.JSONEq(string(expected), string(result), "batch %d", batch)
+		}
+	}
+}
+
+func TestPreparedBaseIndependentBatches(t *testing.T) {
+	that := assert.New(t)
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configure(nil))
+	prepared, err := processor.Prepare([]byte(`{"lines":[{"sku":"A"}],"status":"new"}`))
+	that.NoError(err)
+
+	first, err := prepared.Apply([]eventsourceprocessor.DocumentEvent{appendEvent(1, "lines", "B"), setEvent(2, "status", "paid")})
+	that.NoError(err)
+	second, err := prepared.Apply([]eventsourceprocessor.DocumentEvent{
+		{Instructions: []eventsourceprocessor.EventInstruction{{Path: "lines[first]", ActionType: eventsourceprocessor.ActionTypeRemove}}},
+	})
+	that.NoError(err)
+	none, err := prepared.Apply(nil)
+	that.NoError(err)
+
+	that.JSONEq(`{"lines":[{"sku":"A"},"B"],"status":"paid"}`, string(first))
+	that.JSONEq(`{"lines":[],"status":"new"}`, string(second))
+	that.JSONEq(`{"lines":[{"sku":"A"}],"status":"new"}`, string(none))
+}
+
+func TestPreparedBaseSharedPropertiesUnchanged(t *testing.T) {
+	that := assert.New(t)
+	base := `{"a":{"x":[1,2]},"b":{},"c":{"d":true},"e":{"f":"g"},"h":"i"}`
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configure(nil))
+	prepared, err := processor.Prepare([]byte(base))
+	that.NoError(err)
+
+	result, err := prepared.Apply([]eventsourceprocessor.DocumentEvent{{Instructions: []eventsourceprocessor.EventInstruction{
+		moveInstruction("a.x", "b.y"),
+		{Path: "c.d", ActionType: eventsourceprocessor.ActionTypeRemove},
+		scalarSet("E.f", "changed"),
+		{Path: "", ActionType: eventsourceprocessor.ActionTypeMerge, DataType: eventsourceprocessor.DataTypeMap, Value: `{"h":"merged"}`},
+	}}})
+	that.NoError(err)
+	that.JSONEq(`{"a":{},"b":{"y":[1,2]},"c":{},"e":{"f":"changed"},"h":"merged"}`, string(result))
+
+	// Nothing the instructions changed has leaked into the prepared base
+	unchanged, err := prepared.Apply(nil)
+	that.NoError(err)
+	that.JSONEq(base, string(unchanged))
+}
+
+func TestPreparedBaseErrors(t *testing.T) {
+	that := assert.New(t)
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{})
+
+	_, err := processor.Prepare([]byte(`{"a":`))
+	that.Error(err)
+	_, err = eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{EmptyBaseIsError: true}).Prepare(nil)
+	that.True(errors.Is(err, eventsourceprocessor.ErrEmptyBaseDocument))
+
+	prepared, err := processor.Prepare([]byte(`{}`))
+	that.NoError(err)
+	_, err = prepared.Apply([]eventsourceprocessor.DocumentEvent{
+		{Instructions: []eventsourceprocessor.EventInstruction{{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"}}},
+	})
+	that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+}
+
+// wideBatches are a few small event batches, each applied to wideDocument.
+var wideBatches = [][]eventsourceprocessor.DocumentEvent{
+	{setEvent(1, "key00000.nested.value", "y")},
+	{setEvent(2, "key05000.id", "x"), appendEvent(3, "key05000.tags", "c")},
+	{setEvent(4, "key09999.nested.other", "z")},
+}
+
+func BenchmarkRepeatedGetCurrentState(b *testing.B) {
+	base := []byte(wideDocument())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, events := range wideBatches {
+			_, err := eventsourceprocessor.Document{BaseDocument: base, Events: events}.GetCurrentState()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkPreparedBaseApply(b *testing.B) {
+	prepared, err := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configure(nil)).Prepare([]byte(wideDocument()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, events := range wideBatches {
+			_, err := prepared.Apply(events)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
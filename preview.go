@@ -0,0 +1,90 @@
+package eventsourceprocessor
+
+import "encoding/json"
+
+// Change records what an instruction would do to the document, as found by Preview.
+type Change struct {
+	EventIndex       int             // Zero-based index of the event in Document.Events
+	InstructionIndex int             // Zero-based index of the instruction within the event
+	Path             string          // Path from the instruction
+	ResolvedPath     string          // Path with array selectors resolved to numeric indices where possible
+	ActionType       ActionType      // Action from the instruction
+	Kind             OutcomeKind     // What happened, as for ApplyDetailed
+	OldValue         json.RawMessage // The value at the path beforehand; nil if there wasn't one
+	NewValue         json.RawMessage // The value at the path afterwards; nil if there isn't one, e.g. after a Remove
+	Err              error           // Why the instruction was skipped or failed
+}
+
+// Preview works out what applying the document's events would change, without producing the resulting document: one
+// Change per instruction, in order, with the value at its path before and after. doc is left untouched, so Preview
+// can be used to check events before they're committed, e.g. for auditing or to spot conflicting changes.
+//
+//	If an instruction fails, the changes up to and including the failed one are returned along with the error.
+func (doc Document) Preview() ([]Change, error) {
+	return doc.preview(currentSettings())
+}
+
+// Preview works like Document.Preview, using the processor's configuration.
+func (processor *Processor) Preview(doc Document) ([]Change, error) {
+	return doc.preview(processor.config)
+}
+
+// preview does the work of Preview, with the supplied settings.
+func (doc Document) preview(config *settings) ([]Change, error) {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	var change Change
+	var tokens []string
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		beforeInstruction: func(eventIndex, instructionIndex int, instruction EventInstruction) {
+			resolvedPath, exists := docMap.resolvePath(config, instruction.Path)
+			tokens = pointerTokens(config, resolvedPath)
+			change = Change{
+				EventIndex:       eventIndex,
+				InstructionIndex: instructionIndex,
+				Path:             instruction.Path,
+				ResolvedPath:     resolvedPath,
+				ActionType:       instruction.ActionType,
+				Kind:             expectedOutcome(instruction, exists),
+			}
+			if exists && instruction.ActionType != ActionTypeNoOp && instruction.ActionType != ActionTypeInsertAt {
+				// An InsertAt's path held the element it moves along, rather than one it changes
+				change.OldValue = previewValue(config, docMap, tokens)
+			}
+		},
+		afterInstruction: func(_, _ int, instruction EventInstruction, err error, skipped bool) error {
+			switch {
+			case skipped:
+				change.Err, change.Kind = err, OutcomeSkipped
+			case err != nil:
+				change.Err, change.Kind = err, OutcomeFailed
+			}
+			switch {
+			case change.Kind == OutcomeSkipped || instruction.ActionType == ActionTypeNoOp:
+				change.NewValue = change.OldValue
+			case err == nil && instruction.ActionType != ActionTypeRemove:
+				change.NewValue = previewValue(config, docMap, tokens)
+			}
+			changes = append(changes, change)
+			return nil
+		},
+	})
+	return changes, err
+}
+
+// previewValue returns the JSON for the element of the document at the JSON Pointer tokens, or nil if there isn't one.
+func previewValue(config *settings, docMap *documentMap, tokens []string) json.RawMessage {
+	elem := rootElement(docMap).descend(tokens)
+	if elem == nil {
+		return nil
+	}
+	value, err := buildArray(config, []*documentElement{elem})
+	if err != nil {
+		return nil
+	}
+	return json.RawMessage(value)
+}
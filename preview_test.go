@@ -0,0 +1,68 @@
+package eventsourceprocessor_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"new","lines":[{"sku":"A"}],"old":{"a":1}}`,
+		scalarSet("status", "paid"),
+		scalarSet("customer.name", "someone"),
+		eventsourceprocessor.EventInstruction{Path: "lines[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"sku":"B"}`},
+		eventsourceprocessor.EventInstruction{Path: "old", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "", ActionType: eventsourceprocessor.ActionTypeNoOp, Value: "note"},
+	)
+	original := copyDocument(inputDoc)
+
+	changes, err := inputDoc.Preview()
+
+	that.Nil(err)
+	that.Equal(original, inputDoc)
+	if that.Len(changes, 5) {
+		that.Equal(eventsourceprocessor.Change{
+			Path:         "status",
+			ResolvedPath: "status",
+			ActionType:   eventsourceprocessor.ActionTypeSetOrAdd,
+			Kind:         eventsourceprocessor.OutcomeUpdated,
+			OldValue:     json.RawMessage(`"new"`),
+			NewValue:     json.RawMessage(`"paid"`),
+		}, changes[0])
+
+		that.Equal(eventsourceprocessor.OutcomeCreated, changes[1].Kind)
+		that.Nil(changes[1].OldValue)
+		that.JSONEq(`"someone"`, string(changes[1].NewValue))
+
+		that.Equal("lines[1]", changes[2].ResolvedPath)
+		that.Nil(changes[2].OldValue)
+		that.JSONEq(`{"sku":"B"}`, string(changes[2].NewValue))
+
+		that.Equal(eventsourceprocessor.OutcomeRemoved, changes[3].Kind)
+		that.JSONEq(`{"a":1}`, string(changes[3].OldValue))
+		that.Nil(changes[3].NewValue)
+
+		that.Equal(eventsourceprocessor.OutcomeNoOp, changes[4].Kind)
+	}
+}
+
+func TestPreviewFailure_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"a":1}`,
+		scalarSet("a", "2"),
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+		scalarSet("b", "never applied"),
+	)
+
+	changes, err := inputDoc.Preview()
+
+	var instructionErr eventsourceprocessor.InstructionError
+	that.ErrorAs(err, &instructionErr)
+	if that.Len(changes, 2) {
+		that.Equal(eventsourceprocessor.OutcomeFailed, changes[1].Kind)
+		that.NotNil(changes[1].Err)
+	}
+}
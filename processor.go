@@ -0,0 +1,130 @@
+package eventsourceprocessor
+
+import (
+	"context"
+	"regexp"
+	"sync"
+)
+
+// settings is a Configuration ready for use: defaults filled in, and the regexes which depend on it compiled. Once
+// made, settings are never modified; so one can be shared by any number of goroutines.
+type settings struct {
+	Configuration
+	arrayRegex       *regexp.Regexp  // Finds array indexers in paths
+	pathSegmentRegex *regexp.Regexp  // Checks a path segment is a name, optionally followed by array indexers
+	ctx              context.Context // Cancels the work these settings are used for; nil = never cancelled
+	undo             *undoLog        // Records the parents the current instruction creates; nil = not recorded
+}
+
+func newSettings(configuration Configuration) *settings {
+	if configuration.ArrayDelimiters.Open == 0 || configuration.ArrayDelimiters.Close == 0 {
+		configuration.ArrayDelimiters = defaultArrayDelimiters
+	}
+	return &settings{
+		Configuration:    configuration,
+		arrayRegex:       makeArrayRegex(configuration.ArrayDelimiters),
+		pathSegmentRegex: makePathSegmentRegex(configuration.ArrayDelimiters),
+	}
+}
+
+// withContext returns a copy of the settings for a single call, which stops work once ctx is done.
+func (config *settings) withContext(ctx context.Context) *settings {
+	withCtx := *config
+	withCtx.ctx = ctx
+	return &withCtx
+}
+
+// withUndo returns a copy of the settings for a single call, which records in log how to undo the parents each
+// instruction creates.
+func (config *settings) withUndo(log *undoLog) *settings {
+	withLog := *config
+	withLog.undo = log
+	return &withLog
+}
+
+// withExactValues returns a copy of the settings which compares values exactly, ignoring FloatEpsilon,
+// CaseInsensitiveValues and TreatArraysAsSets; for when any difference at all matters.
+func (config *settings) withExactValues() *settings {
+	exact := *config
+	exact.FloatEpsilon = 0
+	exact.CaseInsensitiveValues = false
+	exact.TreatArraysAsSets = false
+	return &exact
+}
+
+// cancelled returns the context's error, if the work has been cancelled.
+func (config *settings) cancelled() error {
+	if config.ctx == nil {
+		return nil
+	}
+	return config.ctx.Err()
+}
+
+// logf passes a diagnostic message to the configured Logger, if there is one.
+func (config *settings) logf(format string, v ...interface{}) {
+	if config.Logger != nil {
+		config.Logger.Printf(format, v...)
+	}
+}
+
+// arrayOpen and arrayClose return the configured array indexer delimiters as strings.
+func (config *settings) arrayOpen() string {
+	return string(config.ArrayDelimiters.Open)
+}
+
+func (config *settings) arrayClose() string {
+	return string(config.ArrayDelimiters.Close)
+}
+
+// The package-level configuration, as set by Configure, which the Document methods use.
+var (
+	packageSettingsMutex sync.RWMutex
+	packageSettings      = newSettings(Configuration{
+		RemoveNonExistantElementIsError:      true,                   // Default = throw error if removing non-existent element
+		RemoveNonExistantArrayElementIsError: false,                  // Default = don't throw error if removing non-existent array element
+		ArrayDelimiters:                      defaultArrayDelimiters, // Default = square brackets
+	})
+)
+
+// Allow the caller to override the package-level configuration. It's safe to call at any time: a Document method
+// which is already running carries on with the configuration it started with.
+func Configure(configuration *Configuration) Configuration {
+	packageSettingsMutex.Lock()
+	defer packageSettingsMutex.Unlock()
+	// Change or report the configuration
+	if configuration != nil {
+		packageSettings = newSettings(*configuration)
+	}
+	return packageSettings.Configuration
+}
+
+// currentSettings returns the package-level configuration.
+func currentSettings() *settings {
+	packageSettingsMutex.RLock()
+	defer packageSettingsMutex.RUnlock()
+	return packageSettings
+}
+
+// Processor computes document states with its own configuration, rather than the package-level one; so goroutines
+// can use different settings at the same time. A Processor is safe for concurrent use.
+//
+//	The Configuration's maps & slices (e.g. Encoders) are shared with the caller, and must not be modified afterwards.
+type Processor struct {
+	config *settings
+}
+
+// NewProcessor returns a Processor using the supplied configuration. Unset array delimiters default to square brackets.
+func NewProcessor(configuration Configuration) *Processor {
+	return &Processor{config: newSettings(configuration)}
+}
+
+// Configuration returns the processor's configuration.
+func (processor *Processor) Configuration() Configuration {
+	return processor.config.Configuration
+}
+
+// GetCurrentState applies the document's events to its base document, as Document.GetCurrentState does, using the
+// processor's configuration.
+func (processor *Processor) GetCurrentState(doc Document) ([]byte, error) {
+	return doc.currentState(processor.config)
+}
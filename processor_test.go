@@ -0,0 +1,118 @@
+package eventsourceprocessor_test
+
+import (
+	"sync"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessorUsesItsOwnConfiguration(t *testing.T) {
+	that := assert.New(t)
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{
+		ArrayDelimiters: eventsourceprocessor.ArrayDelimiters{Open: '{', Close: '}'},
+	})
+	inputDoc := inlineDocument(`{"items":[]}`, eventsourceprocessor.EventInstruction{
+		Path:       "items{new}",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "added",
+	})
+	result, err := processor.GetCurrentState(inputDoc)
+
+	that.Nil(err)
+	that.Equal(`{"items":["added"]}`, string(result))
+	that.Equal('{', processor.Configuration().ArrayDelimiters.Open)
+
+	// The package-level configuration is untouched
+	result, err = inputDoc.GetCurrentState()
+	that.Nil(err)
+	that.Equal(`{"items":[],"items{new}":"added"}`, string(result))
+}
+
+func TestProcessorZeroConfigurationEmptyBase(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := eventsourceprocessor.Document{
+		Events: []eventsourceprocessor.DocumentEvent{
+			{Instructions: []eventsourceprocessor.EventInstruction{scalarSet("name", "first")}},
+		},
+	}
+
+	// The zero value keeps the default: a missing base document is an empty object
+	result, err := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{}).GetCurrentState(inputDoc)
+	that.Nil(err)
+	that.Equal(`{"name":"first"}`, string(result))
+}
+
+func TestProcessorMethodsUseItsOwnConfiguration(t *testing.T) {
+	that := assert.New(t)
+	processor := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{
+		ArrayDelimiters: eventsourceprocessor.ArrayDelimiters{Open: '{', Close: '}'},
+		KeyOrder:        eventsourceprocessor.KeyOrderSorted,
+	})
+	inputDoc := inlineDocument(`{"b":1,"items":["x"],"a":2}`, scalarSet("items{first}", "y"))
+
+	value, _, err := processor.GetValue(inputDoc, "items{first}")
+	that.Nil(err)
+	that.Equal("y", value)
+
+	projected, err := processor.Project(inputDoc, []string{"b", "a"})
+	that.Nil(err)
+	that.Equal(`{"a":2,"b":1}`, string(projected))
+
+	problems := processor.ValidateStream(inputDoc)
+	that.Empty(problems)
+	that.Nil(processor.Validate(inputDoc))
+
+	instructions, err := processor.Diff([]byte(`{"items":["x"]}`), []byte(`{"items":["x","y"]}`))
+	that.Nil(err)
+	if that.Len(instructions, 1) {
+		that.Equal("items{1}", instructions[0].Path)
+	}
+
+	// The package-level configuration doesn't know the braces, so the array is untouched
+	value, _, err = inputDoc.GetValue("items[first]")
+	that.Nil(err)
+	that.Equal("x", value)
+}
+
+// Run with -race to check configurations don't leak between goroutines.
+func TestProcessorsConcurrently(t *testing.T) {
+	that := assert.New(t)
+	braces := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{
+		ArrayDelimiters: eventsourceprocessor.ArrayDelimiters{Open: '{', Close: '}'},
+	})
+	precision := 1
+	rounding := eventsourceprocessor.NewProcessor(eventsourceprocessor.Configuration{NumberPrecision: &precision})
+	defaults := eventsourceprocessor.Configure(nil)
+	t.Cleanup(func() { eventsourceprocessor.Configure(&defaults) })
+
+	bracesDoc := inlineDocument(`{"items":[]}`, eventsourceprocessor.EventInstruction{Path: "items{new}", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "1.26"})
+	roundingDoc := inlineDocument(`{"items":[]}`, eventsourceprocessor.EventInstruction{Path: "items[new]", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "1.26"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			result, err := braces.GetCurrentState(bracesDoc)
+			that.Nil(err)
+			that.Equal(`{"items":[1.26]}`, string(result))
+		}()
+		go func() {
+			defer wg.Done()
+			result, err := rounding.GetCurrentState(roundingDoc)
+			that.Nil(err)
+			that.Equal(`{"items":[1.3]}`, string(result))
+		}()
+		go func() {
+			defer wg.Done()
+			// The package-level configuration can change at the same time
+			eventsourceprocessor.Configure(&defaults)
+			_, err := roundingDoc.GetCurrentState()
+			that.Nil(err)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,109 @@
+package eventsourceprocessor
+
+import (
+	"errors"
+	"strings"
+)
+
+// Project computes the current state of the document, then returns a new document containing only the
+// requested paths (and the objects leading to them). Paths which don't exist in the current state are ignored.
+//
+//	Paths use the usual dotted syntax. If a path segment contains an array indexer, e.g. `arrayField[first].name`,
+//	the whole array is included in the projection - picking out individual elements would change their indices.
+func (doc Document) Project(paths []string) ([]byte, error) {
+	return doc.project(currentSettings(), paths)
+}
+
+// Project works like Document.Project, using the processor's configuration.
+func (processor *Processor) Project(doc Document, paths []string) ([]byte, error) {
+	return doc.project(processor.config, paths)
+}
+
+// project does the work of Project, with the supplied settings.
+func (doc Document) project(config *settings, paths []string) ([]byte, error) {
+	docMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	if docMap.IsArray || docMap.IsScalar {
+		return nil, errors.New("projection requires the document root to be an object")
+	}
+
+	projection := &documentMap{
+		Elements: make(map[string]*documentElement),
+	}
+	for _, path := range paths {
+		projectPath(config, splitPath(config, path), docMap, projection)
+	}
+
+	return projection.buildResult(config)
+}
+
+// projectPath copies the element at the end of pathParts - and the maps leading to it - from source into target.
+// It returns false if the path doesn't exist in source, in which case target is left untouched.
+func projectPath(config *settings, pathParts []string, source *documentMap, target *documentMap) bool {
+	name := pathParts[0]
+	wholeElement := len(pathParts) == 1
+	if strings.Contains(name, config.arrayOpen()) {
+		// Arrays are projected in their entirety
+		name, _ = getArrayIndexer(config, name)
+		wholeElement = true
+	}
+
+	key, elem := source.findElement(config, name)
+	if elem == nil {
+		// Not in the current state, so nothing to project
+		return false
+	}
+	if wholeElement {
+		target.add(key, elem)
+		return true
+	}
+	if elem.ElementType != DataTypeMap {
+		// The path carries on past a value; so it doesn't exist
+		return false
+	}
+
+	// Part way down the path; so copy the map without its content, unless an earlier path already brought it over
+	existing, found := target.Elements[key]
+	if found && existing == elem {
+		// The entire element was projected by an earlier path
+		return true
+	}
+	if !found {
+		existing = &documentElement{
+			Name:        elem.Name,
+			ElementType: DataTypeMap,
+			Content: &documentMap{
+				Elements: make(map[string]*documentElement),
+			},
+		}
+	}
+	if !projectPath(config, pathParts[1:], elem.Content, existing.Content) {
+		return found
+	}
+	target.add(key, existing)
+	return true
+}
+
+// findElement locates a named element in a document map, as the path finder does. Unless CaseSensitivePaths is set,
+// names are matched regardless of case; an exact match wins, then the first matching key in sorted order, so the same
+// element is found every time.
+func (docMap *documentMap) findElement(config *settings, name string) (string, *documentElement) {
+	if elem, found := docMap.Elements[name]; found {
+		return name, elem
+	}
+	if config.CaseSensitivePaths {
+		return "", nil
+	}
+	match := ""
+	for k := range docMap.Elements {
+		if strings.EqualFold(k, name) && (match == "" || k < match) {
+			match = k
+		}
+	}
+	if match == "" {
+		return "", nil
+	}
+	return match, docMap.Elements[match]
+}
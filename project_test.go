@@ -0,0 +1,47 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectKeepsRequestedSubtrees(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestProjectKeepsRequestedSubtrees", "base.json", []string{"event1.json", "event5.json"})
+	outputDoc, err := inputDoc.Project([]string{"stringField", "objectField.objectName", "newObject", "arrayField[first].arrayObjectName"})
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	// Requested paths, and only the requested part of objectField
+	that.Contains(string(outputDoc), `"stringField":"Event 1 replaces this field"`)
+	that.Contains(string(outputDoc), `"objectField":{"objectName":"object-name"}`)
+	that.Contains(string(outputDoc), `"newSubObjectString":"Event 5 adds newObject`)
+	// Arrays are projected whole
+	that.Contains(string(outputDoc), `"arrayObjectId":0`)
+	that.Contains(string(outputDoc), `"arrayObjectId":1`)
+	// Everything else is dropped
+	that.NotContains(string(outputDoc), `"masterId"`)
+	that.NotContains(string(outputDoc), `"objectValue"`)
+	that.NotContains(string(outputDoc), `"newFieldFromEvent1"`)
+}
+
+func TestProjectIgnoresMissingPaths(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestProjectIgnoresMissingPaths", "base.json", nil)
+	outputDoc, err := inputDoc.Project([]string{"noSuchField", "objectField.noSuchField", "masterId"})
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Equal(`{"masterId":"123"}`, string(outputDoc))
+}
+
+func TestProjectArrayRoot_Fails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestProjectArrayRoot_Fails", "baseArray.json", nil)
+	_, err := inputDoc.Project([]string{"arrayObjectId"})
+
+	that.NotNil(err)
+}
@@ -0,0 +1,257 @@
+package eventsourceprocessor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+/*
+	Hand-written protobuf (proto3) wire format conversions for events & instructions.
+	The schema is in eventsourceprocessor.proto - the field numbers and enum values below must match it.
+*/
+
+// Enum values, as numbered in eventsourceprocessor.proto
+var actionTypeProtoValues = map[ActionType]uint64{
+	"":                  0,
+	ActionTypeSetOrAdd:  1,
+	ActionTypeAddOnly:   2,
+	ActionTypeSetOnly:   3,
+	ActionTypeRemove:    4,
+	ActionTypeReplaceAt: 5,
+	ActionTypeNoOp:      6,
+
+	ActionTypeCompareAndSet: 7,
+	ActionTypeMerge:         8,
+	ActionTypeIncrement:     9,
+	ActionTypeAppend:        10,
+	ActionTypeInsertAt:      11,
+	ActionTypeMove:          12,
+	ActionTypeCopy:          13,
+}
+
+var dataTypeProtoValues = map[DataType]uint64{
+	DataTypeNone:   0,
+	DataTypeString: 1,
+	DataTypeNumber: 2,
+	DataTypeBool:   3,
+	DataTypeNull:   4,
+	DataTypeArray:  5,
+	DataTypeMap:    6,
+}
+
+var valueEncodingProtoValues = map[ValueEncoding]uint64{
+	"":                      0,
+	ValueEncodingNone:       0,
+	ValueEncodingGzipBase64: 1,
+}
+
+// Protobuf wire types
+const (
+	wireVarint          = 0
+	wireFixed64         = 1
+	wireLengthDelimited = 2
+	wireFixed32         = 5
+)
+
+// ToProto encodes the event as a protobuf DocumentEvent message.
+func (event DocumentEvent) ToProto() ([]byte, error) {
+	var message []byte
+	if event.EventId != uuid.Nil {
+		message = appendBytesField(message, 1, event.EventId[:])
+	}
+	message = appendVarintField(message, 2, event.Timestamp)
+	for i, instruction := range event.Instructions {
+		encoded, err := instruction.ToProto()
+		if err != nil {
+			return nil, fmt.Errorf("instruction[%d]: %w", i, err)
+		}
+		// Repeated messages are always written, even if empty
+		message = appendTag(message, 3, wireLengthDelimited)
+		message = binary.AppendUvarint(message, uint64(len(encoded)))
+		message = append(message, encoded...)
+	}
+	return message, nil
+}
+
+// FromProto decodes a protobuf DocumentEvent message into the event.
+func (event *DocumentEvent) FromProto(message []byte) error {
+	*event = DocumentEvent{}
+	return readFields(message, func(field uint64, wireType int, varint uint64, data []byte) error {
+		switch {
+		case field == 1 && wireType == wireLengthDelimited:
+			eventId, err := uuid.FromBytes(data)
+			if err != nil {
+				return fmt.Errorf("invalid event_id: %w", err)
+			}
+			event.EventId = eventId
+		case field == 2 && wireType == wireVarint:
+			event.Timestamp = varint
+		case field == 3 && wireType == wireLengthDelimited:
+			var instruction EventInstruction
+			err := instruction.FromProto(data)
+			if err != nil {
+				return fmt.Errorf("instruction[%d]: %w", len(event.Instructions), err)
+			}
+			event.Instructions = append(event.Instructions, instruction)
+		}
+		// Anything else is an unknown field, which proto3 ignores
+		return nil
+	})
+}
+
+// ToProto encodes the instruction as a protobuf EventInstruction message.
+func (instruction EventInstruction) ToProto() ([]byte, error) {
+	actionType, found := actionTypeProtoValues[instruction.ActionType]
+	if !found {
+		return nil, fmt.Errorf("action type `%s` has no protobuf equivalent", instruction.ActionType)
+	}
+	dataType, customDataType := toProtoDataType(instruction.DataType)
+	valueEncoding, found := valueEncodingProtoValues[instruction.ValueEncoding]
+	if !found {
+		return nil, fmt.Errorf("value encoding `%s` has no protobuf equivalent", instruction.ValueEncoding)
+	}
+	expectedDataType, customExpectedDataType := toProtoDataType(instruction.ExpectedDataType)
+
+	var message []byte
+	message = appendBytesField(message, 1, []byte(instruction.Path))
+	message = appendVarintField(message, 2, actionType)
+	message = appendVarintField(message, 3, dataType)
+	message = appendBytesField(message, 4, []byte(instruction.Value))
+	message = appendVarintField(message, 5, valueEncoding)
+	message = appendVarintField(message, 6, expectedDataType)
+	message = appendBytesField(message, 7, []byte(instruction.ExpectedValue))
+	message = appendBytesField(message, 8, []byte(customDataType))
+	message = appendBytesField(message, 9, []byte(customExpectedDataType))
+	return message, nil
+}
+
+// toProtoDataType finds the protobuf enum value for a data type. Custom data types (see Configuration.Encoders)
+// have no enum value, so they're left unset and returned by name, to be carried in a string field instead.
+func toProtoDataType(dataType DataType) (uint64, DataType) {
+	protoValue, found := dataTypeProtoValues[dataType]
+	if !found {
+		return 0, dataType
+	}
+	return protoValue, ""
+}
+
+// FromProto decodes a protobuf EventInstruction message into the instruction.
+func (instruction *EventInstruction) FromProto(message []byte) error {
+	*instruction = EventInstruction{}
+	return readFields(message, func(field uint64, wireType int, varint uint64, data []byte) error {
+		var err error
+		switch {
+		case field == 1 && wireType == wireLengthDelimited:
+			instruction.Path = string(data)
+		case field == 2 && wireType == wireVarint:
+			instruction.ActionType, err = fromProtoEnum(actionTypeProtoValues, varint, "action type")
+		case field == 3 && wireType == wireVarint:
+			instruction.DataType, err = fromProtoEnum(dataTypeProtoValues, varint, "data type")
+		case field == 4 && wireType == wireLengthDelimited:
+			instruction.Value = string(data)
+		case field == 5 && wireType == wireVarint:
+			instruction.ValueEncoding, err = fromProtoEnum(valueEncodingProtoValues, varint, "value encoding")
+		case field == 6 && wireType == wireVarint:
+			instruction.ExpectedDataType, err = fromProtoEnum(dataTypeProtoValues, varint, "expected data type")
+		case field == 7 && wireType == wireLengthDelimited:
+			instruction.ExpectedValue = string(data)
+		case field == 8 && wireType == wireLengthDelimited:
+			instruction.DataType = DataType(data)
+		case field == 9 && wireType == wireLengthDelimited:
+			instruction.ExpectedDataType = DataType(data)
+		}
+		return err
+	})
+}
+
+// fromProtoEnum finds the Go value for a protobuf enum value. Zero always maps to the empty (unset) value.
+func fromProtoEnum[T ~string](values map[T]uint64, protoValue uint64, description string) (T, error) {
+	var empty T
+	if protoValue == 0 {
+		return empty, nil
+	}
+	for value, candidate := range values {
+		if candidate == protoValue {
+			return value, nil
+		}
+	}
+	return empty, fmt.Errorf("unknown %s enum value %d", description, protoValue)
+}
+
+// appendTag appends a field's key (number & wire type).
+func appendTag(message []byte, field uint64, wireType int) []byte {
+	return binary.AppendUvarint(message, field<<3|uint64(wireType))
+}
+
+// appendVarintField appends a varint field; as per proto3, zero values are not written.
+func appendVarintField(message []byte, field uint64, value uint64) []byte {
+	if value == 0 {
+		return message
+	}
+	message = appendTag(message, field, wireVarint)
+	return binary.AppendUvarint(message, value)
+}
+
+// appendBytesField appends a length-delimited field; as per proto3, empty values are not written.
+func appendBytesField(message []byte, field uint64, value []byte) []byte {
+	if len(value) == 0 {
+		return message
+	}
+	message = appendTag(message, field, wireLengthDelimited)
+	message = binary.AppendUvarint(message, uint64(len(value)))
+	return append(message, value...)
+}
+
+// readFields walks the fields of a protobuf message, calling handle for each one. Varint fields are passed in
+// varint, length-delimited fields in data. Fixed width fields are skipped, as none are used by the schema.
+func readFields(message []byte, handle func(field uint64, wireType int, varint uint64, data []byte) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errors.New("malformed protobuf message: bad field key")
+		}
+		message = message[n:]
+		field, wireType := key>>3, int(key&7)
+
+		var varint uint64
+		var data []byte
+		switch wireType {
+		case wireVarint:
+			varint, n = binary.Uvarint(message)
+			if n <= 0 {
+				return fmt.Errorf("malformed protobuf message: bad varint in field %d", field)
+			}
+			message = message[n:]
+		case wireLengthDelimited:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || length > uint64(len(message)-n) {
+				return fmt.Errorf("malformed protobuf message: bad length in field %d", field)
+			}
+			data = message[n : n+int(length)]
+			message = message[n+int(length):]
+		case wireFixed64:
+			if len(message) < 8 {
+				return fmt.Errorf("malformed protobuf message: truncated field %d", field)
+			}
+			message = message[8:]
+			continue
+		case wireFixed32:
+			if len(message) < 4 {
+				return fmt.Errorf("malformed protobuf message: truncated field %d", field)
+			}
+			message = message[4:]
+			continue
+		default:
+			return fmt.Errorf("malformed protobuf message: unsupported wire type %d in field %d", wireType, field)
+		}
+
+		err := handle(field, wireType, varint, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentEventProtoRoundTrip(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestDocumentEventProtoRoundTrip", "base.json", []string{"event1.json"})
+	event := inputDoc.Events[0]
+	event.EventId = uuid.New()
+	event.Timestamp = 1690000000123456
+	event.Instructions = append(event.Instructions,
+		eventsourceprocessor.EventInstruction{Path: "objectField.objectName", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "arrayField[1]", ActionType: eventsourceprocessor.ActionTypeReplaceAt, DataType: eventsourceprocessor.DataTypeMap, Value: `{"a":1}`},
+		eventsourceprocessor.EventInstruction{Path: "flag", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeBool, Value: "true"},
+		eventsourceprocessor.EventInstruction{Path: "big", ActionType: eventsourceprocessor.ActionTypeAddOnly, DataType: eventsourceprocessor.DataTypeArray, Value: gzipBase64(`[1,2,3]`), ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64},
+		eventsourceprocessor.EventInstruction{Path: "status", ActionType: eventsourceprocessor.ActionTypeCompareAndSet, DataType: eventsourceprocessor.DataTypeString, Value: "shipped", ExpectedDataType: eventsourceprocessor.DataTypeString, ExpectedValue: "pending"},
+		eventsourceprocessor.EventInstruction{Path: "note", ActionType: eventsourceprocessor.ActionTypeNoOp, Value: "marker"},
+	)
+
+	encoded, err := event.ToProto()
+	that.Nil(err)
+	var decoded eventsourceprocessor.DocumentEvent
+	err = decoded.FromProto(encoded)
+
+	that.Nil(err)
+	that.Equal(event, decoded)
+}
+
+func TestEventInstructionProtoCustomDataType(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.Encoders = map[eventsourceprocessor.DataType]eventsourceprocessor.DataTypeEncoder{
+			"decimal": func(value string) (string, error) { return value, nil },
+		}
+	})
+	event := eventsourceprocessor.DocumentEvent{Instructions: []eventsourceprocessor.EventInstruction{
+		{Path: "price", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: "decimal", Value: "1.10"},
+		{Path: "price", ActionType: eventsourceprocessor.ActionTypeCompareAndSet, DataType: eventsourceprocessor.DataTypeNumber, Value: "2", ExpectedDataType: "decimal", ExpectedValue: "1.10"},
+	}}
+
+	encoded, err := event.ToProto()
+	that.Nil(err)
+	var decoded eventsourceprocessor.DocumentEvent
+	err = decoded.FromProto(encoded)
+	that.Nil(err)
+	that.Equal(event, decoded)
+
+	inputDoc := inlineDocument(`{}`)
+	inputDoc.Events = []eventsourceprocessor.DocumentEvent{decoded}
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"price":2}`, string(result))
+}
+
+func TestEventInstructionProtoWireFormat(t *testing.T) {
+	that := assert.New(t)
+	instruction := eventsourceprocessor.EventInstruction{
+		Path:       "a",
+		ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "b",
+	}
+	encoded, err := instruction.ToProto()
+
+	// path=1 "a", action_type=2 SET_OR_ADD, data_type=3 STRING, value=4 "b"
+	that.Nil(err)
+	that.Equal([]byte{0x0a, 0x01, 'a', 0x10, 0x01, 0x18, 0x01, 0x22, 0x01, 'b'}, encoded)
+}
+
+func TestEventInstructionProtoUnknownEnum_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.EventInstruction{Path: "a", ActionType: "Frobnicate"}.ToProto()
+	that.NotNil(err)
+
+	var instruction eventsourceprocessor.EventInstruction
+	err = instruction.FromProto([]byte{0x10, 0x63}) // action_type=99
+	that.NotNil(err)
+}
+
+func TestEventInstructionProtoMalformed_Fails(t *testing.T) {
+	that := assert.New(t)
+	var event eventsourceprocessor.DocumentEvent
+	err := event.FromProto([]byte{0x1a, 0x05, 0x0a}) // instructions claims 5 bytes, has 1
+
+	that.NotNil(err)
+}
@@ -0,0 +1,113 @@
+package eventsourceprocessor
+
+import "fmt"
+
+// State is the current state of a document, held as its document map so it can be queried directly, rather than
+// building the JSON and unmarshalling it again.
+type State struct {
+	config *settings
+	docMap *documentMap
+}
+
+// Parse computes the current state of the document, as GetCurrentState does, and returns it ready to be queried.
+func (doc Document) Parse() (*State, error) {
+	return doc.parse(currentSettings())
+}
+
+// Parse works like Document.Parse, using the processor's configuration.
+func (processor *Processor) Parse(doc Document) (*State, error) {
+	return doc.parse(processor.config)
+}
+
+// parse does the work of Parse, with the supplied settings.
+func (doc Document) parse(config *settings) (*State, error) {
+	docMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &State{config: config, docMap: docMap}, nil
+}
+
+// GetValue computes the current state of the document, and returns the value at path and its data type, as
+// State.Get does; it's an error if there's nothing there.
+func (doc Document) GetValue(path string) (string, DataType, error) {
+	return doc.getValue(currentSettings(), path)
+}
+
+// GetValue works like Document.GetValue, using the processor's configuration.
+func (processor *Processor) GetValue(doc Document, path string) (string, DataType, error) {
+	return doc.getValue(processor.config, path)
+}
+
+// getValue does the work of GetValue, with the supplied settings.
+func (doc Document) getValue(config *settings, path string) (string, DataType, error) {
+	docMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return "", DataTypeNone, err
+	}
+	elem, err := docMap.lookup(config, path)
+	if err != nil {
+		return "", DataTypeNone, fmt.Errorf("unable to find `%s`: %w", path, err)
+	}
+	value, err := elementValue(config, elem)
+	if err != nil {
+		return "", DataTypeNone, err
+	}
+	return value, elem.ElementType, nil
+}
+
+// Get returns the value at path, and its data type; ok is false if there's nothing there. Paths are written as for
+// instructions, including array indexers, e.g. `items[first].name`; an empty path refers to the document itself.
+//
+//	A string is returned as it is, without quotes; a null as "". An object or array is returned as its JSON.
+func (state *State) Get(path string) (value string, dataType DataType, ok bool) {
+	elem, err := state.docMap.lookup(state.config, path)
+	if err != nil {
+		return "", DataTypeNone, false
+	}
+	value, err = elementValue(state.config, elem)
+	if err != nil {
+		return "", DataTypeNone, false
+	}
+	return value, elem.ElementType, true
+}
+
+// Exists reports whether there's anything at path, even if it's null.
+func (state *State) Exists(path string) bool {
+	_, err := state.docMap.lookup(state.config, path)
+	return err == nil
+}
+
+// JSON builds the state into a JSON document, exactly as GetCurrentState returns it.
+func (state *State) JSON() ([]byte, error) {
+	return state.docMap.buildResult(state.config)
+}
+
+// lookup finds the element at path, without changing the document map.
+func (docMap *documentMap) lookup(config *settings, path string) (*documentElement, error) {
+	path, err := nativePath(config, path)
+	if err != nil {
+		return nil, err
+	}
+	err = validatePath(config, path)
+	if err != nil {
+		return nil, err
+	}
+	path, err = resolveParentSegments(config, path)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return rootElement(docMap), nil
+	}
+	return getMapPathElement(config, path, false, docMap)
+}
+
+// elementValue gives the value of an element as a string: its JSON, for objects and arrays. A value of a custom data
+// type is returned as it was set, before encoding.
+func elementValue(config *settings, elem *documentElement) (string, error) {
+	if elem.ElementType == DataTypeMap || elem.ElementType == DataTypeArray {
+		return buildArray(config, []*documentElement{elem})
+	}
+	return elem.Value, nil
+}
@@ -0,0 +1,175 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGet(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"customer":{"name":"someone","age":42,"vip":true,"notes":null},"lines":[{"sku":"A","qty":1},{"sku":"B","qty":2}]}`,
+		scalarSet("customer.address.city", "Leeds"),
+		scalarSet("lines[new].sku", "C"),
+	)
+
+	state, err := inputDoc.Parse()
+	if !that.NoError(err) {
+		return
+	}
+
+	cases := []struct {
+		path     string
+		value    string
+		dataType eventsourceprocessor.DataType
+	}{
+		{"customer.name", "someone", eventsourceprocessor.DataTypeString},
+		{"customer.age", "42", eventsourceprocessor.DataTypeNumber},
+		{"customer.vip", "true", eventsourceprocessor.DataTypeBool},
+		{"customer.notes", "", eventsourceprocessor.DataTypeNull},
+		{"customer.address.city", "Leeds", eventsourceprocessor.DataTypeString},
+		{"customer.address", `{"city":"Leeds"}`, eventsourceprocessor.DataTypeMap},
+		{"lines[0].sku", "A", eventsourceprocessor.DataTypeString},
+		{"lines[1].qty", "2", eventsourceprocessor.DataTypeNumber},
+		{"lines[last].sku", "C", eventsourceprocessor.DataTypeString},
+		{"lines[sku=B].qty", "2", eventsourceprocessor.DataTypeNumber},
+		{"lines[2]", `{"sku":"C"}`, eventsourceprocessor.DataTypeMap},
+		{"/lines/0/qty", "1", eventsourceprocessor.DataTypeNumber},
+	}
+	for _, c := range cases {
+		value, dataType, ok := state.Get(c.path)
+		if that.True(ok, c.path) {
+			that.Equal(c.value, value, c.path)
+			that.Equal(c.dataType, dataType, c.path)
+		}
+	}
+}
+
+func TestParseMissing(t *testing.T) {
+	that := assert.New(t)
+	state, err := inlineDocument(`{"customer":{"name":"someone","notes":null},"lines":[{"sku":"A"}],"tags":["a"]}`).Parse()
+	if !that.NoError(err) {
+		return
+	}
+
+	for _, path := range []string{"customer.age", "nothing.here", "lines[5].sku", "lines[sku=Z].sku", "customer.name.first", "customer.notes.text", "tags[0].x", "lines[0].sku.x", "a..b"} {
+		_, dataType, ok := state.Get(path)
+		that.False(ok, path)
+		that.Equal(eventsourceprocessor.DataTypeNone, dataType, path)
+		that.False(state.Exists(path), path)
+	}
+	that.True(state.Exists("customer.notes"))
+	that.True(state.Exists("lines[first]"))
+}
+
+func TestParseNewIndexer(t *testing.T) {
+	that := assert.New(t)
+	state, err := inlineDocument(`{"items":[1,2]}`).Parse()
+	if !that.NoError(err) {
+		return
+	}
+
+	that.False(state.Exists("items[new]"))
+	_, _, ok := state.Get("items[new]")
+	that.False(ok)
+
+	result, err := state.JSON()
+	if that.NoError(err) {
+		that.JSONEq(`{"items":[1,2]}`, string(result))
+	}
+}
+
+func TestParseRootAndJSON(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`[{"id":1},{"id":2}]`, scalarSet("[new].id", "3"))
+
+	state, err := inputDoc.Parse()
+	if !that.NoError(err) {
+		return
+	}
+
+	value, dataType, ok := state.Get("")
+	if that.True(ok) {
+		that.Equal(eventsourceprocessor.DataTypeArray, dataType)
+		that.JSONEq(`[{"id":1},{"id":2},{"id":"3"}]`, value)
+	}
+	value, _, ok = state.Get("[1].id")
+	if that.True(ok) {
+		that.Equal("2", value)
+	}
+
+	expected, err := inputDoc.GetCurrentState()
+	that.NoError(err)
+	result, err := state.JSON()
+	if that.NoError(err) {
+		that.Equal(string(expected), string(result))
+	}
+}
+
+func TestParseFails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+	)
+
+	state, err := inputDoc.Parse()
+
+	that.Error(err)
+	that.Nil(state)
+}
+
+func TestGetValue(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"status":"new","items":[{"name":"first item","qty":1},{"name":"second item","qty":2}]}`,
+		scalarSet("status", "paid"),
+		scalarSet("items[new].name", "third item"),
+	)
+
+	value, dataType, err := inputDoc.GetValue("status")
+	if that.NoError(err) {
+		that.Equal("paid", value)
+		that.Equal(eventsourceprocessor.DataTypeString, dataType)
+	}
+
+	value, dataType, err = inputDoc.GetValue("items[first].name")
+	if that.NoError(err) {
+		that.Equal("first item", value)
+		that.Equal(eventsourceprocessor.DataTypeString, dataType)
+	}
+	value, _, err = inputDoc.GetValue("items[last].name")
+	if that.NoError(err) {
+		that.Equal("third item", value)
+	}
+	value, dataType, err = inputDoc.GetValue("items[1].qty")
+	if that.NoError(err) {
+		that.Equal("2", value)
+		that.Equal(eventsourceprocessor.DataTypeNumber, dataType)
+	}
+}
+
+func TestGetValueMissing(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"items":[{"name":"first item"}]}`)
+
+	for _, path := range []string{"status", "items[first].price", "items[new]", "items[new].name"} {
+		_, dataType, err := inputDoc.GetValue(path)
+		that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound), path)
+		that.Equal(eventsourceprocessor.DataTypeNone, dataType, path)
+	}
+	_, _, err := inputDoc.GetValue("items[3].name")
+	that.Error(err)
+}
+
+func TestSetOrAddPastScalar_Fail(t *testing.T) {
+	that := assert.New(t)
+	for _, inputDoc := range []eventsourceprocessor.Document{
+		inlineDocument(`{"s":"str"}`, scalarSet("s.y", "1")),
+		inlineDocument(`{"s":["x"]}`, scalarSet("s[first].y", "1")),
+		inlineDocument(`{"a":1,"s":"str"}`, moveInstruction("a", "s.y")),
+	} {
+		_, err := inputDoc.GetCurrentState()
+		that.Error(err, string(inputDoc.BaseDocument))
+	}
+}
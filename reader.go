@@ -0,0 +1,43 @@
+package eventsourceprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// GetCurrentStateFromReader works like GetCurrentState, except the base document is decoded as it's read from base,
+// rather than first being loaded into doc.BaseDocument; this saves holding a second copy of a large base document in
+// memory. doc.BaseDocument is ignored.
+func (doc Document) GetCurrentStateFromReader(base io.Reader) ([]byte, error) {
+	return doc.currentStateFromReader(currentSettings(), base)
+}
+
+// GetCurrentStateFromReader works like Document.GetCurrentStateFromReader, using the processor's configuration.
+func (processor *Processor) GetCurrentStateFromReader(doc Document, base io.Reader) ([]byte, error) {
+	return doc.currentStateFromReader(processor.config, base)
+}
+
+// currentStateFromReader does the work of GetCurrentStateFromReader, with the supplied settings.
+func (doc Document) currentStateFromReader(config *settings, base io.Reader) ([]byte, error) {
+	return doc.currentStateFrom(config, func() (*documentMap, error) {
+		return makeReaderMap(config, base)
+	})
+}
+
+// makeReaderMap works like makeBaseMap, for a base document read from r.
+func makeReaderMap(config *settings, r io.Reader) (*documentMap, error) {
+	// Some stores prefix documents with a UTF-8 byte order mark, which the decoder rejects
+	buffered := bufio.NewReader(r)
+	if prefix, _ := buffered.Peek(len(utf8BOM)); bytes.Equal(prefix, utf8BOM) {
+		_, _ = buffered.Discard(len(utf8BOM))
+	}
+
+	docMap, err := decodeDocument(config, buffered)
+	if errors.Is(err, io.EOF) {
+		// Nothing but whitespace
+		return makeBaseMap(config, nil)
+	}
+	return docMap, err
+}
@@ -0,0 +1,76 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCurrentStateFromReader(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := recentActivityDocument()
+
+	expected, err := inputDoc.GetCurrentState()
+	that.NoError(err)
+	base := string(inputDoc.BaseDocument)
+	inputDoc.BaseDocument = nil
+	result, err := inputDoc.GetCurrentStateFromReader(strings.NewReader(base))
+
+	if that.NoError(err) {
+		that.JSONEq(string(expected), string(result))
+	}
+}
+
+func TestGetCurrentStateFromReaderByteOrderMark(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(``, scalarSet("b", "2"))
+
+	result, err := inputDoc.GetCurrentStateFromReader(strings.NewReader("\xef\xbb\xbf {\"a\":1}\n"))
+
+	if that.NoError(err) {
+		that.JSONEq(`{"a":1,"b":"2"}`, string(result))
+	}
+}
+
+func TestGetCurrentStateFromReaderEmpty(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"ignored":true}`, scalarSet("name", "first"))
+
+	result, err := inputDoc.GetCurrentStateFromReader(strings.NewReader("  \n"))
+	if that.NoError(err) {
+		that.JSONEq(`{"name":"first"}`, string(result))
+	}
+
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.EmptyBaseIsError = true })
+	_, err = inputDoc.GetCurrentStateFromReader(strings.NewReader(""))
+	that.True(errors.Is(err, eventsourceprocessor.ErrEmptyBaseDocument))
+}
+
+func TestGetCurrentStateFromReaderInvalid(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(``, scalarSet("name", "first"))
+
+	_, err := inputDoc.GetCurrentStateFromReader(strings.NewReader(`{"a":1} {"b":2}`))
+	that.Error(err)
+	_, err = inputDoc.GetCurrentStateFromReader(strings.NewReader(`{"a":`))
+	that.Error(err)
+	for _, base := range []string{`{"a":1}}`, `[1]]`, `{"a":1}]`, `"x"}`} {
+		_, err = inputDoc.GetCurrentStateFromReader(strings.NewReader(base))
+		that.Error(err, base)
+	}
+}
+
+func TestGetCurrentStateFromReaderKeyOrderDocument(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) { c.KeyOrder = eventsourceprocessor.KeyOrderDocument })
+	inputDoc := inlineDocument(``, scalarSet("a", "1"))
+
+	result, err := inputDoc.GetCurrentStateFromReader(strings.NewReader(`{"z":true,"m":false}`))
+
+	if that.NoError(err) {
+		that.Equal(`{"z":true,"m":false,"a":"1"}`, string(result))
+	}
+}
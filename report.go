@@ -0,0 +1,145 @@
+package eventsourceprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ApplyReport describes anything noteworthy - but not actually wrong - which happened while applying events.
+type ApplyReport struct {
+	Warnings    []ReportEntry  `json:",omitempty"` // Possible authoring mistakes, e.g. suspiciously deep paths being created
+	Skipped     []ReportEntry  `json:",omitempty"` // Instructions which were not applied, e.g. bad values on a SkipValueErrorPaths path
+	NoOps       []ReportEntry  `json:",omitempty"` // NoOp instructions; the message is the instruction's value, if any
+	ConfigNotes []ReportEntry  `json:",omitempty"` // Decisions made because of a configuration flag, e.g. ignoring the removal of a missing element
+	Removed     []RemovedValue `json:",omitempty"` // Values deleted by Remove instructions, in the order they were removed
+}
+
+// RemovedValue records the value a Remove instruction deleted, e.g. for auditing or undo.
+type RemovedValue struct {
+	EventIndex       int             // Zero-based index of the event in Document.Events
+	InstructionIndex int             // Zero-based index of the instruction within the event
+	Path             string          // Path the instruction was acting on
+	Value            json.RawMessage // The removed value, as JSON
+}
+
+// ReportEntry is a single item in an ApplyReport, and identifies the instruction it relates to.
+type ReportEntry struct {
+	EventIndex       int    // Zero-based index of the event in Document.Events
+	InstructionIndex int    // Zero-based index of the instruction within the event
+	Path             string // Path the instruction was acting on
+	Message          string // What happened
+}
+
+// entry starts a report entry for an instruction; the caller fills in the message. If report is nil, entries made
+// through the returned context are discarded.
+func (report *ApplyReport) entry(eventIndex, instructionIndex int, path string) reportContext {
+	return reportContext{
+		report: report,
+		entry: ReportEntry{
+			EventIndex:       eventIndex,
+			InstructionIndex: instructionIndex,
+			Path:             path,
+		},
+	}
+}
+
+// reportContext is used to add entries to a report about a specific instruction.
+type reportContext struct {
+	report *ApplyReport
+	entry  ReportEntry
+}
+
+func (rc reportContext) warn(format string, args ...interface{}) {
+	if rc.report == nil {
+		return
+	}
+	entry := rc.entry
+	entry.Message = fmt.Sprintf(format, args...)
+	rc.report.Warnings = append(rc.report.Warnings, entry)
+}
+
+func (rc reportContext) skip(err error) {
+	if rc.report == nil {
+		return
+	}
+	entry := rc.entry
+	entry.Message = err.Error()
+	rc.report.Skipped = append(rc.report.Skipped, entry)
+}
+
+func (rc reportContext) noOp(note string) {
+	if rc.report == nil {
+		return
+	}
+	entry := rc.entry
+	entry.Message = note
+	rc.report.NoOps = append(rc.report.NoOps, entry)
+}
+
+func (rc reportContext) configNote(format string, args ...interface{}) {
+	if rc.report == nil {
+		return
+	}
+	entry := rc.entry
+	entry.Message = fmt.Sprintf(format, args...)
+	rc.report.ConfigNotes = append(rc.report.ConfigNotes, entry)
+}
+
+// removed records the value of an element which is being removed. If its value can't be built, that is a warning;
+// the removal itself still goes ahead.
+func (rc reportContext) removed(config *settings, elem *documentElement) {
+	if rc.report == nil {
+		return
+	}
+	value, err := buildArray(config, []*documentElement{elem})
+	if err != nil {
+		rc.warn("unable to record removed value: %v", err)
+		return
+	}
+	rc.report.Removed = append(rc.report.Removed, RemovedValue{
+		EventIndex:       rc.entry.EventIndex,
+		InstructionIndex: rc.entry.InstructionIndex,
+		Path:             rc.entry.Path,
+		Value:            json.RawMessage(value),
+	})
+}
+
+// checkInstruction looks for likely authoring mistakes in an instruction, before it is applied to the document.
+func (docMap *documentMap) checkInstruction(config *settings, instruction EventInstruction, rc reportContext) {
+	if config.DeepCreateWarningLevels > 0 && instruction.ActionType == ActionTypeSetOrAdd {
+		levels := docMap.missingParentLevels(config, instruction.Path)
+		if levels > config.DeepCreateWarningLevels {
+			rc.warn("instruction creates %d new parent objects (warning threshold is %d); check the path for typos", levels, config.DeepCreateWarningLevels)
+		}
+	}
+}
+
+// missingParentLevels counts how many of the parent objects on a path don't exist yet, and would be created by
+// SetOrAdd. Counting stops at the first array indexer, as array elements are created differently.
+func (docMap *documentMap) missingParentLevels(config *settings, path string) int {
+	path, err := nativePath(config, path)
+	if err != nil {
+		return 0 // Applying it will fail anyway
+	}
+	pathParts := splitPath(config, path)
+	parents := pathParts[:len(pathParts)-1]
+	current := docMap
+	for i, part := range parents {
+		if strings.Contains(part, config.arrayOpen()) {
+			return 0
+		}
+		_, elem := current.findElement(config, part)
+		switch {
+		case elem == nil || elem.ElementType == DataTypeNull:
+			// Everything from here on down will be created
+			return len(parents) - i
+		case elem.ElementType == DataTypeMap:
+			current = elem.Content
+		default:
+			// Not something which can be created through
+			return 0
+		}
+	}
+	return 0
+}
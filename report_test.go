@@ -0,0 +1,150 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportWarnsOnDeepCreation(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.DeepCreateWarningLevels = 2
+	})
+	inputDoc := inlineDocument(`{"objectField":{}}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "objectField.a.b.c.leaf",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "deep",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "objectField.x.leaf",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "shallow",
+		},
+	)
+	outputDoc, report, err := inputDoc.GetCurrentStateWithReport()
+	prettyPrint("Output Document", outputDoc)
+	prettyPrintObject("Report", report)
+
+	// The instructions still apply; only the deep one is flagged
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"leaf":"deep"`)
+	that.Contains(string(outputDoc), `"leaf":"shallow"`)
+	if that.Len(report.Warnings, 1) {
+		that.Equal(0, report.Warnings[0].InstructionIndex)
+		that.Equal("objectField.a.b.c.leaf", report.Warnings[0].Path)
+		that.Contains(report.Warnings[0].Message, "3 new parent objects")
+	}
+}
+
+func TestReportNoWarningsByDefault(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestReportNoWarningsByDefault", "base.json", []string{"event5.json"})
+	_, report, err := inputDoc.GetCurrentStateWithReport()
+
+	that.Nil(err)
+	that.Empty(report.Warnings)
+}
+
+func TestNoOpInstruction(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"name":"someone"}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "marker",
+			ActionType: eventsourceprocessor.ActionTypeNoOp,
+			Value:      "migration checkpoint",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "status",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "active",
+		},
+		eventsourceprocessor.EventInstruction{
+			ActionType: eventsourceprocessor.ActionTypeNoOp,
+			DataType:   eventsourceprocessor.DataTypeMap,
+			Value:      "not JSON, and not looked at",
+		},
+	)
+	outputDoc, report, err := inputDoc.GetCurrentStateWithReport()
+
+	that.Nil(err)
+	that.JSONEq(`{"name":"someone","status":"active"}`, string(outputDoc))
+	that.Empty(report.Warnings)
+	if that.Len(report.NoOps, 2) {
+		that.Equal(0, report.NoOps[0].InstructionIndex)
+		that.Equal("marker", report.NoOps[0].Path)
+		that.Equal("migration checkpoint", report.NoOps[0].Message)
+		that.Equal(2, report.NoOps[1].InstructionIndex)
+	}
+	that.Empty(eventsourceprocessor.ValidateStream(inputDoc))
+}
+
+func TestReportNotesConfigDrivenRemovals(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.RemoveNonExistantElementIsError = false
+	})
+	inputDoc := inlineDocument(`{"name":"someone","items":[]}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "items[first]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "name", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	outputDoc, report, err := inputDoc.GetCurrentStateWithReport()
+
+	that.Nil(err)
+	that.JSONEq(`{"items":[]}`, string(outputDoc))
+	if that.Len(report.ConfigNotes, 2) {
+		that.Equal(0, report.ConfigNotes[0].InstructionIndex)
+		that.Contains(report.ConfigNotes[0].Message, "RemoveNonExistantElementIsError=false")
+		that.Equal(1, report.ConfigNotes[1].InstructionIndex)
+		that.Contains(report.ConfigNotes[1].Message, "RemoveNonExistantArrayElementIsError=false")
+	}
+}
+
+func TestConfigDrivenRemovalErrorsNameFlag_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.RemoveNonExistantArrayElementIsError = true
+	})
+	for path, flag := range map[string]string{
+		"missing":         "RemoveNonExistantElementIsError=true",
+		"missing.child":   "RemoveNonExistantElementIsError=true",
+		"items[last]":     "RemoveNonExistantArrayElementIsError=true",
+		"objectField.abc": "RemoveNonExistantElementIsError=true",
+	} {
+		inputDoc := inlineDocument(`{"items":[],"objectField":{}}`, eventsourceprocessor.EventInstruction{Path: path, ActionType: eventsourceprocessor.ActionTypeRemove})
+		_, err := inputDoc.GetCurrentState()
+
+		if that.NotNil(err, path) {
+			that.Contains(err.Error(), flag, path)
+		}
+	}
+}
+
+func TestReportRecordsRemovedValues(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{"name":"someone","address":{"city":"Leeds","lines":["1 High St"]},"items":[{"sku":"A"},"B"],"tags":["x","y"]}`,
+		eventsourceprocessor.EventInstruction{Path: "name", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "address", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "items[first]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "items[last]", ActionType: eventsourceprocessor.ActionTypeRemove},
+		eventsourceprocessor.EventInstruction{Path: "tags[all]", ActionType: eventsourceprocessor.ActionTypeRemove},
+	)
+	outputDoc, report, err := inputDoc.GetCurrentStateWithReport()
+
+	that.Nil(err)
+	that.JSONEq(`{"items":[],"tags":[]}`, string(outputDoc))
+	expected := []string{`"someone"`, `{"city":"Leeds","lines":["1 High St"]}`, `{"sku":"A"}`, `"B"`, `["x","y"]`}
+	if that.Len(report.Removed, len(expected)) {
+		for i, removed := range report.Removed {
+			that.Equal(i, removed.InstructionIndex)
+			that.Equal(inputDoc.Events[0].Instructions[i].Path, removed.Path)
+			that.JSONEq(expected[i], string(removed.Value), removed.Path)
+		}
+	}
+}
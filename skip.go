@@ -0,0 +1,75 @@
+package eventsourceprocessor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// valueError marks a failure to parse an instruction's value, as opposed to a problem with the path or document.
+type valueError struct {
+	err error
+}
+
+func (e valueError) Error() string {
+	return e.err.Error()
+}
+
+func (e valueError) Unwrap() error {
+	return e.err
+}
+
+// parseValue decodes the instruction's value, and checks it can be parsed as its data type. This is done before the
+// document is touched, so an instruction with a bad value has no effect at all.
+func (instruction EventInstruction) parseValue(config *settings) (EventInstruction, error) {
+	instruction, err := instruction.decodeValue(config)
+	if err != nil {
+		return instruction, valueError{err}
+	}
+	if instruction.ActionType == ActionTypeRemove || instruction.ActionType == ActionTypeMove || instruction.ActionType == ActionTypeCopy {
+		// No value to parse; for Move and Copy, Value holds a path
+		return instruction, nil
+	}
+	if instruction.DataType == DataTypeNone && config.InferDataType {
+		instruction.DataType = inferDataType(instruction.Value)
+	}
+	_, err = checkScalarValue(instruction.DataType, instruction.Value)
+	if err != nil {
+		return instruction, valueError{err}
+	}
+	if instruction.DataType == DataTypeMap || instruction.DataType == DataTypeArray {
+		if !json.Valid([]byte(instruction.Value)) {
+			return instruction, valueError{fmt.Errorf("%s value for `%s` is not valid JSON", instruction.DataType, instruction.Path)}
+		}
+	}
+	return instruction, nil
+}
+
+// skipValueError reports whether err is a value parsing failure on a path matching one of the
+// Configuration.SkipValueErrorPaths patterns, in which case the instruction is skipped rather than failing the stream.
+func skipValueError(config *settings, err error, path string) bool {
+	var vErr valueError
+	if !errors.As(err, &vErr) {
+		return false
+	}
+	for _, pattern := range config.SkipValueErrorPaths {
+		if pathPatternRegex(config, pattern).MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathPatternRegex converts a skip path pattern to a regex. `*` matches anything within a single path segment, and
+// everything else - array indexers included - is literal. Matching is case-insensitive, like path lookups, unless
+// Configuration.CaseSensitivePaths is set.
+func pathPatternRegex(config *settings, pattern string) *regexp.Regexp {
+	quoted := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `[^.]*`)
+	flags := "(?i)"
+	if config.CaseSensitivePaths {
+		flags = ""
+	}
+	return regexp.MustCompile(flags + `^` + quoted + `$`)
+}
@@ -0,0 +1,100 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func skipTestDocument() eventsourceprocessor.Document {
+	return inlineDocument(`{"name":"someone"}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "feeds.partner.payload",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeMap,
+			Value:      `{"truncated":`,
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "status",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "active",
+		},
+	)
+}
+
+func TestSkipValueErrorOnMatchingPath(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.SkipValueErrorPaths = []string{"Feeds.*.payload"}
+	})
+	result, report, err := skipTestDocument().GetCurrentStateWithReport()
+
+	that.Nil(err)
+	that.JSONEq(`{"name":"someone","status":"active"}`, string(result))
+	if that.Len(report.Skipped, 1) {
+		that.Equal(0, report.Skipped[0].InstructionIndex)
+		that.Equal("feeds.partner.payload", report.Skipped[0].Path)
+		that.Contains(report.Skipped[0].Message, "not valid JSON")
+	}
+}
+
+func TestSkipValueErrorOnNonMatchingPath_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.SkipValueErrorPaths = []string{"feeds.*", "*.payload"}
+	})
+	_, err := skipTestDocument().GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "not valid JSON")
+	}
+}
+
+func TestSkipValueErrorCaseSensitivePaths_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.SkipValueErrorPaths = []string{"Feeds.*.payload"}
+		c.CaseSensitivePaths = true
+	})
+	_, err := skipTestDocument().GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "not valid JSON")
+	}
+}
+
+func TestSkipValueErrorIgnoresOtherErrors_Fail(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.SkipValueErrorPaths = []string{"*"}
+	})
+	inputDoc := inlineDocument(`{"name":"someone"}`, eventsourceprocessor.EventInstruction{
+		Path:       "missing",
+		ActionType: eventsourceprocessor.ActionTypeSetOnly,
+		DataType:   eventsourceprocessor.DataTypeString,
+		Value:      "value",
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	that.NotNil(err)
+}
+
+func TestSkipValueErrorCorruptEncoding(t *testing.T) {
+	that := assert.New(t)
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.SkipValueErrorPaths = []string{"attachments[new]"}
+	})
+	inputDoc := inlineDocument(`{"attachments":[]}`, eventsourceprocessor.EventInstruction{
+		Path:          "attachments[new]",
+		ActionType:    eventsourceprocessor.ActionTypeSetOrAdd,
+		DataType:      eventsourceprocessor.DataTypeString,
+		Value:         "not base64!",
+		ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64,
+	})
+	result, err := inputDoc.GetCurrentState()
+
+	that.Nil(err)
+	that.JSONEq(`{"attachments":[]}`, string(result))
+}
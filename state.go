@@ -0,0 +1,201 @@
+package eventsourceprocessor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// MarshalState applies the document's events, and returns the resulting internal document map in a compact binary
+// (gob) form. Callers can cache this, and hand it to UnmarshalState later rather than re-parsing and re-applying.
+func MarshalState(doc Document) ([]byte, error) {
+	return marshalState(currentSettings(), doc)
+}
+
+// MarshalState works like the package-level MarshalState, using the processor's configuration.
+func (processor *Processor) MarshalState(doc Document) ([]byte, error) {
+	return marshalState(processor.config, doc)
+}
+
+// marshalState does the work of MarshalState, with the supplied settings.
+func marshalState(config *settings, doc Document) ([]byte, error) {
+	docMap, err := doc.currentStateMap(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return docMap.encodeState()
+}
+
+// UnmarshalState takes a binary state produced by MarshalState, and builds it into the JSON document it represents.
+func UnmarshalState(state []byte) ([]byte, error) {
+	return unmarshalState(currentSettings(), state)
+}
+
+// UnmarshalState works like the package-level UnmarshalState, using the processor's configuration.
+func (processor *Processor) UnmarshalState(state []byte) ([]byte, error) {
+	return unmarshalState(processor.config, state)
+}
+
+// unmarshalState does the work of UnmarshalState, with the supplied settings.
+func unmarshalState(config *settings, state []byte) ([]byte, error) {
+	docMap, err := decodeState(state)
+	if err != nil {
+		return nil, err
+	}
+	return docMap.buildResult(config)
+}
+
+// ApplyPrefix applies only the first eventCount events of the document, and returns a checkpoint: an opaque binary
+// state (as per MarshalState) from which ResumeFrom can carry on with the remaining events later.
+func (doc Document) ApplyPrefix(eventCount int) ([]byte, error) {
+	prefix, err := doc.prefix(eventCount)
+	if err != nil {
+		return nil, err
+	}
+	return marshalState(currentSettings(), prefix)
+}
+
+// ApplyPrefix works like Document.ApplyPrefix, using the processor's configuration.
+func (processor *Processor) ApplyPrefix(doc Document, eventCount int) ([]byte, error) {
+	prefix, err := doc.prefix(eventCount)
+	if err != nil {
+		return nil, err
+	}
+	return marshalState(processor.config, prefix)
+}
+
+// GetStateAtEvent applies only the first eventCount events of the document, and returns the state at that point - e.g.
+// for debugging, or to see how an entity looked in the past. With an eventCount of 0, the base document is returned.
+func (doc Document) GetStateAtEvent(eventCount int) ([]byte, error) {
+	prefix, err := doc.prefix(eventCount)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.currentState(currentSettings())
+}
+
+// GetStateAtEvent works like Document.GetStateAtEvent, using the processor's configuration.
+func (processor *Processor) GetStateAtEvent(doc Document, eventCount int) ([]byte, error) {
+	prefix, err := doc.prefix(eventCount)
+	if err != nil {
+		return nil, err
+	}
+	return prefix.currentState(processor.config)
+}
+
+// GetAllStates returns the state of the document before any events are applied, and after each event in turn - so
+// there is one more state than there are events. This is much cheaper than calling GetStateAtEvent for each event.
+func (doc Document) GetAllStates() ([][]byte, error) {
+	return doc.getAllStates(currentSettings())
+}
+
+// GetAllStates works like Document.GetAllStates, using the processor's configuration.
+func (processor *Processor) GetAllStates(doc Document) ([][]byte, error) {
+	return doc.getAllStates(processor.config)
+}
+
+// getAllStates does the work of GetAllStates, with the supplied settings.
+func (doc Document) getAllStates(config *settings) ([][]byte, error) {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([][]byte, 0, len(doc.Events)+1)
+	state, err := docMap.buildResult(config)
+	if err != nil {
+		return nil, err
+	}
+	states = append(states, state)
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		afterEvent: func(int) error {
+			state, err := docMap.buildResult(config)
+			states = append(states, state)
+			return err
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// prefix returns a copy of the document with only its first eventCount events.
+func (doc Document) prefix(eventCount int) (Document, error) {
+	if eventCount < 0 || eventCount > len(doc.Events) {
+		return doc, fmt.Errorf("cannot apply %d events, the document has %d", eventCount, len(doc.Events))
+	}
+	prefix := doc
+	prefix.Events = doc.Events[:eventCount]
+	return prefix, nil
+}
+
+// ResumeFrom decodes a checkpoint made by ApplyPrefix (or MarshalState), applies the given events to it, and returns
+// the resulting JSON document. With Configuration.Atomic set, a failure returns the checkpoint's document, untouched.
+func ResumeFrom(checkpoint []byte, events []DocumentEvent) ([]byte, error) {
+	return resumeFrom(currentSettings(), checkpoint, events)
+}
+
+// ResumeFrom works like the package-level ResumeFrom, using the processor's configuration.
+func (processor *Processor) ResumeFrom(checkpoint []byte, events []DocumentEvent) ([]byte, error) {
+	return resumeFrom(processor.config, checkpoint, events)
+}
+
+// resumeFrom does the work of ResumeFrom, with the supplied settings.
+func resumeFrom(config *settings, checkpoint []byte, events []DocumentEvent) ([]byte, error) {
+	docMap, err := decodeState(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	err = docMap.applyEvents(config, Document{Events: events}, nil, applyHooks{})
+	if err != nil {
+		if config.Atomic {
+			return docMap.untouchedResult(config), err
+		}
+		return nil, err
+	}
+	return docMap.buildResult(config)
+}
+
+// encodeState serialises a document map using gob.
+func (docMap *documentMap) encodeState() ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(docMap)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode document state: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// decodeState deserialises a document map encoded by encodeState.
+func decodeState(state []byte) (*documentMap, error) {
+	var docMap documentMap
+	err := gob.NewDecoder(bytes.NewReader(state)).Decode(&docMap)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode document state: %w", err)
+	}
+	docMap.repair()
+	return &docMap, nil
+}
+
+// repair restores the empty maps & sub-objects which gob doesn't transmit, so the decoded map can be modified safely.
+func (docMap *documentMap) repair() {
+	if docMap.Elements == nil {
+		docMap.Elements = make(map[string]*documentElement)
+	}
+	for _, elem := range docMap.Elements {
+		elem.repair()
+	}
+}
+
+func (elem *documentElement) repair() {
+	if elem.ElementType == DataTypeMap && elem.Content == nil {
+		elem.Content = &documentMap{}
+	}
+	if elem.Content != nil {
+		elem.Content.repair()
+	}
+	for _, arrayElem := range elem.ArrayContent {
+		arrayElem.repair()
+	}
+}
@@ -0,0 +1,151 @@
+package eventsourceprocessor_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalStateRoundTrip(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestMarshalStateRoundTrip", "base.json", []string{"event1.json", "event2.json", "event3.json", "event5.json"})
+	expectedDoc, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	state, err := eventsourceprocessor.MarshalState(inputDoc)
+	that.Nil(err)
+	outputDoc, err := eventsourceprocessor.UnmarshalState(state)
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong, and the rebuilt document is the same as the original
+	that.Nil(err)
+	that.JSONEq(string(expectedDoc), string(outputDoc))
+	// Empty objects & arrays survive the trip
+	that.Contains(string(outputDoc), `"emptyObjectField":{}`)
+	that.Contains(string(outputDoc), `"emptyArrayField":[]`)
+}
+
+func TestMarshalStateArrayRoundTrip(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestMarshalStateArrayRoundTrip", "baseNestedArray.json", nil)
+	expectedDoc, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	state, err := eventsourceprocessor.MarshalState(inputDoc)
+	that.Nil(err)
+	outputDoc, err := eventsourceprocessor.UnmarshalState(state)
+
+	that.Nil(err)
+	that.JSONEq(string(expectedDoc), string(outputDoc))
+	that.True(json.Valid(outputDoc))
+}
+
+func TestUnmarshalStateCorrupt_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.UnmarshalState([]byte("not a state"))
+
+	that.NotNil(err)
+}
+
+func TestApplyPrefixAndResume(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestApplyPrefixAndResume", "base.json", []string{"event1.json", "event2.json", "event3.json", "event5.json"})
+	expectedDoc, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	half := len(inputDoc.Events) / 2
+	checkpoint, err := inputDoc.ApplyPrefix(half)
+	that.Nil(err)
+	outputDoc, err := eventsourceprocessor.ResumeFrom(checkpoint, inputDoc.Events[half:])
+
+	that.Nil(err)
+	that.JSONEq(string(expectedDoc), string(outputDoc))
+}
+
+func TestApplyPrefixOutOfRange_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestApplyPrefixOutOfRange_Fail", "base.json", []string{"event1.json"})
+	_, err := inputDoc.ApplyPrefix(2)
+
+	if that.NotNil(err) {
+		that.Equal("cannot apply 2 events, the document has 1", err.Error())
+	}
+}
+
+func TestGetStateAtEvent(t *testing.T) {
+	that := assert.New(t)
+	eventFiles := []string{"event1.json", "event2.json", "event3.json", "event4.json"}
+	inputDoc := buildDocument("TestGetStateAtEvent", "base.json", eventFiles)
+	expectedDoc, err := buildDocument("TestGetStateAtEvent", "base.json", eventFiles[:2]).GetCurrentState()
+	that.Nil(err)
+	outputDoc, err := inputDoc.GetStateAtEvent(2)
+
+	that.Nil(err)
+	that.JSONEq(string(expectedDoc), string(outputDoc))
+	// Event 4 removes what event 2 added, so it's only there part way through
+	that.Contains(string(outputDoc), "newObjectFromEvent2")
+	finalDoc, err := inputDoc.GetStateAtEvent(len(eventFiles))
+	that.Nil(err)
+	that.NotContains(string(finalDoc), "newObjectFromEvent2")
+}
+
+func TestGetStateAtEventZero(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGetStateAtEventZero", "base.json", []string{"event1.json"})
+	outputDoc, err := inputDoc.GetStateAtEvent(0)
+
+	that.Nil(err)
+	that.JSONEq(string(inputDoc.BaseDocument), string(outputDoc))
+}
+
+func TestGetStateAtEventOutOfRange_Fail(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGetStateAtEventOutOfRange_Fail", "base.json", []string{"event1.json"})
+	for _, eventCount := range []int{-1, 2} {
+		_, err := inputDoc.GetStateAtEvent(eventCount)
+
+		that.NotNil(err, eventCount)
+	}
+}
+
+func TestGetAllStates(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestGetAllStates", "base.json", []string{"event1.json", "event2.json", "event3.json", "event4.json"})
+	states, err := inputDoc.GetAllStates()
+	that.Nil(err)
+	currentState, err := inputDoc.GetCurrentState()
+	that.Nil(err)
+
+	if that.Len(states, len(inputDoc.Events)+1) {
+		that.JSONEq(string(inputDoc.BaseDocument), string(states[0]))
+		for eventCount := range states {
+			stateAtEvent, err := inputDoc.GetStateAtEvent(eventCount)
+			that.Nil(err)
+			that.Equal(string(stateAtEvent), string(states[eventCount]), eventCount)
+		}
+		that.Equal(string(currentState), string(states[len(states)-1]))
+
+		// Each state is independent of the others
+		before := string(states[1])
+		states[0][0] = 'X'
+		that.Equal(before, string(states[1]))
+	}
+}
+
+func TestGetAllStatesFailingEvent(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`, eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"})
+	states, err := inputDoc.GetAllStates()
+
+	that.NotNil(err)
+	that.Nil(states)
+}
+
+func TestResumeFromCorruptCheckpoint_Fail(t *testing.T) {
+	that := assert.New(t)
+	_, err := eventsourceprocessor.ResumeFrom([]byte("not a checkpoint"), nil)
+
+	that.NotNil(err)
+}
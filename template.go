@@ -0,0 +1,70 @@
+package eventsourceprocessor
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Package-local regex for finding `${name}` placeholders in templated instructions
+var templateVariableRegex = regexp.MustCompile(`\$\{([^{}]*)\}`)
+
+// ExpandVariables returns a copy of the document, with every `${name}` placeholder in its instructions' Path and
+// Value replaced by variables[name]. It is an error for a placeholder to name a variable which isn't supplied.
+//
+//	Values are substituted as-is; if a placeholder sits inside a JSON-encoded map or array value, the variable must
+//	already be escaped appropriately. Encoded values (see ValueEncoding) are left alone.
+func (doc Document) ExpandVariables(variables map[string]string) (Document, error) {
+	expanded := doc
+	expanded.Events = make([]DocumentEvent, len(doc.Events))
+	for i, event := range doc.Events {
+		expandedEvent, err := event.ExpandVariables(variables)
+		if err != nil {
+			return doc, fmt.Errorf("event[%d]: %w", i, err)
+		}
+		expanded.Events[i] = expandedEvent
+	}
+	return expanded, nil
+}
+
+// ExpandVariables returns a copy of the event, with `${name}` placeholders expanded as per Document.ExpandVariables.
+func (event DocumentEvent) ExpandVariables(variables map[string]string) (DocumentEvent, error) {
+	expanded := event
+	expanded.Instructions = make([]EventInstruction, len(event.Instructions))
+	for i, instruction := range event.Instructions {
+		var err error
+		instruction.Path, err = expandVariables(instruction.Path, variables)
+		if err != nil {
+			return event, fmt.Errorf("instruction[%d] path: %w", i, err)
+		}
+		if instruction.ValueEncoding == "" || instruction.ValueEncoding == ValueEncodingNone {
+			instruction.Value, err = expandVariables(instruction.Value, variables)
+			if err != nil {
+				return event, fmt.Errorf("instruction[%d] value: %w", i, err)
+			}
+		}
+		instruction.ExpectedValue, err = expandVariables(instruction.ExpectedValue, variables)
+		if err != nil {
+			return event, fmt.Errorf("instruction[%d] expected value: %w", i, err)
+		}
+		expanded.Instructions[i] = instruction
+	}
+	return expanded, nil
+}
+
+// expandVariables replaces the placeholders in a single string.
+func expandVariables(template string, variables map[string]string) (string, error) {
+	var missing []string
+	expanded := templateVariableRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := templateVariableRegex.FindStringSubmatch(placeholder)[1]
+		value, found := variables[name]
+		if !found {
+			missing = append(missing, name)
+			return placeholder
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return template, fmt.Errorf("undefined template variable `%s`", missing[0])
+	}
+	return expanded, nil
+}
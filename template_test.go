@@ -0,0 +1,62 @@
+package eventsourceprocessor_test
+
+import (
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func templateDocument() eventsourceprocessor.Document {
+	return inlineDocument(`{"hotels":{}}`,
+		eventsourceprocessor.EventInstruction{
+			Path:       "hotels.${hotelId}.name",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeString,
+			Value:      "${hotelName} (${brand})",
+		},
+		eventsourceprocessor.EventInstruction{
+			Path:       "hotels.${hotelId}.address",
+			ActionType: eventsourceprocessor.ActionTypeSetOrAdd,
+			DataType:   eventsourceprocessor.DataTypeMap,
+			Value:      `{"city":"${city}"}`,
+		},
+	)
+}
+
+func TestExpandVariables(t *testing.T) {
+	that := assert.New(t)
+	template := templateDocument()
+	inputDoc, err := template.ExpandVariables(map[string]string{
+		"hotelId":   "h123",
+		"hotelName": "Some Hotel",
+		"brand":     "someBrand",
+		"city":      "Leeds",
+	})
+	that.Nil(err)
+	outputDoc, err := inputDoc.GetCurrentState()
+	prettyPrintObject("Input Document", inputDoc)
+	prettyPrint("Output Document", outputDoc)
+
+	// Nothing unexpected went wrong
+	that.Nil(err)
+	that.Contains(string(outputDoc), `"h123":{`)
+	that.Contains(string(outputDoc), `"name":"Some Hotel (someBrand)"`)
+	that.Contains(string(outputDoc), `"address":{"city":"Leeds"}`)
+	// The template itself is untouched, so it can be instantiated again
+	that.Equal("hotels.${hotelId}.name", template.Events[0].Instructions[0].Path)
+}
+
+func TestExpandVariablesUndefined_Fails(t *testing.T) {
+	that := assert.New(t)
+	_, err := templateDocument().ExpandVariables(map[string]string{
+		"hotelId":   "h123",
+		"hotelName": "Some Hotel",
+	})
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "undefined template variable `brand`")
+		that.Contains(err.Error(), "event[0]")
+		that.Contains(err.Error(), "instruction[0] value")
+	}
+}
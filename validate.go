@@ -0,0 +1,200 @@
+package eventsourceprocessor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// InstructionError describes a problem with a single instruction, and where to find it in the document's events.
+type InstructionError struct {
+	EventIndex       int       // Zero-based index of the event in Document.Events
+	EventId          uuid.UUID // ID of the event
+	InstructionIndex int       // Zero-based index of the instruction within the event
+	Path             string    // Path the instruction was acting on
+	Err              error     // What went wrong
+}
+
+func (e InstructionError) Error() string {
+	return fmt.Sprintf("event[%d] (id=%s) instruction[%d] path `%s`: %v", e.EventIndex, e.EventId, e.InstructionIndex, e.Path, e.Err)
+}
+
+func (e InstructionError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateStream checks every instruction in the document against a scratch copy of the base document, and returns
+// every problem found - rather than stopping at the first one, as GetCurrentState does.
+//
+//	Instructions which fail are skipped, and the remaining instructions are checked against the document as it
+//	would be without them. Bad values on SkipValueErrorPaths paths aren't problems, as they'd be skipped when applied.
+//	An empty result means the whole stream applies cleanly.
+func ValidateStream(doc Document) []InstructionError {
+	return validateStream(currentSettings(), doc)
+}
+
+// ValidateStream works like the package-level ValidateStream, using the processor's configuration.
+func (processor *Processor) ValidateStream(doc Document) []InstructionError {
+	return validateStream(processor.config, doc)
+}
+
+// validateStream does the work of ValidateStream, with the supplied settings.
+func validateStream(config *settings, doc Document) []InstructionError {
+	docMap, err := makeBaseMap(config, doc.BaseDocument)
+	if err != nil {
+		// Nothing can be applied to a broken base document
+		return []InstructionError{{EventIndex: -1, InstructionIndex: -1, Err: fmt.Errorf("invalid base document: %w", err)}}
+	}
+
+	var problems []InstructionError
+	err = docMap.applyEvents(config, doc, nil, applyHooks{
+		afterInstruction: func(_, _ int, _ EventInstruction, err error, skipped bool) error {
+			var problem InstructionError
+			if !skipped && errors.As(err, &problem) {
+				problems = append(problems, problem)
+			}
+			return nil
+		},
+		keepGoing: true,
+	})
+	var problem InstructionError
+	if errors.As(err, &problem) {
+		// ValidateBeforeApply found a malformed instruction, so none were checked against the document
+		problems = append(problems, problem)
+	} else if err != nil {
+		problems = append(problems, InstructionError{EventIndex: -1, InstructionIndex: -1, Err: err})
+	}
+	return problems
+}
+
+// Validate checks every instruction in the document on its own, without applying any of them: that its action and
+// data type are known, its path is well formed, and its value can be parsed as its data type (including valid JSON for
+// map and array values). The first problem found is returned, as an InstructionError.
+//
+//	Unlike ValidateStream, nothing is checked against the document - so an instruction which passes may still fail
+//	when applied, e.g. SetOnly on a path which doesn't exist. Set Configuration.ValidateBeforeApply to have
+//	GetCurrentState (and the like) validate first, so a bad instruction fails before anything is applied.
+func (doc Document) Validate() error {
+	return doc.validate(currentSettings())
+}
+
+// Validate works like Document.Validate, using the processor's configuration.
+func (processor *Processor) Validate(doc Document) error {
+	return doc.validate(processor.config)
+}
+
+// validate does the work of Validate, with the supplied settings.
+func (doc Document) validate(config *settings) error {
+	for eventIndex, event := range doc.Events {
+		for instructionIndex, instruction := range event.Instructions {
+			err := instruction.validate(config)
+			if err != nil {
+				return InstructionError{
+					EventIndex:       eventIndex,
+					EventId:          event.EventId,
+					InstructionIndex: instructionIndex,
+					Path:             instruction.Path,
+					Err:              err,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a single instruction, without reference to any document.
+func (instruction EventInstruction) validate(config *settings) error {
+	switch instruction.ActionType {
+	case ActionTypeNoOp:
+		return nil // Not even checking the path or value, as when it's applied
+	case ActionTypeAddOnly:
+		return fmt.Errorf("the %s action is not implemented", instruction.ActionType)
+	case ActionTypeSetOrAdd, ActionTypeSetOnly, ActionTypeRemove, ActionTypeReplaceAt, ActionTypeCompareAndSet, ActionTypeMerge,
+		ActionTypeIncrement, ActionTypeAppend, ActionTypeInsertAt, ActionTypeMove, ActionTypeCopy:
+	default:
+		return fmt.Errorf("unknown action type `%s`", instruction.ActionType)
+	}
+
+	err := validateInstructionPath(config, instruction.Path)
+	if err != nil {
+		return err
+	}
+	instruction, err = instruction.parseValue(config)
+	if err != nil {
+		return err
+	}
+
+	switch instruction.ActionType {
+	case ActionTypeRemove:
+		return nil
+	case ActionTypeMove, ActionTypeCopy:
+		if instruction.Value == "" {
+			return fmt.Errorf("the %s action needs a source path in its value", instruction.ActionType)
+		}
+		err = validateInstructionPath(config, instruction.Value)
+		if err != nil {
+			return fmt.Errorf("invalid %s source path: %w", instruction.ActionType, err)
+		}
+		return nil
+	case ActionTypeMerge:
+		if instruction.DataType != DataTypeMap {
+			return fmt.Errorf("%w: the %s action needs a map value, not a %s", ErrInvalidDataType, instruction.ActionType, instruction.DataType)
+		}
+		return nil
+	case ActionTypeIncrement:
+		if instruction.DataType != DataTypeNumber && instruction.DataType != DataTypeNone {
+			return fmt.Errorf("%w: the %s action needs a %s value, not a %s", ErrInvalidDataType, instruction.ActionType, DataTypeNumber, instruction.DataType)
+		}
+		_, err = checkScalarValue(DataTypeNumber, instruction.Value)
+		return err
+	case ActionTypeCompareAndSet:
+		err = validateValue(config, instruction.ExpectedDataType, instruction.ExpectedValue)
+		if err != nil {
+			return fmt.Errorf("invalid expected value: %w", err)
+		}
+	}
+	return validateValue(config, instruction.DataType, instruction.Value)
+}
+
+// validateInstructionPath checks that a path, in either syntax, is well formed.
+func validateInstructionPath(config *settings, path string) error {
+	path, err := nativePath(config, path)
+	if err != nil {
+		return err
+	}
+	err = validatePath(config, path)
+	if err != nil {
+		return err
+	}
+	_, err = resolveParentSegments(config, path)
+	return err
+}
+
+// validateValue checks that a data type is known - built in, or with a configured encoder - and that the value can
+// be parsed as it.
+func validateValue(config *settings, dataType DataType, value string) error {
+	switch dataType {
+	case DataTypeString, DataTypeNumber, DataTypeBool, DataTypeNull:
+		_, err := checkScalarValue(dataType, value)
+		return err
+	case DataTypeMap, DataTypeArray:
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			return fmt.Errorf("%w: %s value is not valid JSON: %v", ErrInvalidDataType, dataType, err)
+		}
+		_, isMap := decoded.(map[string]interface{})
+		_, isArray := decoded.([]interface{})
+		if (dataType == DataTypeMap && !isMap) || (dataType == DataTypeArray && !isArray) {
+			return fmt.Errorf("%w: `%s` is not a valid %s value", ErrInvalidDataType, value, dataType)
+		}
+		return nil
+	case DataTypeNone:
+		return errors.New("the instruction has no data type")
+	}
+	if _, found := config.Encoders[dataType]; !found {
+		return fmt.Errorf("%w: unknown data type `%s`, which has no encoder", ErrInvalidDataType, dataType)
+	}
+	return nil
+}
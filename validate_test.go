@@ -0,0 +1,214 @@
+package eventsourceprocessor_test
+
+import (
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStreamCleanStream(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestValidateStreamCleanStream", "base.json", []string{"event1.json", "event2.json", "event3.json", "event4.json"})
+	problems := eventsourceprocessor.ValidateStream(inputDoc)
+
+	that.Empty(problems)
+}
+
+func TestValidateStreamReportsEveryProblem(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestValidateStreamReportsEveryProblem", "base.json", []string{"event1.json", "event6b.json"})
+	inputDoc.Events = append(inputDoc.Events, eventsourceprocessor.DocumentEvent{
+		Instructions: []eventsourceprocessor.EventInstruction{
+			{Path: "stringField", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "fine"},
+			{Path: "noSuchField", ActionType: eventsourceprocessor.ActionTypeRemove},
+			{Path: "noSuchObject.noSuchField", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "nope"},
+		},
+	})
+	problems := eventsourceprocessor.ValidateStream(inputDoc)
+	prettyPrintObject("Problems", problems)
+
+	// Event 6b can't replace a non-empty base, and two of the three instructions in the last event are bad
+	if that.Len(problems, 3) {
+		that.Equal(1, problems[0].EventIndex)
+		that.Equal(0, problems[0].InstructionIndex)
+		that.Equal(2, problems[1].EventIndex)
+		that.Equal(1, problems[1].InstructionIndex)
+		that.Equal("noSuchField", problems[1].Path)
+		that.Equal(2, problems[2].EventIndex)
+		that.Equal(2, problems[2].InstructionIndex)
+		that.Contains(problems[2].Error(), "event[2]")
+		that.Contains(problems[2].Error(), "instruction[2]")
+	}
+}
+
+func TestGetCurrentStateErrorSaysWhichInstruction(t *testing.T) {
+	that := assert.New(t)
+	eventId := uuid.New()
+	inputDoc := inlineDocument(`{"a":1}`, scalarSet("b", "fine"))
+	inputDoc.Events = append(inputDoc.Events, eventsourceprocessor.DocumentEvent{
+		EventId: eventId,
+		Instructions: []eventsourceprocessor.EventInstruction{
+			scalarSet("c", "fine"),
+			{Path: "noSuchObject.field", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "nope"},
+		},
+	})
+	_, err := inputDoc.GetCurrentState()
+
+	if that.NotNil(err) {
+		that.Contains(err.Error(), "event[1] (id="+eventId.String()+") instruction[1]")
+		that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+		var instructionErr eventsourceprocessor.InstructionError
+		if that.True(errors.As(err, &instructionErr)) {
+			that.Equal(1, instructionErr.EventIndex)
+			that.Equal(eventId, instructionErr.EventId)
+			that.Equal(1, instructionErr.InstructionIndex)
+			that.Equal("noSuchObject.field", instructionErr.Path)
+		}
+	}
+}
+
+func TestValidateCleanStream(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := buildDocument("TestValidateCleanStream", "base.json", []string{"event1.json", "event2.json", "event3.json", "event4.json"})
+	inputDoc.Events = append(inputDoc.Events, eventsourceprocessor.DocumentEvent{
+		Instructions: []eventsourceprocessor.EventInstruction{
+			{Path: "/a/0", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: gzipBase64(`{"b":1}`), ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64},
+			{Path: "notes", ActionType: eventsourceprocessor.ActionTypeNoOp, Value: "anything goes"},
+			incrementInstruction("count", "1"),
+			moveInstruction("a.b", "c"),
+		},
+	})
+
+	that.Nil(inputDoc.Validate())
+}
+
+func TestValidateInvalidInstructions_Fail(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		instruction eventsourceprocessor.EventInstruction
+		detail      string
+	}{
+		{
+			name:        "unknown action type",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: "Upsert", DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+			detail:      "unknown action type `Upsert`",
+		},
+		{
+			name:        "unknown data type",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: "decimal", Value: "1.10"},
+			detail:      "unknown data type `decimal`",
+		},
+		{
+			name:        "no data type",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, Value: "x"},
+			detail:      "no data type",
+		},
+		{
+			name:        "malformed path",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a[first]b", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+			detail:      "malformed path segment",
+		},
+		{
+			name:        "parent of the root",
+			instruction: eventsourceprocessor.EventInstruction{Path: "^.a", ActionType: eventsourceprocessor.ActionTypeRemove},
+			detail:      "parent of the document root",
+		},
+		{
+			name:        "unparseable number",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "twelve"},
+			detail:      "`twelve` is not a valid float64 value",
+		},
+		{
+			name:        "unparseable bool",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeBool, Value: "maybe"},
+			detail:      "`maybe` is not a valid bool value",
+		},
+		{
+			name:        "invalid map JSON",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `{"a":`},
+			detail:      "not valid JSON",
+		},
+		{
+			name:        "array value for a map",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeMap, Value: `[1]`},
+			detail:      "`[1]` is not a valid map value",
+		},
+		{
+			name:        "invalid array JSON",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeAppend, DataType: eventsourceprocessor.DataTypeArray, Value: `[1,`},
+			detail:      "not valid JSON",
+		},
+		{
+			name:        "bad value encoding",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeString, Value: "!", ValueEncoding: eventsourceprocessor.ValueEncodingGzipBase64},
+			detail:      "gzip+base64",
+		},
+		{
+			name:        "bad expected value",
+			instruction: eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeCompareAndSet, DataType: eventsourceprocessor.DataTypeString, Value: "x", ExpectedDataType: eventsourceprocessor.DataTypeNumber, ExpectedValue: "x"},
+			detail:      "invalid expected value",
+		},
+		{
+			name:        "bad move source",
+			instruction: moveInstruction("a[", "b"),
+			detail:      "invalid Move source path",
+		},
+		{
+			name:        "empty copy source",
+			instruction: copyInstruction("", "b"),
+			detail:      "the Copy action needs a source path in its value",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			that := assert.New(t)
+			inputDoc := inlineDocument(`{}`, scalarSet("fine", "x"), test.instruction)
+
+			err := inputDoc.Validate()
+
+			var instructionErr eventsourceprocessor.InstructionError
+			if that.ErrorAs(err, &instructionErr) {
+				that.Equal(1, instructionErr.InstructionIndex)
+				that.ErrorContains(err, test.detail)
+			}
+		})
+	}
+}
+
+func TestValidateBeforeApply(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+		eventsourceprocessor.EventInstruction{Path: "a", ActionType: eventsourceprocessor.ActionTypeSetOrAdd, DataType: eventsourceprocessor.DataTypeNumber, Value: "twelve"},
+	)
+
+	// Applied in order, the first instruction fails first...
+	_, err := inputDoc.GetCurrentState()
+	that.ErrorContains(err, "instruction[0]")
+
+	// ...but validating first catches the malformed one before anything is applied
+	configure(t, func(c *eventsourceprocessor.Configuration) {
+		c.ValidateBeforeApply = true
+	})
+	_, err = inputDoc.GetCurrentState()
+	that.ErrorContains(err, "instruction[1]")
+	that.ErrorIs(err, eventsourceprocessor.ErrInvalidDataType)
+
+	// Every way of applying events validates first
+	_, _, err = inputDoc.ApplyDetailed()
+	that.ErrorContains(err, "instruction[1]")
+	_, err = inputDoc.Preview()
+	that.ErrorContains(err, "instruction[1]")
+	_, err = inputDoc.ToJSONPatch()
+	that.ErrorContains(err, "instruction[1]")
+	_, errs := inputDoc.GetCurrentStateLenient()
+	if that.Len(errs, 1) {
+		that.ErrorContains(errs[0], "instruction[1]")
+	}
+	problems := eventsourceprocessor.ValidateStream(inputDoc)
+	if that.Len(problems, 1) {
+		that.Equal(1, problems[0].InstructionIndex)
+	}
+}
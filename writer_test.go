@@ -0,0 +1,61 @@
+package eventsourceprocessor_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	eventsourceprocessor "github.com/adev73/event-source-processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCurrentState(t *testing.T) {
+	that := assert.New(t)
+	documents := []eventsourceprocessor.Document{
+		recentActivityDocument(),
+		inlineDocument(`[1,{"a":[true,null]}]`, scalarSet("[new]", "x")),
+		inlineDocument(`"bare"`),
+		inlineDocument(`{}`),
+	}
+	for i, inputDoc := range documents {
+		expected, err := inputDoc.GetCurrentState()
+		that.NoError(err, "document %d", i)
+
+		var out bytes.Buffer
+		err = inputDoc.WriteCurrentState(&out)
+
+		if that.NoError(err, "document %d", i) {
+			that.Equal(string(expected), out.String(), "document %d", i)
+		}
+	}
+}
+
+func TestWriteCurrentStateFails(t *testing.T) {
+	that := assert.New(t)
+	inputDoc := inlineDocument(`{}`,
+		eventsourceprocessor.EventInstruction{Path: "missing", ActionType: eventsourceprocessor.ActionTypeSetOnly, DataType: eventsourceprocessor.DataTypeString, Value: "x"},
+	)
+
+	var out bytes.Buffer
+	err := inputDoc.WriteCurrentState(&out)
+
+	that.True(errors.Is(err, eventsourceprocessor.ErrElementNotFound))
+	that.Zero(out.Len())
+}
+
+// failingWriter is an io.Writer which always fails.
+type failingWriter struct{}
+
+var errWriteFailed = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func TestWriteCurrentStateWriterFails(t *testing.T) {
+	that := assert.New(t)
+
+	err := recentActivityDocument().WriteCurrentState(failingWriter{})
+
+	that.True(errors.Is(err, errWriteFailed))
+}